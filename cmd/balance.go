@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+type balanceEntry struct {
+	Network string `json:"network"`
+	Account string `json:"account"`
+	Balance string `json:"balance,omitempty"`
+	Symbol  string `json:"symbol"`
+	Error   string `json:"error,omitempty"`
+}
+
+func runBalance(args []string) int {
+	fs := newFlagSet("balance", "[-config multichain-config.json] [-json]")
+	configPath := fs.String("config", "multichain-config.json", "Path to multi-chain configuration file")
+	asJSON := fs.Bool("json", false, "Print the balances as JSON")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each provider")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	multiConfig, err := loadMultiChainConfig(*configPath)
+	if err != nil {
+		return fail("failed to load multi-chain config: %v", err)
+	}
+
+	networks := multiConfig.GetChainNetworks()
+	sort.Strings(networks)
+	entries := make([]balanceEntry, 0, len(networks))
+	code := exitOK
+	for _, network := range networks {
+		chainInstance, _ := multiConfig.GetChain(network)
+		entry := balanceEntry{
+			Network: network,
+			Account: crypto.PubkeyToAddress(chainInstance.PrivateKey.PublicKey).Hex(),
+			Symbol:  chainInstance.Config.Symbol,
+		}
+		balance, err := fetchBalance(chainInstance, *timeout)
+		if err != nil {
+			entry.Error = err.Error()
+			code = exitFailure
+		} else {
+			entry.Balance = chain.FromBaseUnits(balance, chainInstance.Config.Decimals).String()
+		}
+		entries = append(entries, entry)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return fail("%v", err)
+		}
+		return code
+	}
+
+	for _, entry := range entries {
+		if entry.Error != "" {
+			fmt.Fprintf(stdout, "%-20s %s  error: %s\n", entry.Network, entry.Account, entry.Error)
+			continue
+		}
+		fmt.Fprintf(stdout, "%-20s %s  %s %s\n", entry.Network, entry.Account, entry.Balance, entry.Symbol)
+	}
+	return code
+}
+
+func fetchBalance(chainInstance *config.ChainInstance, timeout time.Duration) (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client, err := ethclient.DialContext(ctx, chainInstance.Provider)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	return client.BalanceAt(ctx, crypto.PubkeyToAddress(chainInstance.PrivateKey.PublicKey), nil)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"os"
+)
+
+func runConfig(args []string) int {
+	return runSubcommands("config", args, []command{
+		{name: "generate", summary: "Write a sample multi-chain configuration file", run: runConfigGenerate},
+		{name: "validate", summary: "Check a multi-chain configuration file", run: runConfigValidate},
+	})
+}
+
+func runConfigGenerate(args []string) int {
+	fs := newFlagSet("config generate", "[-o multichain-config.json] [-force]")
+	output := fs.String("o", "multichain-config.json", "Path of the generated configuration file")
+	force := fs.Bool("force", false, "Overwrite an existing file")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fail("%s already exists, use -force to overwrite it", *output)
+	}
+	if err := GenerateMultiChainConfig(*output); err != nil {
+		return fail("failed to generate config: %v", err)
+	}
+	return exitOK
+}
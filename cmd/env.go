@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+// envPrefix starts every environment variable that overrides a configuration
+// field, e.g. FAUCET_HTTP_PORT or FAUCET_NETWORKS_SEPOLIA_PAYOUT
+const envPrefix = "FAUCET_"
+
+var errUnknownSetting = errors.New("unknown setting")
+
+// applyEnvOverrides sets the fields named by the FAUCET_* variables of
+// environ and returns how many were applied. A variable names a field by its
+// upper-cased configuration keys joined with underscores. Networks are
+// addressed by name, with dashes written as underscores, and are added when
+// the file does not configure them. Lists such as RATE_LIMITS take JSON.
+func applyEnvOverrides(fileConfig *MultiChainConfigFile, environ []string) (int, error) {
+	environ = append([]string(nil), environ...)
+	sort.Strings(environ)
+
+	applied := 0
+	for _, kv := range environ {
+		key, value := kv, ""
+		if i := strings.Index(kv, "="); i >= 0 {
+			key, value = kv[:i], kv[i+1:]
+		}
+		if !strings.HasPrefix(key, envPrefix) {
+			continue
+		}
+
+		var err error
+		path := strings.TrimPrefix(key, envPrefix)
+		if rest := strings.TrimPrefix(path, "NETWORKS_"); rest != path {
+			err = setNetworkField(fileConfig, rest, value)
+		} else {
+			err = setField(reflect.ValueOf(fileConfig).Elem(), path, value)
+		}
+		if err != nil {
+			return applied, fmt.Errorf("%s: %w", key, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// hasEnvNetworks reports whether the environment configures any network
+func hasEnvNetworks() bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, envPrefix+"NETWORKS") {
+			return true
+		}
+	}
+	return false
+}
+
+// setNetworkField sets a field of the network that rest starts with. Network
+// names may contain underscores themselves, so every split is tried.
+func setNetworkField(fileConfig *MultiChainConfigFile, rest, value string) error {
+	for i := strings.Index(rest, "_"); i >= 0; {
+		if name := networkForEnv(fileConfig, rest[:i]); name != "" {
+			index := -1
+			netConfig := NetworkConfigFile{Name: name}
+			for j := range fileConfig.Networks {
+				if fileConfig.Networks[j].Name == name {
+					index, netConfig = j, fileConfig.Networks[j]
+					break
+				}
+			}
+
+			err := setField(reflect.ValueOf(&netConfig).Elem(), rest[i+1:], value)
+			if err == nil {
+				if index >= 0 {
+					fileConfig.Networks[index] = netConfig
+				} else {
+					fileConfig.Networks = append(fileConfig.Networks, netConfig)
+				}
+				return nil
+			}
+			if !errors.Is(err, errUnknownSetting) {
+				return err
+			}
+		}
+
+		next := strings.Index(rest[i+1:], "_")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return errUnknownSetting
+}
+
+// networkForEnv returns the configured or supported network written as key
+func networkForEnv(fileConfig *MultiChainConfigFile, key string) string {
+	for _, netConfig := range fileConfig.Networks {
+		if envName(netConfig.Name) == key {
+			return netConfig.Name
+		}
+	}
+	for name := range config.GetSupportedNetworks() {
+		if envName(name) == key {
+			return name
+		}
+	}
+	return ""
+}
+
+func envName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// setField sets the field of the struct v that path names
+func setField(v reflect.Value, path, value string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := envName(strings.Split(t.Field(i).Tag.Get("json"), ",")[0])
+		if name == "" || name == "-" {
+			continue
+		}
+
+		field := v.Field(i)
+		if path == name {
+			return setValue(field, value)
+		}
+		if !strings.HasPrefix(path, name+"_") {
+			continue
+		}
+		if field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Struct {
+			target := field
+			if field.IsNil() {
+				target = reflect.New(field.Type().Elem())
+			}
+			if err := setField(target.Elem(), path[len(name)+1:], value); err != nil {
+				return err
+			}
+			field.Set(target)
+			return nil
+		}
+		if field.Kind() == reflect.Struct {
+			return setField(field, path[len(name)+1:], value)
+		}
+	}
+	return errUnknownSetting
+}
+
+func setValue(field reflect.Value, value string) error {
+	var err error
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(value); err == nil {
+			field.SetBool(b)
+		}
+	case reflect.Int, reflect.Int64:
+		var n int64
+		if n, err = strconv.ParseInt(value, 10, 64); err == nil {
+			field.SetInt(n)
+		}
+	case reflect.Uint, reflect.Uint64:
+		var n uint64
+		if n, err = strconv.ParseUint(value, 10, 64); err == nil {
+			field.SetUint(n)
+		}
+	case reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(value, 64); err == nil {
+			field.SetFloat(f)
+		}
+	default:
+		err = json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	return nil
+}
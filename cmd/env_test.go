@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMultiChainConfigFile(t *testing.T) {
+	want := &MultiChainConfigFile{
+		HTTPPort:       8080,
+		DefaultNetwork: "sepolia",
+		ClaimQueue:     &ClaimQueueFile{Async: true, Workers: 2},
+		Networks: []NetworkConfigFile{{
+			Name:       "sepolia",
+			PrivateKey: testPrivateKey,
+			Payout:     "1",
+			RateLimits: []RateLimitConfigFile{{Key: "address", Limit: 1, Window: "1d"}},
+			Batch:      &BatchConfigFile{Contract: "0x00000000000000000000000000000000000000aa", MaxSize: 10},
+		}},
+	}
+	files := map[string]string{
+		"config.json": `{
+			"http_port": 8080, "default_network": "sepolia",
+			"claim_queue": {"async": true, "workers": 2},
+			"networks": [{
+				"name": "sepolia", "private_key": "` + testPrivateKey + `", "payout": 1,
+				"rate_limits": [{"key": "address", "limit": 1, "window": "1d"}],
+				"batch": {"contract": "0x00000000000000000000000000000000000000aa", "max_size": 10}
+			}]
+		}`,
+		"config.yaml": `
+http_port: 8080
+default_network: sepolia
+claim_queue:
+  async: true
+  workers: 2
+networks:
+  - name: sepolia
+    private_key: "` + testPrivateKey + `"
+    payout: 1
+    rate_limits:
+      - {key: address, limit: 1, window: 1d}
+    batch:
+      contract: "0x00000000000000000000000000000000000000aa"
+      max_size: 10
+`,
+		"config.toml": `
+http_port = 8080
+default_network = "sepolia"
+
+[claim_queue]
+async = true
+workers = 2
+
+[[networks]]
+name = "sepolia"
+private_key = "` + testPrivateKey + `"
+payout = 1.0
+
+[[networks.rate_limits]]
+key = "address"
+limit = 1
+window = "1d"
+
+[networks.batch]
+contract = "0x00000000000000000000000000000000000000aa"
+max_size = 10
+`,
+	}
+
+	dir := t.TempDir()
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := parseMultiChainConfigFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseMultiChainConfigFile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		environ []string
+		want    MultiChainConfigFile
+		wantErr bool
+	}{
+		{
+			name:    "top level and nested fields",
+			environ: []string{"FAUCET_HTTP_PORT=9090", "FAUCET_HCAPTCHA_SECRET=s3cret", "FAUCET_CLAIM_QUEUE_ASYNC=true", "PATH=/bin"},
+			want: MultiChainConfigFile{
+				HTTPPort:       9090,
+				HcaptchaSecret: "s3cret",
+				ClaimQueue:     &ClaimQueueFile{Async: true},
+				Networks:       []NetworkConfigFile{{Name: "sepolia", Payout: "1"}},
+			},
+		},
+		{
+			name:    "existing network",
+			environ: []string{"FAUCET_NETWORKS_SEPOLIA_PAYOUT=0.5", "FAUCET_NETWORKS_SEPOLIA_BATCH_MAX_SIZE=20"},
+			want: MultiChainConfigFile{
+				Networks: []NetworkConfigFile{{Name: "sepolia", Payout: "0.5", Batch: &BatchConfigFile{MaxSize: 20}}},
+			},
+		},
+		{
+			name: "new network with dashes and a JSON list",
+			environ: []string{
+				"FAUCET_NETWORKS_POLYGON_AMOY_PRIVATE_KEY=0xabc",
+				`FAUCET_NETWORKS_POLYGON_AMOY_RATE_LIMITS=[{"key":"ip","limit":2,"window":"1h"}]`,
+			},
+			want: MultiChainConfigFile{
+				Networks: []NetworkConfigFile{
+					{Name: "sepolia", Payout: "1"},
+					{Name: "polygon-amoy", PrivateKey: "0xabc", RateLimits: []RateLimitConfigFile{{Key: "ip", Limit: 2, Window: "1h"}}},
+				},
+			},
+		},
+		{name: "unknown field", environ: []string{"FAUCET_HTTP_PORTS=1"}, wantErr: true},
+		{name: "unknown network", environ: []string{"FAUCET_NETWORKS_NOWHERE_PAYOUT=1"}, wantErr: true},
+		{name: "invalid value", environ: []string{"FAUCET_HTTP_PORT=eighty"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MultiChainConfigFile{Networks: []NetworkConfigFile{{Name: "sepolia", Payout: "1"}}}
+			_, err := applyEnvOverrides(&got, tt.environ)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyEnvOverrides() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("applyEnvOverrides() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
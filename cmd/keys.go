@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+type keyListEntry struct {
+	Address string `json:"address"`
+	File    string `json:"file"`
+}
+
+func runKeys(args []string) int {
+	return runSubcommands("keys", args, []command{
+		{name: "new", summary: "Create a new account in a keystore directory", run: runKeysNew},
+		{name: "import", summary: "Import a private key into a keystore directory", run: runKeysImport},
+		{name: "list", summary: "List the accounts in a keystore directory", run: runKeysList},
+	})
+}
+
+func runKeysNew(args []string) int {
+	fs := newFlagSet("keys new", "-password password.txt [-dir keystore]")
+	dir := fs.String("dir", "keystore", "Keystore directory")
+	passwordFile := fs.String("password", "password.txt", "Passphrase text file to encrypt the key with")
+	light := fs.Bool("light", false, "Use light scrypt parameters, faster but weaker")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+	scryptN, scryptP := scryptParams(*light)
+	account, err := keystore.StoreKey(*dir, password, scryptN, scryptP)
+	if err != nil {
+		return fail("failed to create key: %v", err)
+	}
+
+	fmt.Fprintf(stdout, "Address: %s\nKeyfile: %s\n", account.Address.Hex(), account.URL.Path)
+	return exitOK
+}
+
+func runKeysImport(args []string) int {
+	fs := newFlagSet("keys import", "-password password.txt [-dir keystore] [-privkey hex]")
+	dir := fs.String("dir", "keystore", "Keystore directory")
+	passwordFile := fs.String("password", "password.txt", "Passphrase text file to encrypt the key with")
+	privKey := fs.String("privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to import")
+	light := fs.Bool("light", false, "Use light scrypt parameters, faster but weaker")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if *privKey == "" {
+		fmt.Fprintln(stderr, "-privkey or the PRIVATE_KEY environment variable is required")
+		fs.Usage()
+		return exitUsage
+	}
+	privateKey, err := parsePrivateKeyHex(*privKey)
+	if err != nil {
+		return fail("failed to parse private key: %v", err)
+	}
+	password, err := readPassword(*passwordFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	scryptN, scryptP := scryptParams(*light)
+	account, err := keystore.NewKeyStore(*dir, scryptN, scryptP).ImportECDSA(privateKey, password)
+	if err != nil {
+		return fail("failed to import key: %v", err)
+	}
+
+	fmt.Fprintf(stdout, "Address: %s\nKeyfile: %s\n", account.Address.Hex(), account.URL.Path)
+	return exitOK
+}
+
+func runKeysList(args []string) int {
+	fs := newFlagSet("keys list", "[-dir keystore] [-json]")
+	dir := fs.String("dir", "keystore", "Keystore directory")
+	asJSON := fs.Bool("json", false, "Print the accounts as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	entries, err := listKeys(*dir)
+	if err != nil {
+		return fail("failed to list keys: %v", err)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return fail("%v", err)
+		}
+		return exitOK
+	}
+	for _, entry := range entries {
+		fmt.Fprintf(stdout, "%s  %s\n", entry.Address, entry.File)
+	}
+	return exitOK
+}
+
+// listKeys reads the address of every keyfile in dir without decrypting it
+func listKeys(dir string) ([]keyListEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []keyListEntry{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var key struct {
+			Address string `json:"address"`
+		}
+		if err := json.Unmarshal(data, &key); err != nil || !common.IsHexAddress(key.Address) {
+			continue
+		}
+		entries = append(entries, keyListEntry{
+			Address: common.HexToAddress(key.Address).Hex(),
+			File:    path,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].File < entries[j].File
+	})
+	return entries, nil
+}
+
+func readPassword(passwordFile string) (string, error) {
+	password, err := os.ReadFile(passwordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password file: %w", err)
+	}
+	return strings.TrimRight(string(password), "\r\n"), nil
+}
+
+func scryptParams(light bool) (int, int) {
+	if light {
+		return keystore.LightScryptN, keystore.LightScryptP
+	}
+	return keystore.StandardScryptN, keystore.StandardScryptP
+}
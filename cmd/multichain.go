@@ -1,124 +1,539 @@
 package cmd
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
 
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
 	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
 	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
 	"github.com/guyuxiang/multi-chain-faucet/internal/server"
+	"github.com/guyuxiang/multi-chain-faucet/internal/telemetry"
 )
 
 // MultiChainConfigFile represents the structure of the multi-chain configuration file
 type MultiChainConfigFile struct {
-	HTTPPort        int                 `json:"http_port"`
-	ProxyCount      int                 `json:"proxy_count"`
-	HcaptchaSiteKey string              `json:"hcaptcha_sitekey"`
-	HcaptchaSecret  string              `json:"hcaptcha_secret"`
-	DefaultNetwork  string              `json:"default_network"`
-	Networks        []NetworkConfigFile `json:"networks"`
+	HTTPPort        int                 `json:"http_port" yaml:"http_port" toml:"http_port"`
+	ProxyCount      int                 `json:"proxy_count" yaml:"proxy_count" toml:"proxy_count"`
+	HcaptchaSiteKey string              `json:"hcaptcha_sitekey" yaml:"hcaptcha_sitekey" toml:"hcaptcha_sitekey"`
+	HcaptchaSecret  string              `json:"hcaptcha_secret" yaml:"hcaptcha_secret" toml:"hcaptcha_secret"`
+	DefaultNetwork  string              `json:"default_network" yaml:"default_network" toml:"default_network"`
+	APIKeys         []string            `json:"api_keys,omitempty" yaml:"api_keys,omitempty" toml:"api_keys,omitempty"`
+	AuthHeader      string              `json:"auth_header,omitempty" yaml:"auth_header,omitempty" toml:"auth_header,omitempty"`
+	ClaimQueue      *ClaimQueueFile     `json:"claim_queue,omitempty" yaml:"claim_queue,omitempty" toml:"claim_queue,omitempty"`
+	NameService     *NameServiceFile    `json:"name_service,omitempty" yaml:"name_service,omitempty" toml:"name_service,omitempty"`
+	Chainlist       *ChainlistFile      `json:"chainlist,omitempty" yaml:"chainlist,omitempty" toml:"chainlist,omitempty"`
+	Tracing         *TracingFile        `json:"tracing,omitempty" yaml:"tracing,omitempty" toml:"tracing,omitempty"`
+	Audit           *AuditFile          `json:"audit,omitempty" yaml:"audit,omitempty" toml:"audit,omitempty"`
+	Networks        []NetworkConfigFile `json:"networks" yaml:"networks" toml:"networks"`
+}
+
+// ChainlistFile adds the networks of a chainlist.org or ethereum-lists JSON
+// file to the supported networks
+type ChainlistFile struct {
+	File              string  `json:"file" yaml:"file" toml:"file"`
+	ChainIDs          []int64 `json:"chain_ids,omitempty" yaml:"chain_ids,omitempty" toml:"chain_ids,omitempty"`
+	IncludeDeprecated bool    `json:"include_deprecated,omitempty" yaml:"include_deprecated,omitempty" toml:"include_deprecated,omitempty"`
+}
+
+// TracingFile exports OpenTelemetry spans of requests, claims and RPC calls.
+// The exporter is none, otlp or stdout.
+type TracingFile struct {
+	Exporter    string  `json:"exporter" yaml:"exporter" toml:"exporter"`
+	Endpoint    string  `json:"endpoint,omitempty" yaml:"endpoint,omitempty" toml:"endpoint,omitempty"`
+	Insecure    bool    `json:"insecure,omitempty" yaml:"insecure,omitempty" toml:"insecure,omitempty"`
+	SampleRatio float64 `json:"sample_ratio,omitempty" yaml:"sample_ratio,omitempty" toml:"sample_ratio,omitempty"`
+	ServiceName string  `json:"service_name,omitempty" yaml:"service_name,omitempty" toml:"service_name,omitempty"`
+}
+
+// AuditFile writes a JSON line per claim attempt to output, a file that is
+// rotated at max_size_mb, or stdout
+type AuditFile struct {
+	Output     string `json:"output" yaml:"output" toml:"output"`
+	MaxSizeMB  int    `json:"max_size_mb,omitempty" yaml:"max_size_mb,omitempty" toml:"max_size_mb,omitempty"`
+	MaxBackups int    `json:"max_backups,omitempty" yaml:"max_backups,omitempty" toml:"max_backups,omitempty"`
+	MaxAgeDays int    `json:"max_age_days,omitempty" yaml:"max_age_days,omitempty" toml:"max_age_days,omitempty"`
+	Compress   bool   `json:"compress,omitempty" yaml:"compress,omitempty" toml:"compress,omitempty"`
+}
+
+// NameServiceFile lets claims name their recipient, e.g. vitalik.eth
+type NameServiceFile struct {
+	Network  string `json:"network" yaml:"network" toml:"network"`
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty" toml:"provider,omitempty"`
+	Registry string `json:"registry,omitempty" yaml:"registry,omitempty" toml:"registry,omitempty"`
+}
+
+// ClaimQueueFile configures the per-network claim queues
+type ClaimQueueFile struct {
+	Async         bool   `json:"async" yaml:"async" toml:"async"`
+	Workers       int    `json:"workers" yaml:"workers" toml:"workers"`
+	Capacity      int    `json:"capacity" yaml:"capacity" toml:"capacity"`
+	Store         string `json:"store" yaml:"store" toml:"store"`
+	Confirmations uint64 `json:"confirmations" yaml:"confirmations" toml:"confirmations"`
+	NonceDir      string `json:"nonce_dir,omitempty" yaml:"nonce_dir,omitempty" toml:"nonce_dir,omitempty"`
 }
 
 type NetworkConfigFile struct {
-	Name       string  `json:"name"`
-	Provider   string  `json:"provider"`
-	PrivateKey string  `json:"private_key"`
-	Keystore   string  `json:"keystore"`
-	KeyPass    string  `json:"key_pass"`
-	Payout     float64 `json:"payout"`
-	Interval   int     `json:"interval"`
+	Name       string                    `json:"name" yaml:"name" toml:"name"`
+	Provider   string                    `json:"provider" yaml:"provider" toml:"provider"`
+	PrivateKey string                    `json:"private_key" yaml:"private_key" toml:"private_key"`
+	Keystore   string                    `json:"keystore" yaml:"keystore" toml:"keystore"`
+	KeyPass    string                    `json:"key_pass" yaml:"key_pass" toml:"key_pass"`
+	Payout     configAmount              `json:"payout" yaml:"payout" toml:"payout"`
+	Decimals   int                       `json:"decimals,omitempty" yaml:"decimals,omitempty" toml:"decimals,omitempty"`
+	Interval   int                       `json:"interval" yaml:"interval" toml:"interval"`
+	RateLimits []RateLimitConfigFile     `json:"rate_limits,omitempty" yaml:"rate_limits,omitempty" toml:"rate_limits,omitempty"`
+	Batch      *BatchConfigFile          `json:"batch,omitempty" yaml:"batch,omitempty" toml:"batch,omitempty"`
+	Gas        *GasConfigFile            `json:"gas,omitempty" yaml:"gas,omitempty" toml:"gas,omitempty"`
+	Tiers      map[string]TierConfigFile `json:"tiers,omitempty" yaml:"tiers,omitempty" toml:"tiers,omitempty"`
+	// Sunset deprecates the network until the date, e.g. 2026-12-31, or RFC 3339 time
+	Sunset string `json:"sunset,omitempty" yaml:"sunset,omitempty" toml:"sunset,omitempty"`
+	// Paused keeps the network listed but refuses its claims
+	Paused bool `json:"paused,omitempty" yaml:"paused,omitempty" toml:"paused,omitempty"`
+	// MaxBlockAge is how old the latest block may get before readiness
+	// checks count the network as behind, e.g. 90s
+	MaxBlockAge string `json:"max_block_age,omitempty" yaml:"max_block_age,omitempty" toml:"max_block_age,omitempty"`
+
+	// Metadata shown to users, overriding the built-in values
+	ExplorerTxURL      string `json:"explorer_tx_url,omitempty" yaml:"explorer_tx_url,omitempty" toml:"explorer_tx_url,omitempty"`
+	ExplorerAddressURL string `json:"explorer_address_url,omitempty" yaml:"explorer_address_url,omitempty" toml:"explorer_address_url,omitempty"`
+	PublicRPC          string `json:"public_rpc,omitempty" yaml:"public_rpc,omitempty" toml:"public_rpc,omitempty"`
+	CurrencyName       string `json:"currency_name,omitempty" yaml:"currency_name,omitempty" toml:"currency_name,omitempty"`
+	Icon               string `json:"icon,omitempty" yaml:"icon,omitempty" toml:"icon,omitempty"`
+}
+
+// TierConfigFile sets what one kind of caller gets on a network. Without
+// rate_limits the tier shares the rules of the network; an empty list
+// disables rate limiting for the tier.
+type TierConfigFile struct {
+	Payout     configAmount          `json:"payout" yaml:"payout" toml:"payout"`
+	MaxAmount  configAmount          `json:"max_amount,omitempty" yaml:"max_amount,omitempty" toml:"max_amount,omitempty"`
+	RateLimits []RateLimitConfigFile `json:"rate_limits,omitempty" yaml:"rate_limits,omitempty" toml:"rate_limits,omitempty"`
+}
+
+// BatchConfigFile enables batched payouts through a multisend contract
+type BatchConfigFile struct {
+	Contract string `json:"contract" yaml:"contract" toml:"contract"`
+	Window   string `json:"window" yaml:"window" toml:"window"`
+	MaxSize  int    `json:"max_size" yaml:"max_size" toml:"max_size"`
+}
+
+// GasConfigFile selects how the transactions of a network are priced. The
+// max fee is in gwei per gas.
+type GasConfigFile struct {
+	Strategy   string       `json:"strategy,omitempty" yaml:"strategy,omitempty" toml:"strategy,omitempty"`
+	Margin     uint64       `json:"margin,omitempty" yaml:"margin,omitempty" toml:"margin,omitempty"`
+	Blocks     uint64       `json:"blocks,omitempty" yaml:"blocks,omitempty" toml:"blocks,omitempty"`
+	Percentile float64      `json:"percentile,omitempty" yaml:"percentile,omitempty" toml:"percentile,omitempty"`
+	MaxFeeGwei configAmount `json:"max_fee_gwei,omitempty" yaml:"max_fee_gwei,omitempty" toml:"max_fee_gwei,omitempty"`
+	OPStack    bool         `json:"op_stack,omitempty" yaml:"op_stack,omitempty" toml:"op_stack,omitempty"`
+}
+
+// RateLimitConfigFile describes one rate limit rule, e.g. 3 claims per address
+// per "1d", or with a quota the amount claimed in native units
+type RateLimitConfigFile struct {
+	Key       string       `json:"key" yaml:"key" toml:"key"`
+	Limit     int          `json:"limit,omitempty" yaml:"limit,omitempty" toml:"limit,omitempty"`
+	Quota     configAmount `json:"quota,omitempty" yaml:"quota,omitempty" toml:"quota,omitempty"`
+	Window    string       `json:"window" yaml:"window" toml:"window"`
+	Algorithm string       `json:"algorithm,omitempty" yaml:"algorithm,omitempty" toml:"algorithm,omitempty"`
+	Burst     int          `json:"burst,omitempty" yaml:"burst,omitempty" toml:"burst,omitempty"`
+}
+
+// configAmount is an amount in native units, kept as written in the
+// configuration file so that it converts to base units exactly. TOML floats
+// only keep about 15 significant digits, longer amounts have to be quoted.
+type configAmount string
+
+func (a *configAmount) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*a = configAmount(n)
+	return nil
+}
+
+func (a *configAmount) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		*a = configAmount(v)
+	case int64:
+		*a = configAmount(strconv.FormatInt(v, 10))
+	case float64:
+		*a = configAmount(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("invalid amount %v", value)
+	}
+	return nil
 }
 
-// ExecuteMultiChain starts the multi-chain faucet server
-func ExecuteMultiChain(configPath string) {
+// decimal parses the amount, an empty amount is zero
+func (a configAmount) decimal() (decimal.Decimal, error) {
+	if a == "" {
+		return decimal.Zero, nil
+	}
+	amount, err := decimal.NewFromString(string(a))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid amount %q", string(a))
+	}
+	return amount, nil
+}
+
+// serveMultiChain starts the multi-chain faucet server in the background
+func serveMultiChain(configPath string) (*server.MultiChainServer, error) {
 	// Load configuration
 	multiConfig, err := loadMultiChainConfig(configPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to load multi-chain config: %w", err))
+		return nil, fmt.Errorf("failed to load multi-chain config: %w", err)
 	}
 
 	// Create and start server
 	server, err := server.NewMultiChainServer(multiConfig)
 	if err != nil {
-		panic(fmt.Errorf("failed to create multi-chain server: %w", err))
+		return nil, fmt.Errorf("failed to create multi-chain server: %w", err)
 	}
 
 	go server.Run()
-
-	// Wait for interrupt signal
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	return server, nil
 }
 
-// loadMultiChainConfig loads configuration from JSON file
+// loadMultiChainConfig loads configuration from a JSON, YAML or TOML file and the environment
 func loadMultiChainConfig(configPath string) (*config.MultiChainConfig, error) {
-	// Read config file
+	fileConfig, err := readMultiChainConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if fileConfig.Chainlist != nil {
+		if _, err := importChainlist(*fileConfig.Chainlist); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create multi-chain config
+	multiConfig := newMultiChainConfig(fileConfig)
+
+	// Add networks
+	for _, netConfig := range fileConfig.Networks {
+		chainInput, err := chainInputFromFile(netConfig)
+		if err != nil {
+			return nil, err
+		}
+		privateKey, err := networkPrivateKey(netConfig)
+		if err != nil {
+			return nil, err
+		}
+		if err := multiConfig.AddChainWithKey(chainInput, privateKey); err != nil {
+			return nil, fmt.Errorf("failed to add network %s: %w", netConfig.Name, err)
+		}
+	}
+
+	// Set default network
+	if fileConfig.DefaultNetwork != "" {
+		if _, exists := multiConfig.GetChain(fileConfig.DefaultNetwork); !exists {
+			return nil, fmt.Errorf("default network %s is not configured", fileConfig.DefaultNetwork)
+		}
+		multiConfig.DefaultChain = fileConfig.DefaultNetwork
+	}
+
+	return multiConfig, nil
+}
+
+// importChainlist merges the networks of a chainlist file into the supported networks
+func importChainlist(c ChainlistFile) (config.ChainlistImport, error) {
+	data, err := os.ReadFile(c.File)
+	if err != nil {
+		return config.ChainlistImport{}, fmt.Errorf("failed to read chainlist: %w", err)
+	}
+	entries, err := config.ParseChainlist(data)
+	if err != nil {
+		return config.ChainlistImport{}, fmt.Errorf("failed to parse chainlist %s: %w", c.File, err)
+	}
+	return config.ImportChainlist(entries, c.ChainIDs, c.IncludeDeprecated), nil
+}
+
+// readMultiChainConfigFile reads a configuration file and applies the
+// FAUCET_* environment overrides. Without a path the configuration comes from
+// the environment only.
+func readMultiChainConfigFile(configPath string) (*MultiChainConfigFile, error) {
+	fileConfig, err := parseMultiChainConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := applyEnvOverrides(fileConfig, os.Environ()); err != nil {
+		return nil, fmt.Errorf("failed to apply environment overrides: %w", err)
+	}
+	return fileConfig, nil
+}
+
+// parseMultiChainConfigFile parses a JSON, YAML or TOML configuration file,
+// chosen by its extension
+func parseMultiChainConfigFile(configPath string) (*MultiChainConfigFile, error) {
+	var fileConfig MultiChainConfigFile
+	if configPath == "" {
+		return &fileConfig, nil
+	}
+
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	if err := decodeConfigFile(configPath, data, &fileConfig, false); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", configFormat(configPath), err)
+	}
+	return &fileConfig, nil
+}
 
-	// Parse JSON
-	var fileConfig MultiChainConfigFile
-	if err := json.Unmarshal(data, &fileConfig); err != nil {
-		return nil, fmt.Errorf("failed to parse config JSON: %w", err)
+// configFormat returns the format of a configuration file from its extension
+func configFormat(configPath string) string {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		return "YAML"
+	case ".toml":
+		return "TOML"
+	default:
+		return "JSON"
 	}
+}
 
-	// Create multi-chain config
+// decodeConfigFile decodes data in the format of configPath. When strict is
+// set, fields that do not exist in v are an error.
+func decodeConfigFile(configPath string, data []byte, v interface{}, strict bool) error {
+	switch configFormat(configPath) {
+	case "YAML":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(strict)
+		if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case "TOML":
+		md, err := toml.Decode(string(data), v)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); strict && len(undecoded) > 0 {
+			return fmt.Errorf("unknown field %q", undecoded[0].String())
+		}
+	default:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newMultiChainConfig applies the global settings of a configuration file
+func newMultiChainConfig(fileConfig *MultiChainConfigFile) *config.MultiChainConfig {
 	multiConfig := config.NewMultiChainConfig()
 	multiConfig.HTTPPort = fileConfig.HTTPPort
 	multiConfig.ProxyCount = fileConfig.ProxyCount
 	multiConfig.HcaptchaSiteKey = fileConfig.HcaptchaSiteKey
 	multiConfig.HcaptchaSecret = fileConfig.HcaptchaSecret
+	multiConfig.APIKeys = fileConfig.APIKeys
+	multiConfig.AuthHeader = fileConfig.AuthHeader
+	if q := fileConfig.ClaimQueue; q != nil {
+		multiConfig.ClaimQueue.Async = q.Async
+		multiConfig.ClaimQueue.StorePath = q.Store
+		multiConfig.ClaimQueue.NonceDir = q.NonceDir
+		if q.Workers > 0 {
+			multiConfig.ClaimQueue.Workers = q.Workers
+		}
+		if q.Capacity > 0 {
+			multiConfig.ClaimQueue.Capacity = q.Capacity
+		}
+		if q.Confirmations > 0 {
+			multiConfig.ClaimQueue.Confirmations = q.Confirmations
+		}
+	}
+	if ns := fileConfig.NameService; ns != nil {
+		multiConfig.NameService = config.NameServiceConfig{
+			Network:  ns.Network,
+			Provider: ns.Provider,
+			Registry: ns.Registry,
+		}
+	}
+	if t := fileConfig.Tracing; t != nil {
+		multiConfig.Tracing = telemetry.Config{
+			Exporter:    t.Exporter,
+			Endpoint:    t.Endpoint,
+			Insecure:    t.Insecure,
+			SampleRatio: t.SampleRatio,
+			ServiceName: t.ServiceName,
+		}
+	}
+	if a := fileConfig.Audit; a != nil {
+		multiConfig.Audit = audit.Config{
+			Output:     a.Output,
+			MaxSizeMB:  a.MaxSizeMB,
+			MaxBackups: a.MaxBackups,
+			MaxAgeDays: a.MaxAgeDays,
+			Compress:   a.Compress,
+		}
+	}
+	return multiConfig
+}
 
-	// Add networks
-	for _, netConfig := range fileConfig.Networks {
-		chainInput := config.ChainConfigInput{
-			Network:  netConfig.Name,
-			Provider: netConfig.Provider,
-			Payout:   netConfig.Payout,
-			Interval: netConfig.Interval,
+// chainInputFromFile converts the settings of a network, except its key
+func chainInputFromFile(netConfig NetworkConfigFile) (config.ChainConfigInput, error) {
+	var err error
+	chainInput := config.ChainConfigInput{
+		Network:  netConfig.Name,
+		Provider: netConfig.Provider,
+		Decimals: netConfig.Decimals,
+		Interval: netConfig.Interval,
+		Paused:   netConfig.Paused,
+		Metadata: config.NetworkMetadata{
+			ExplorerTxURL:      netConfig.ExplorerTxURL,
+			ExplorerAddressURL: netConfig.ExplorerAddressURL,
+			PublicRPC:          netConfig.PublicRPC,
+			CurrencyName:       netConfig.CurrencyName,
+			Icon:               netConfig.Icon,
+		},
+	}
+	if chainInput.Payout, err = netConfig.Payout.decimal(); err != nil {
+		return chainInput, fmt.Errorf("failed to parse payout for %s: %w", netConfig.Name, err)
+	}
+	if chainInput.Sunset, err = parseSunset(netConfig.Sunset); err != nil {
+		return chainInput, fmt.Errorf("failed to parse sunset for %s: %w", netConfig.Name, err)
+	}
+	if netConfig.MaxBlockAge != "" {
+		if chainInput.MaxBlockAge, err = time.ParseDuration(netConfig.MaxBlockAge); err != nil {
+			return chainInput, fmt.Errorf("failed to parse max_block_age for %s: %w", netConfig.Name, err)
 		}
+	}
 
-		// Parse private key or keystore
-		var privateKey *ecdsa.PrivateKey
-		var err error
+	if chainInput.RateLimits, err = parseRateLimits(netConfig.RateLimits); err != nil {
+		return chainInput, fmt.Errorf("failed to parse rate limit for %s: %w", netConfig.Name, err)
+	}
 
-		if netConfig.PrivateKey != "" {
-			privateKey, err = parsePrivateKeyHex(netConfig.PrivateKey)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse private key for %s: %w", netConfig.Name, err)
+	if len(netConfig.Tiers) > 0 {
+		chainInput.Tiers = make(map[config.Tier]config.TierConfig)
+	}
+	for name, tier := range netConfig.Tiers {
+		var tierConfig config.TierConfig
+		if tierConfig.Payout, err = tier.Payout.decimal(); err == nil {
+			tierConfig.MaxAmount, err = tier.MaxAmount.decimal()
+		}
+		if err != nil {
+			return chainInput, fmt.Errorf("failed to parse payout of tier %s for %s: %w", name, netConfig.Name, err)
+		}
+		if tier.RateLimits != nil {
+			if tierConfig.RateLimits, err = parseRateLimits(tier.RateLimits); err != nil {
+				return chainInput, fmt.Errorf("failed to parse rate limit of tier %s for %s: %w", name, netConfig.Name, err)
 			}
-		} else if netConfig.Keystore != "" {
-			privateKey, err = parseKeystoreFile(netConfig.Keystore, netConfig.KeyPass)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse keystore for %s: %w", netConfig.Name, err)
+			if tierConfig.RateLimits == nil {
+				tierConfig.RateLimits = []ratelimit.Rule{}
 			}
-		} else {
-			return nil, fmt.Errorf("network %s requires either private_key or keystore", netConfig.Name)
 		}
+		chainInput.Tiers[config.Tier(name)] = tierConfig
+	}
 
-		if err := multiConfig.AddChainWithKey(chainInput, privateKey); err != nil {
-			return nil, fmt.Errorf("failed to add network %s: %w", netConfig.Name, err)
+	if gas := netConfig.Gas; gas != nil {
+		chainInput.Gas = chain.GasConfig{
+			Strategy:   chain.GasStrategyName(gas.Strategy),
+			Margin:     gas.Margin,
+			Blocks:     gas.Blocks,
+			Percentile: gas.Percentile,
+			OPStack:    gas.OPStack,
+		}
+		maxFee, err := gas.MaxFeeGwei.decimal()
+		if err == nil && !maxFee.IsZero() {
+			chainInput.Gas.MaxFeeCap, err = chain.ToBaseUnits(maxFee, 9)
+		}
+		if err != nil {
+			return chainInput, fmt.Errorf("failed to parse max fee for %s: %w", netConfig.Name, err)
 		}
 	}
 
-	// Set default network
-	if fileConfig.DefaultNetwork != "" {
-		if _, exists := multiConfig.GetChain(fileConfig.DefaultNetwork); !exists {
-			return nil, fmt.Errorf("default network %s is not configured", fileConfig.DefaultNetwork)
+	if netConfig.Batch != nil {
+		chainInput.Batch = &config.BatchConfig{
+			Contract: netConfig.Batch.Contract,
+			MaxSize:  netConfig.Batch.MaxSize,
+		}
+		if netConfig.Batch.Window != "" {
+			if chainInput.Batch.Window, err = time.ParseDuration(netConfig.Batch.Window); err != nil {
+				return chainInput, fmt.Errorf("failed to parse batch window for %s: %w", netConfig.Name, err)
+			}
 		}
-		multiConfig.DefaultChain = fileConfig.DefaultNetwork
 	}
 
-	return multiConfig, nil
+	return chainInput, nil
+}
+
+// parseSunset parses a sunset given as a date, which is midnight UTC, or as
+// an RFC 3339 time. An empty sunset is the zero time.
+func parseSunset(sunset string) (time.Time, error) {
+	if sunset == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", sunset); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, sunset)
+}
+
+// parseRateLimits converts the rate limit rules of a configuration file
+func parseRateLimits(limits []RateLimitConfigFile) ([]ratelimit.Rule, error) {
+	var rules []ratelimit.Rule
+	for _, limit := range limits {
+		window, err := ratelimit.ParseWindow(limit.Window)
+		if err != nil {
+			return nil, err
+		}
+		quota, err := limit.Quota.decimal()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, ratelimit.Rule{
+			Key:       ratelimit.KeyType(limit.Key),
+			Limit:     limit.Limit,
+			Quota:     quota,
+			Window:    window,
+			Algorithm: ratelimit.Algorithm(limit.Algorithm),
+			Burst:     limit.Burst,
+		})
+	}
+	return rules, nil
+}
+
+// networkPrivateKey parses the private key or decrypts the keystore of a network
+func networkPrivateKey(netConfig NetworkConfigFile) (*ecdsa.PrivateKey, error) {
+	switch {
+	case netConfig.PrivateKey != "":
+		privateKey, err := parsePrivateKeyHex(netConfig.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key for %s: %w", netConfig.Name, err)
+		}
+		return privateKey, nil
+	case netConfig.Keystore != "":
+		privateKey, err := parseKeystoreFile(netConfig.Keystore, netConfig.KeyPass)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse keystore for %s: %w", netConfig.Name, err)
+		}
+		return privateKey, nil
+	default:
+		return nil, fmt.Errorf("network %s requires either private_key or keystore", netConfig.Name)
+	}
 }
 
 // GenerateMultiChainConfig creates a sample configuration file
@@ -134,21 +549,21 @@ func GenerateMultiChainConfig(outputPath string) error {
 				Name:       "sepolia",
 				Provider:   "",                      // Will use default
 				PrivateKey: "0x1234567890abcdef...", // Replace with actual key
-				Payout:     1.0,
+				Payout:     "1",
 				Interval:   1440,
 			},
 			{
-				Name:       "polygon-mumbai",
+				Name:       "polygon-amoy",
 				Provider:   "",                      // Will use default
 				PrivateKey: "0x1234567890abcdef...", // Replace with actual key
-				Payout:     1.0,
+				Payout:     "1",
 				Interval:   1440,
 			},
 			{
 				Name:       "bsc-testnet",
 				Provider:   "",                      // Will use default
 				PrivateKey: "0x1234567890abcdef...", // Replace with actual key
-				Payout:     0.1,
+				Payout:     "0.1",
 				Interval:   1440,
 			},
 		},
@@ -165,8 +580,8 @@ func GenerateMultiChainConfig(outputPath string) error {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
-	fmt.Printf("Sample multi-chain configuration written to %s\n", outputPath)
-	fmt.Println("\nPlease update the private keys and other settings before using.")
+	fmt.Fprintf(stdout, "Sample multi-chain configuration written to %s\n", outputPath)
+	fmt.Fprintln(stdout, "\nPlease update the private keys and other settings before using.")
 	return nil
 }
 
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+type networkListEntry struct {
+	Network    string `json:"network"`
+	Name       string `json:"name"`
+	ChainID    int64  `json:"chain_id"`
+	Symbol     string `json:"symbol"`
+	IsTestnet  bool   `json:"is_testnet"`
+	DefaultRPC string `json:"default_rpc"`
+	State      string `json:"state"`
+	Sunset     string `json:"sunset,omitempty"`
+}
+
+// networkImportReport lists what a chainlist import adds to the supported networks
+type networkImportReport struct {
+	Added   []networkListEntry `json:"added"`
+	Updated []networkListEntry `json:"updated"`
+	Skipped []string           `json:"skipped"`
+}
+
+func runNetworks(args []string) int {
+	return runSubcommands("networks", args, []command{
+		{name: "list", summary: "List all supported networks", run: runNetworksList},
+		{name: "import", summary: "Show the networks a chainlist file adds", run: runNetworksImport},
+	})
+}
+
+func runNetworksList(args []string) int {
+	fs := newFlagSet("networks list", "[-all] [-json]")
+	all := fs.Bool("all", false, "Also list removed networks")
+	asJSON := fs.Bool("json", false, "Print the networks as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	supported := config.GetSupportedNetworks()
+	entries := make([]networkListEntry, 0, len(supported))
+	for network := range supported {
+		entry := newNetworkListEntry(network)
+		if entry.State == string(config.NetworkRemoved) && !*all {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Network < entries[j].Network
+	})
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entries); err != nil {
+			return fail("%v", err)
+		}
+		return exitOK
+	}
+
+	fmt.Fprintln(stdout, "Supported networks:")
+	fmt.Fprintln(stdout, "==================")
+	for _, entry := range entries {
+		printNetworkListEntry(entry)
+	}
+	return exitOK
+}
+
+// runNetworksImport imports a chainlist file like the chainlist option of
+// the configuration does and reports the networks it adds and updates
+func runNetworksImport(args []string) int {
+	fs := newFlagSet("networks import", "-file chains.json [-chain-ids 1,11155111] [-deprecated] [-json]")
+	file := fs.String("file", "", "Chainlist or ethereum-lists JSON file")
+	chainIDs := fs.String("chain-ids", "", "Comma-separated chain IDs to import, all chains of the file if empty")
+	deprecated := fs.Bool("deprecated", false, "Also add deprecated chains")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if *file == "" {
+		fmt.Fprintln(stderr, "-file is required")
+		fs.Usage()
+		return exitUsage
+	}
+	ids, err := parseChainIDs(*chainIDs)
+	if err != nil {
+		fmt.Fprintf(stderr, "invalid -chain-ids: %v\n", err)
+		fs.Usage()
+		return exitUsage
+	}
+
+	imported, err := importChainlist(ChainlistFile{File: *file, ChainIDs: ids, IncludeDeprecated: *deprecated})
+	if err != nil {
+		return fail("%v", err)
+	}
+	report := networkImportReport{Added: []networkListEntry{}, Updated: []networkListEntry{}, Skipped: imported.Skipped}
+	for _, network := range imported.Added {
+		report.Added = append(report.Added, newNetworkListEntry(network))
+	}
+	for _, network := range imported.Updated {
+		report.Updated = append(report.Updated, newNetworkListEntry(network))
+	}
+	if report.Skipped == nil {
+		report.Skipped = []string{}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fail("%v", err)
+		}
+		return exitOK
+	}
+
+	fmt.Fprintf(stdout, "Added %d networks:\n", len(report.Added))
+	for _, entry := range report.Added {
+		printNetworkListEntry(entry)
+	}
+	fmt.Fprintf(stdout, "Updated %d networks:\n", len(report.Updated))
+	for _, entry := range report.Updated {
+		printNetworkListEntry(entry)
+	}
+	fmt.Fprintf(stdout, "Skipped %d chains:\n", len(report.Skipped))
+	for _, reason := range report.Skipped {
+		fmt.Fprintf(stdout, "  %s\n", reason)
+	}
+	return exitOK
+}
+
+// parseChainIDs parses a comma-separated list of chain IDs
+func parseChainIDs(list string) ([]int64, error) {
+	var ids []int64
+	for _, field := range strings.Split(list, ",") {
+		if field = strings.TrimSpace(field); field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func newNetworkListEntry(network string) networkListEntry {
+	networkConfig, _ := config.GetNetworkByName(network)
+	entry := networkListEntry{
+		Network:    network,
+		Name:       networkConfig.Name,
+		ChainID:    networkConfig.ChainID,
+		Symbol:     networkConfig.Symbol,
+		IsTestnet:  networkConfig.IsTestnet,
+		DefaultRPC: networkConfig.DefaultRPC,
+		State:      string(networkConfig.StateAt(time.Now())),
+	}
+	if !networkConfig.Sunset.IsZero() {
+		entry.Sunset = networkConfig.Sunset.Format("2006-01-02")
+	}
+	return entry
+}
+
+func printNetworkListEntry(entry networkListEntry) {
+	flags := ""
+	if entry.IsTestnet {
+		flags += " (Testnet)"
+	}
+	switch {
+	case entry.Sunset != "":
+		flags += fmt.Sprintf(" (%s, sunset %s)", strings.ToUpper(entry.State[:1])+entry.State[1:], entry.Sunset)
+	case entry.State != string(config.NetworkActive):
+		flags += fmt.Sprintf(" (%s)", strings.ToUpper(entry.State[:1])+entry.State[1:])
+	}
+	fmt.Fprintf(stdout, "  %-20s - %s%s (Chain ID: %d, Symbol: %s)\n",
+		entry.Network, entry.Name, flags, entry.ChainID, entry.Symbol)
+}
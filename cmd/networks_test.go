@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+// testChainlist mixes the formats of ethereum-lists, with RPCs as strings,
+// and chainlist.org, with RPCs as objects
+const testChainlist = `[
+	{
+		"name": "Faucet Testnet",
+		"chainId": 990001,
+		"nativeCurrency": {"name": "Faucet Ether", "symbol": "FETH", "decimals": 18},
+		"rpc": ["https://mainnet.infura.io/v3/${INFURA_API_KEY}", "wss://ws.faucet.test", "https://rpc.faucet.test"],
+		"explorers": [{"name": "scan", "url": "https://scan.faucet.test/", "standard": "none"}, {"name": "blockscout", "url": "https://blockscout.faucet.test", "standard": "EIP3091"}],
+		"slip44": 1
+	},
+	{
+		"name": "Old Faucet Testnet",
+		"chainId": 990002,
+		"nativeCurrency": {"name": "Old Ether", "symbol": "OETH", "decimals": 18},
+		"rpc": [{"url": "https://rpc.old.faucet.test", "tracking": "none"}],
+		"status": "deprecated",
+		"isTestnet": true
+	},
+	{
+		"name": "Ethereum Holesky",
+		"chainId": 17000,
+		"nativeCurrency": {"name": "Testnet ETH", "symbol": "ETH", "decimals": 18},
+		"rpc": [{"url": "https://rpc.holesky.test"}],
+		"isTestnet": true
+	}
+]`
+
+func TestNetworksImport(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "chains.json")
+	if err := os.WriteFile(file, []byte(testChainlist), 0600); err != nil {
+		t.Fatal(err)
+	}
+	holesky, _ := config.GetNetworkByName("holesky")
+
+	out, _ := captureOutput(t)
+	if code := run([]string{"networks", "import", "-file", file, "-json"}); code != exitOK {
+		t.Fatalf("networks import = %d", code)
+	}
+	var report networkImportReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 1 || report.Added[0].Network != "faucet-testnet" || !report.Added[0].IsTestnet ||
+		report.Added[0].DefaultRPC != "https://rpc.faucet.test" {
+		t.Errorf("unexpected added networks %+v", report.Added)
+	}
+	if len(report.Updated) != 1 || report.Updated[0].Network != "holesky" || len(report.Skipped) != 1 {
+		t.Errorf("unexpected updated networks %+v, skipped %v", report.Updated, report.Skipped)
+	}
+
+	added, _ := config.GetNetworkByName("faucet-testnet")
+	if added.ExplorerTxURL != "https://blockscout.faucet.test/tx/{hash}" || added.CurrencyName != "Faucet Ether" {
+		t.Errorf("unexpected metadata %+v", added.NetworkMetadata)
+	}
+	// Built-in networks keep their own settings
+	if updated, _ := config.GetNetworkByName("holesky"); updated.DefaultRPC != holesky.DefaultRPC || updated.CurrencyName != holesky.CurrencyName {
+		t.Errorf("holesky changed from %+v to %+v", holesky, updated)
+	}
+
+	// Importing the same chainlist again changes nothing
+	out.Reset()
+	if code := run([]string{"networks", "import", "-file", file, "-json"}); code != exitOK {
+		t.Fatalf("networks import again = %d", code)
+	}
+	report = networkImportReport{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 0 || len(report.Updated) != 0 {
+		t.Errorf("import again added %+v, updated %+v, want nothing", report.Added, report.Updated)
+	}
+
+	if code := run([]string{"networks", "import", "-file", file, "-chain-ids", "990002", "-deprecated"}); code != exitOK {
+		t.Fatalf("networks import -deprecated = %d", code)
+	}
+	if old, exists := config.GetNetworkByName("old-faucet-testnet"); !exists || old.State != config.NetworkDeprecated {
+		t.Errorf("expected a deprecated network, got %+v", old)
+	}
+
+	if code := run([]string{"networks", "import", "-chain-ids", "x"}); code != exitUsage {
+		t.Errorf("networks import without -file = %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var appVersion = "v1.2.0"
+
+// Exit codes shared by all subcommands
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// Output of the subcommands, replaced in tests
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+var commands = []command{
+	{name: "serve", summary: "Run the faucet server in single-chain or multi-chain mode", run: runServe},
+	{name: "send", summary: "Send a one-off transfer from the faucet account", run: runSend},
+	{name: "balance", summary: "Show the faucet account balance on every configured network", run: runBalance},
+	{name: "keys", summary: "Create, import and list keystore files", run: runKeys},
+	{name: "config", summary: "Generate or validate a multi-chain configuration file", run: runConfig},
+	{name: "networks", summary: "List supported networks and import chainlist files", run: runNetworks},
+	{name: "version", summary: "Print the version number", run: runVersion},
+}
+
+// Execute runs the subcommand named by the command line and exits with its
+// exit code. Without a subcommand the legacy flags of serve are accepted.
+func Execute() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 {
+		return runServe(args)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		printUsage(stdout)
+		return exitOK
+	}
+	if strings.HasPrefix(args[0], "-") {
+		return runServe(args)
+	}
+
+	for _, c := range commands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+	printUsage(stderr)
+	return exitUsage
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: multi-chain-faucet <command> [flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(w, "\nRun 'multi-chain-faucet <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a subcommand
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: multi-chain-faucet %s %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args and returns false together with the exit code when
+// the command should stop, e.g. after printing its help
+func parseFlags(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// runSubcommands dispatches to one of the nested commands, e.g. keys new
+func runSubcommands(name string, args []string, subcommands []command) int {
+	usage := func(w io.Writer) {
+		fmt.Fprintf(w, "Usage: multi-chain-faucet %s <command> [flags]\n\nCommands:\n", name)
+		for _, c := range subcommands {
+			fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+		}
+	}
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(stdout)
+		return exitOK
+	}
+	for _, c := range subcommands {
+		if c.name == args[0] {
+			return c.run(args[1:])
+		}
+	}
+	fmt.Fprintf(stderr, "unknown command %q\n\n", name+" "+args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+// fail reports an error and returns the failure exit code
+func fail(format string, a ...interface{}) int {
+	fmt.Fprintf(stderr, "Error: "+format+"\n", a...)
+	return exitFailure
+}
+
+func runVersion(args []string) int {
+	fs := newFlagSet("version", "")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	fmt.Fprintln(stdout, appVersion)
+	return exitOK
+}
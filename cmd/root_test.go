@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func captureOutput(t *testing.T) (*bytes.Buffer, *bytes.Buffer) {
+	var out, errOut bytes.Buffer
+	stdout, stderr = &out, &errOut
+	t.Cleanup(func() {
+		stdout, stderr = os.Stdout, os.Stderr
+	})
+	return &out, &errOut
+}
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	keyDir := filepath.Join(dir, "keystore")
+	privateKey := "976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8"
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantCode   int
+		wantOutput string
+	}{
+		{name: "help", args: []string{"help"}, wantCode: exitOK, wantOutput: "Commands:"},
+		{name: "unknown command", args: []string{"bogus"}, wantCode: exitUsage},
+		{name: "unknown flag", args: []string{"networks", "list", "-bogus"}, wantCode: exitUsage},
+		{name: "version", args: []string{"version"}, wantCode: exitOK, wantOutput: appVersion},
+		{name: "legacy version flag", args: []string{"-version"}, wantCode: exitOK, wantOutput: appVersion},
+		{name: "networks list json", args: []string{"networks", "list", "--json"}, wantCode: exitOK, wantOutput: `"network": "sepolia"`},
+		{name: "missing subcommand", args: []string{"keys"}, wantCode: exitUsage},
+		{name: "keys import", args: []string{"keys", "import", "-light", "-dir", keyDir, "-password", passwordFile, "-privkey", privateKey}, wantCode: exitOK, wantOutput: "0x7EF5A6135f1FD6a02593eEdC869c6D41D934aef8"},
+		{name: "keys list", args: []string{"keys", "list", "-dir", keyDir}, wantCode: exitOK, wantOutput: "0x7EF5A6135f1FD6a02593eEdC869c6D41D934aef8"},
+		{name: "keys import without key", args: []string{"keys", "import", "-dir", keyDir, "-password", passwordFile, "-privkey", ""}, wantCode: exitUsage},
+		{name: "send invalid address", args: []string{"send", "-to", "0x1234", "-amount", "1"}, wantCode: exitUsage},
+		{name: "config validate missing file", args: []string{"config", "validate", "-config", filepath.Join(dir, "missing.json")}, wantCode: exitFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _ := captureOutput(t)
+			if code := run(tt.args); code != tt.wantCode {
+				t.Fatalf("run(%v) = %d, want %d", tt.args, code, tt.wantCode)
+			}
+			if !strings.Contains(out.String(), tt.wantOutput) {
+				t.Errorf("run(%v) output = %q, want it to contain %q", tt.args, out.String(), tt.wantOutput)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+func runSend(args []string) int {
+	fs := newFlagSet("send", "-to 0x... -amount 0.1 [-config multichain-config.json] [-network sepolia] [flags]")
+	configPath := fs.String("config", "", "Take the account and provider of -network from this multi-chain configuration file")
+	network := fs.String("network", "", "Network to send on, defaults to the default network of -config")
+	to := fs.String("to", "", "Recipient address")
+	amount := fs.String("amount", "", "Amount to send in native units, e.g. 0.1 Ether")
+	wait := fs.Bool("wait", false, "Wait until the transaction is mined")
+	timeout := fs.Duration("timeout", 5*time.Minute, "How long to wait for the transaction")
+	wallet := addWalletFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	if !chain.IsValidAddress(*to, false) {
+		fmt.Fprintf(stderr, "invalid recipient address %q\n", *to)
+		fs.Usage()
+		return exitUsage
+	}
+	value, err := decimal.NewFromString(*amount)
+	if err != nil || !value.IsPositive() {
+		fmt.Fprintln(stderr, "-amount must be positive")
+		fs.Usage()
+		return exitUsage
+	}
+
+	var (
+		provider   string
+		privateKey *ecdsa.PrivateKey
+		chainID    *big.Int
+		decimals   = chain.DefaultDecimals
+		gas        chain.GasStrategy
+	)
+	if *configPath != "" {
+		multiConfig, err := loadMultiChainConfig(*configPath)
+		if err != nil {
+			return fail("failed to load multi-chain config: %v", err)
+		}
+		if *network == "" {
+			*network = multiConfig.DefaultChain
+		}
+		chainInstance, exists := multiConfig.GetChain(*network)
+		if !exists {
+			return fail("network %s is not configured in %s", *network, *configPath)
+		}
+		provider, privateKey = chainInstance.Provider, chainInstance.PrivateKey
+		decimals = chainInstance.Config.Decimals
+		gas = chain.NewGasStrategy(chainInstance.Gas)
+	} else {
+		if privateKey, err = wallet.privateKey(); err != nil {
+			return fail("failed to read private key: %v", err)
+		}
+		provider = *wallet.provider
+		if networkConfig, exists := config.GetNetworkByName(*network); exists {
+			chainID = big.NewInt(networkConfig.ChainID)
+			if networkConfig.Decimals > 0 {
+				decimals = networkConfig.Decimals
+			}
+			gas = chain.NewGasStrategy(chain.GasConfig{Strategy: networkConfig.GasStrategy, OPStack: networkConfig.OPStack})
+			if provider == "" {
+				provider = networkConfig.DefaultRPC
+			}
+		}
+		if provider == "" {
+			return fail("web3 provider is required. Set via -wallet.provider flag, WEB3_PROVIDER environment variable or -config")
+		}
+	}
+
+	txBuilder, err := chain.NewTxBuilder(provider, privateKey, chainID, gas, nil)
+	if err != nil {
+		return fail("cannot connect to web3 provider: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	wei, err := chain.ToBaseUnits(value, decimals)
+	if err != nil {
+		return fail("invalid -amount: %v", err)
+	}
+	txHash, err := txBuilder.Transfer(ctx, *to, wei)
+	if errors.Is(err, chain.ErrBroadcastUnknown) {
+		return fail("%v, look up %s before sending again", err, txHash.Hex())
+	}
+	if err != nil {
+		return fail("failed to send transaction: %v", err)
+	}
+	fmt.Fprintf(stdout, "Txhash: %s\n", txHash.Hex())
+
+	if *wait {
+		if err := waitMined(ctx, txBuilder, txHash); err != nil {
+			return fail("%v", err)
+		}
+	}
+	return exitOK
+}
+
+// waitMined waits until the transaction is mined and reports its block
+func waitMined(ctx context.Context, txBuilder chain.TxBuilder, txHash common.Hash) error {
+	watcher, ok := txBuilder.(chain.TxWatcher)
+	if !ok {
+		return errors.New("cannot watch transactions on this network")
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+	for {
+		status, err := watcher.TxStatus(ctx, txHash)
+		if err != nil {
+			return fmt.Errorf("failed to get transaction status: %w", err)
+		}
+		if status.Mined {
+			if !status.Successful {
+				return fmt.Errorf("transaction reverted in block %d", status.BlockNumber)
+			}
+			fmt.Fprintf(stdout, "Mined in block %d\n", status.BlockNumber)
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("transaction was not mined in time: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
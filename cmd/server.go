@@ -5,178 +5,205 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"math/big"
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
 
 	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
 	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
 	"github.com/guyuxiang/multi-chain-faucet/internal/server"
+	"github.com/guyuxiang/multi-chain-faucet/internal/telemetry"
 )
 
-var (
-	appVersion = "v1.2.0"
+// walletFlags select the account that funds transfers
+type walletFlags struct {
+	keyJSON  *string
+	keyPass  *string
+	privKey  *string
+	provider *string
+}
 
-	// Legacy chainIDMap for backward compatibility
-	chainIDMap = make(map[string]int)
+func addWalletFlags(fs *flag.FlagSet) *walletFlags {
+	return &walletFlags{
+		keyJSON:  fs.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with"),
+		keyPass:  fs.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore"),
+		privKey:  fs.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with"),
+		provider: fs.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Ethereum JSON-RPC connection"),
+	}
+}
 
-	httpPortFlag       = flag.Int("httpport", 8080, "Listener port to serve HTTP connection")
-	proxyCntFlag       = flag.Int("proxycount", 0, "Count of reverse proxies in front of the server")
-	versionFlag        = flag.Bool("version", false, "Print version number")
-	listNetworksFlag   = flag.Bool("list-networks", false, "List all supported networks and exit")
-	multiChainFlag     = flag.String("multichain", "", "Path to multi-chain configuration file")
-	generateConfigFlag = flag.Bool("generate-config", false, "Generate sample multi-chain configuration file")
+func (f *walletFlags) privateKey() (*ecdsa.PrivateKey, error) {
+	if *f.privKey != "" {
+		hexkey := *f.privKey
+		if chain.Has0xPrefix(hexkey) {
+			hexkey = hexkey[2:]
+		}
+		return crypto.HexToECDSA(hexkey)
+	} else if *f.keyJSON == "" {
+		return nil, errors.New("missing private key or keystore")
+	}
 
-	payoutFlag   = flag.Float64("faucet.amount", 1, "Number of Ethers to transfer per user request")
-	intervalFlag = flag.Int("faucet.minutes", 1440, "Number of minutes to wait between funding rounds")
-	netnameFlag  = flag.String("faucet.name", "testnet", "Network name to display on the frontend")
-	symbolFlag   = flag.String("faucet.symbol", "ETH", "Token symbol to display on the frontend")
+	keyfile, err := chain.ResolveKeyfilePath(*f.keyJSON)
+	if err != nil {
+		return nil, err
+	}
+	password, err := os.ReadFile(*f.keyPass)
+	if err != nil {
+		return nil, err
+	}
 
-	keyJSONFlag  = flag.String("wallet.keyjson", os.Getenv("KEYSTORE"), "Keystore file to fund user requests with")
-	keyPassFlag  = flag.String("wallet.keypass", "password.txt", "Passphrase text file to decrypt keystore")
-	privKeyFlag  = flag.String("wallet.privkey", os.Getenv("PRIVATE_KEY"), "Private key hex to fund user requests with")
-	providerFlag = flag.String("wallet.provider", os.Getenv("WEB3_PROVIDER"), "Endpoint for Ethereum JSON-RPC connection")
+	return chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+}
 
-	hcaptchaSiteKeyFlag = flag.String("hcaptcha.sitekey", os.Getenv("HCAPTCHA_SITEKEY"), "hCaptcha sitekey")
-	hcaptchaSecretFlag  = flag.String("hcaptcha.secret", os.Getenv("HCAPTCHA_SECRET"), "hCaptcha secret")
-)
+// singleChainFlags configure the faucet when it serves a single network
+type singleChainFlags struct {
+	httpPort        *int
+	proxyCount      *int
+	payout          *string
+	decimals        *int
+	interval        *int
+	netname         *string
+	symbol          *string
+	hcaptchaSiteKey *string
+	hcaptchaSecret  *string
+	tracing         *string
+	tracingEndpoint *string
+	wallet          *walletFlags
+}
 
-// ListSupportedNetworks prints all supported networks (useful for CLI help)
-func ListSupportedNetworks() {
-	fmt.Println("Supported networks:")
-	fmt.Println("==================")
-
-	categories := map[string][]string{
-		"Ethereum":  {"mainnet", "sepolia", "holesky", "goerli"},
-		"Polygon":   {"polygon", "polygon-mumbai", "polygon-amoy"},
-		"BSC":       {"bsc", "bsc-testnet"},
-		"Arbitrum":  {"arbitrum", "arbitrum-sepolia"},
-		"Optimism":  {"optimism", "optimism-sepolia"},
-		"Avalanche": {"avalanche", "avalanche-fuji"},
-		"Base":      {"base", "base-sepolia"},
-		"Fantom":    {"fantom", "fantom-testnet"},
-		"Linea":     {"linea", "linea-sepolia"},
-		"zkSync":    {"zksync", "zksync-sepolia"},
-	}
-
-	for category, networks := range categories {
-		fmt.Printf("\n%s:\n", category)
-		for _, networkName := range networks {
-			if networkConfig, exists := config.GetNetworkByName(networkName); exists {
-				testnetStr := ""
-				if networkConfig.IsTestnet {
-					testnetStr = " (Testnet)"
-				}
-				fmt.Printf("  %-20s - %s%s (Chain ID: %d, Symbol: %s)\n",
-					networkName, networkConfig.Name, testnetStr, networkConfig.ChainID, networkConfig.Symbol)
-			}
-		}
+// addSingleChainFlags defines the flags of serve without a configuration file
+func addSingleChainFlags(fs *flag.FlagSet) singleChainFlags {
+	return singleChainFlags{
+		httpPort:        fs.Int("httpport", 8080, "Listener port to serve HTTP connection"),
+		proxyCount:      fs.Int("proxycount", 0, "Count of reverse proxies in front of the server"),
+		payout:          fs.String("faucet.amount", "1", "Number of Ethers to transfer per user request"),
+		decimals:        fs.Int("faucet.decimals", 0, "Decimals of the native asset, 0 uses the network default of 18"),
+		interval:        fs.Int("faucet.minutes", 1440, "Number of minutes to wait between funding rounds"),
+		netname:         fs.String("faucet.name", "testnet", "Network name to display on the frontend"),
+		symbol:          fs.String("faucet.symbol", "ETH", "Token symbol to display on the frontend"),
+		hcaptchaSiteKey: fs.String("hcaptcha.sitekey", os.Getenv("HCAPTCHA_SITEKEY"), "hCaptcha sitekey"),
+		hcaptchaSecret:  fs.String("hcaptcha.secret", os.Getenv("HCAPTCHA_SECRET"), "hCaptcha secret"),
+		tracing:         fs.String("tracing.exporter", telemetry.ExporterNone, "OpenTelemetry span exporter: none, otlp or stdout"),
+		tracingEndpoint: fs.String("tracing.endpoint", "", "OTLP/HTTP collector host:port, defaults to OTEL_EXPORTER_OTLP_ENDPOINT"),
+		wallet:          addWalletFlags(fs),
 	}
 }
 
-func init() {
-	// Initialize legacy chainIDMap for backward compatibility
-	chainIDMap = config.GetChainIDMap()
+func runServe(args []string) int {
+	fs := newFlagSet("serve", "[-config multichain-config.json] [flags]")
+	configPath := fs.String("config", "", "Path to multi-chain configuration file (JSON, YAML or TOML)")
+	multiChainPath := fs.String("multichain", "", "Path to multi-chain configuration file (deprecated, use -config)")
+	single := addSingleChainFlags(fs)
+
+	// Flags from before subcommands existed
+	versionFlag := fs.Bool("version", false, "Print version number (deprecated, use the version command)")
+	listNetworksFlag := fs.Bool("list-networks", false, "List all supported networks and exit (deprecated, use networks list)")
+	generateConfigFlag := fs.Bool("generate-config", false, "Generate sample multi-chain configuration file (deprecated, use config generate)")
 
-	flag.Parse()
-	if *versionFlag {
-		fmt.Println(appVersion)
-		os.Exit(0)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
 	}
-	if *listNetworksFlag {
-		ListSupportedNetworks()
-		os.Exit(0)
+	switch {
+	case *versionFlag:
+		return runVersion(nil)
+	case *listNetworksFlag:
+		return runNetworks([]string{"list"})
+	case *generateConfigFlag:
+		return runConfig([]string{"generate"})
 	}
-	if *generateConfigFlag {
-		if err := GenerateMultiChainConfig("multichain-config.json"); err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating config: %v\n", err)
-			os.Exit(1)
+
+	var srv *server.MultiChainServer
+	var err error
+	if path := *configPath; path != "" || *multiChainPath != "" || hasEnvNetworks() {
+		if path == "" {
+			path = *multiChainPath
 		}
-		os.Exit(0)
+		srv, err = serveMultiChain(path)
+	} else {
+		srv, err = serveSingleChain(single)
 	}
-	if *multiChainFlag != "" {
-		ExecuteMultiChain(*multiChainFlag)
-		return
+	if err != nil {
+		return fail("%v", err)
 	}
+
+	c := make(chan os.Signal, 1)
+	// docker stop sends SIGTERM
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	<-c
+	srv.Close()
+	return exitOK
 }
 
-func Execute() {
-	privateKey, err := getPrivateKeyFromFlags()
+// serveSingleChain starts the faucet server for the network given by the flags
+func serveSingleChain(f singleChainFlags) (*server.MultiChainServer, error) {
+	multiConfig, err := singleChainConfig(f)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key: %w", err))
+		return nil, err
 	}
 
-	// Get network configuration
-	networkName := strings.ToLower(*netnameFlag)
-	networkConfig, exists := config.GetNetworkByName(networkName)
-
-	var chainID *big.Int
-	var symbol string
-	var displayName string
-
-	if exists {
-		chainID = big.NewInt(networkConfig.ChainID)
-		// Use network default symbol if not explicitly set via flag
-		if *symbolFlag == "ETH" { // Check if using default symbol
-			symbol = networkConfig.Symbol
-		} else {
-			symbol = *symbolFlag
-		}
-		displayName = networkConfig.Name
-
-		// Use default RPC if provider not set
-		if *providerFlag == "" {
-			*providerFlag = networkConfig.DefaultRPC
-		}
-	} else {
-		// Fallback to legacy behavior
-		if value, ok := chainIDMap[networkName]; ok {
-			chainID = big.NewInt(int64(value))
-		}
-		symbol = *symbolFlag
-		displayName = *netnameFlag
+	server, err := server.NewMultiChainServer(multiConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to web3 provider: %w", err)
 	}
 
-	// Validate provider is set
-	if *providerFlag == "" {
-		panic(fmt.Errorf("web3 provider is required. Set via -wallet.provider flag or WEB3_PROVIDER environment variable"))
-	}
+	go server.Run()
+	return server, nil
+}
 
-	txBuilder, err := chain.NewTxBuilder(*providerFlag, privateKey, chainID)
+// singleChainConfig builds a configuration with the one network given by the
+// flags. Networks that are not built in are served under the name of the flag
+// with the chain ID reported by the provider.
+func singleChainConfig(f singleChainFlags) (*config.MultiChainConfig, error) {
+	privateKey, err := f.wallet.privateKey()
 	if err != nil {
-		panic(fmt.Errorf("cannot connect to web3 provider: %w", err))
+		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
 
-	config := server.NewConfig(displayName, symbol, *httpPortFlag, *intervalFlag, *proxyCntFlag, *payoutFlag, *hcaptchaSiteKeyFlag, *hcaptchaSecretFlag)
-	go server.NewServer(txBuilder, config).Run()
+	networkName := strings.ToLower(*f.netname)
+	networkConfig, exists := config.GetNetworkByName(networkName)
+	if !exists {
+		networkConfig = config.NetworkConfig{Name: *f.netname, Symbol: *f.symbol, IsTestnet: true}
+	} else if *f.symbol != "ETH" {
+		// Keep the network's own symbol unless the flag sets another one
+		networkConfig.Symbol = *f.symbol
+	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
-}
+	if *f.wallet.provider == "" && networkConfig.DefaultRPC == "" {
+		return nil, errors.New("web3 provider is required. Set via -wallet.provider flag or WEB3_PROVIDER environment variable")
+	}
 
-func getPrivateKeyFromFlags() (*ecdsa.PrivateKey, error) {
-	if *privKeyFlag != "" {
-		hexkey := *privKeyFlag
-		if chain.Has0xPrefix(hexkey) {
-			hexkey = hexkey[2:]
-		}
-		return crypto.HexToECDSA(hexkey)
-	} else if *keyJSONFlag == "" {
-		return nil, errors.New("missing private key or keystore")
+	// A zero interval turns rate limiting off
+	var rateLimits []ratelimit.Rule
+	if *f.interval <= 0 {
+		rateLimits = []ratelimit.Rule{}
 	}
 
-	keyfile, err := chain.ResolveKeyfilePath(*keyJSONFlag)
+	payout, err := decimal.NewFromString(*f.payout)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("invalid -faucet.amount %q", *f.payout)
 	}
-	password, err := os.ReadFile(*keyPassFlag)
-	if err != nil {
+
+	multiConfig := config.NewMultiChainConfig()
+	multiConfig.HTTPPort = *f.httpPort
+	multiConfig.ProxyCount = *f.proxyCount
+	multiConfig.HcaptchaSiteKey = *f.hcaptchaSiteKey
+	multiConfig.HcaptchaSecret = *f.hcaptchaSecret
+	multiConfig.Tracing = telemetry.Config{Exporter: *f.tracing, Endpoint: *f.tracingEndpoint}
+	if err := multiConfig.AddChainWithKey(config.ChainConfigInput{
+		Network:    networkName,
+		Provider:   *f.wallet.provider,
+		Payout:     payout,
+		Decimals:   *f.decimals,
+		Interval:   *f.interval,
+		RateLimits: rateLimits,
+		Custom:     &networkConfig,
+	}, privateKey); err != nil {
 		return nil, err
 	}
-
-	return chain.DecryptKeyfile(keyfile, strings.TrimRight(string(password), "\r\n"))
+	return multiConfig, nil
 }
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"testing"
+)
+
+func TestSingleChainConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		wantNetwork string
+		wantName    string
+		wantSymbol  string
+		wantChainID int64
+		wantRules   int
+		wantErr     bool
+	}{
+		{
+			name:        "built-in network",
+			args:        []string{"-faucet.name", "Sepolia"},
+			wantNetwork: "sepolia",
+			wantName:    "Ethereum Sepolia",
+			wantSymbol:  "ETH",
+			wantChainID: 11155111,
+			wantRules:   2,
+		},
+		{
+			name:        "symbol flag overrides network symbol",
+			args:        []string{"-faucet.name", "polygon-amoy", "-faucet.symbol", "MATIC"},
+			wantNetwork: "polygon-amoy",
+			wantName:    "Polygon Amoy",
+			wantSymbol:  "MATIC",
+			wantChainID: 80002,
+			wantRules:   2,
+		},
+		{
+			name:        "custom network",
+			args:        []string{"-wallet.provider", "http://127.0.0.1:8545", "-faucet.symbol", "TST", "-faucet.minutes", "0"},
+			wantNetwork: "testnet",
+			wantName:    "testnet",
+			wantSymbol:  "TST",
+			wantRules:   0,
+		},
+		{
+			name:    "custom network without provider",
+			args:    []string{"-faucet.name", "devnet"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newFlagSet("serve", "")
+			flags := addSingleChainFlags(fs)
+			args := append([]string{"-wallet.privkey", testPrivateKey, "-wallet.provider", ""}, tt.args...)
+			if err := fs.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+
+			multiConfig, err := singleChainConfig(flags)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if multiConfig.DefaultChain != tt.wantNetwork || len(multiConfig.Chains) != 1 {
+				t.Fatalf("unexpected networks %v, default %s", multiConfig.GetChainNetworks(), multiConfig.DefaultChain)
+			}
+			chainInstance, _ := multiConfig.GetChain(tt.wantNetwork)
+			if chainInstance.Config.Name != tt.wantName || chainInstance.Config.Symbol != tt.wantSymbol || chainInstance.Config.ChainID != tt.wantChainID {
+				t.Errorf("unexpected network config %+v", chainInstance.Config)
+			}
+			if len(chainInstance.RateLimits) != tt.wantRules {
+				t.Errorf("expected %d rate limit rules, got %v", tt.wantRules, chainInstance.RateLimits)
+			}
+		})
+	}
+}
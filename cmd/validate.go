@@ -0,0 +1,369 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/shopspring/decimal"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+// check is the outcome of a single validation step
+type check struct {
+	Name    string      `json:"name"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message,omitempty"`
+}
+
+type networkReport struct {
+	Network string  `json:"network"`
+	Checks  []check `json:"checks"`
+}
+
+// validationReport lists the checks of the whole file and of every network
+type validationReport struct {
+	Config   string          `json:"config"`
+	Valid    bool            `json:"valid"`
+	Checks   []check         `json:"checks"`
+	Networks []networkReport `json:"networks"`
+}
+
+// lowBalancePayouts is the number of payouts below which a balance is reported as low
+const lowBalancePayouts = 10
+
+func runConfigValidate(args []string) int {
+	fs := newFlagSet("config validate", "[-config multichain-config.json] [-online] [-json]")
+	configPath := fs.String("config", "multichain-config.json", "Path to multi-chain configuration file, empty to use the environment only")
+	online := fs.Bool("online", false, "Connect to every provider to check chain ID, balance, EIP-1559 support and gas price")
+	asJSON := fs.Bool("json", false, "Print the report as JSON")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each provider when -online is set")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+
+	report := validateConfig(*configPath, *online, *timeout)
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fail("%v", err)
+		}
+	} else {
+		report.print(stdout)
+	}
+
+	if !report.Valid {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// validateConfig checks a configuration file without stopping at the first problem
+func validateConfig(configPath string, online bool, timeout time.Duration) *validationReport {
+	report := &validationReport{Config: configPath, Checks: []check{}, Networks: []networkReport{}}
+	defer func() {
+		report.Valid = report.failures() == 0
+	}()
+
+	fileConfig, schemaChecks := checkSchema(configPath)
+	report.Checks = append(report.Checks, schemaChecks...)
+	if fileConfig == nil {
+		return report
+	}
+
+	report.Checks = append(report.Checks, checkHTTPPort(fileConfig.HTTPPort))
+	if fileConfig.Chainlist != nil {
+		report.Checks = append(report.Checks, checkChainlist(*fileConfig.Chainlist))
+	}
+	if len(fileConfig.Networks) == 0 {
+		report.Checks = append(report.Checks, check{Name: "networks", Status: checkFail, Message: "no networks configured"})
+		return report
+	}
+
+	configured := make(map[string]bool)
+	for _, netConfig := range fileConfig.Networks {
+		networkReport := validateNetwork(netConfig, configured[netConfig.Name], online, timeout)
+		configured[netConfig.Name] = true
+		report.Networks = append(report.Networks, networkReport)
+	}
+
+	defaultCheck := check{Name: "default_network", Status: checkOK, Message: fileConfig.DefaultNetwork}
+	switch {
+	case fileConfig.DefaultNetwork == "":
+		defaultCheck.Message = fmt.Sprintf("not set, using %s", fileConfig.Networks[0].Name)
+	case !configured[fileConfig.DefaultNetwork]:
+		defaultCheck.Status = checkFail
+		defaultCheck.Message = fmt.Sprintf("default network %s is not configured", fileConfig.DefaultNetwork)
+	}
+	report.Checks = append(report.Checks, defaultCheck, checkNameService(fileConfig), checkTracing(fileConfig), checkAudit(fileConfig))
+
+	return report
+}
+
+// checkSchema parses the file strictly and applies the environment
+// overrides. Unknown fields are only a warning because the server ignores them.
+func checkSchema(configPath string) (*MultiChainConfigFile, []check) {
+	result := check{Name: "schema", Status: checkOK, Message: configFormat(configPath)}
+	fileConfig, err := parseMultiChainConfigFile(configPath)
+	if err != nil {
+		result.Status = checkFail
+		result.Message = err.Error()
+		return nil, []check{result}
+	}
+
+	if configPath == "" {
+		result.Message = "no file, configured from the environment"
+	} else {
+		data, _ := os.ReadFile(configPath)
+		if err := decodeConfigFile(configPath, data, &MultiChainConfigFile{}, true); err != nil {
+			result.Status = checkWarn
+			result.Message = fmt.Sprintf("unknown fields are ignored: %v", err)
+		}
+	}
+
+	env := check{Name: "environment", Status: checkOK}
+	applied, err := applyEnvOverrides(fileConfig, os.Environ())
+	if err != nil {
+		env.Status = checkFail
+		env.Message = err.Error()
+		return nil, []check{result, env}
+	}
+	env.Message = fmt.Sprintf("%d overrides applied", applied)
+	return fileConfig, []check{result, env}
+}
+
+// checkChainlist imports the chainlist of the configuration, so that the
+// networks are checked against it
+func checkChainlist(c ChainlistFile) check {
+	imported, err := importChainlist(c)
+	if err != nil {
+		return check{Name: "chainlist", Status: checkFail, Message: err.Error()}
+	}
+	return check{Name: "chainlist", Status: checkOK, Message: fmt.Sprintf("%d networks added, %d updated, %d skipped",
+		len(imported.Added), len(imported.Updated), len(imported.Skipped))}
+}
+
+// checkNameService checks that the name service has a provider and a registry
+func checkNameService(fileConfig *MultiChainConfigFile) check {
+	result := check{Name: "name_service", Status: checkOK, Message: "not set, claims need an address"}
+	if fileConfig.NameService == nil || fileConfig.NameService.Network == "" {
+		return result
+	}
+
+	multiConfig := newMultiChainConfig(fileConfig)
+	for _, netConfig := range fileConfig.Networks {
+		if netConfig.Name == multiConfig.NameService.Network && netConfig.Provider != "" {
+			multiConfig.Chains[netConfig.Name] = &config.ChainInstance{Provider: netConfig.Provider}
+		}
+	}
+	_, registry, err := multiConfig.NameServiceEndpoint()
+	if err != nil {
+		result.Status = checkFail
+		result.Message = err.Error()
+		return result
+	}
+	result.Message = fmt.Sprintf("names resolved on %s with registry %s", multiConfig.NameService.Network, registry.Hex())
+	return result
+}
+
+// checkTracing checks the exporter and sample ratio of tracing
+func checkTracing(fileConfig *MultiChainConfigFile) check {
+	tracing := newMultiChainConfig(fileConfig).Tracing
+	if err := tracing.Validate(); err != nil {
+		return check{Name: "tracing", Status: checkFail, Message: err.Error()}
+	}
+	if !tracing.Enabled() {
+		return check{Name: "tracing", Status: checkOK, Message: "not set, spans are dropped"}
+	}
+	return check{Name: "tracing", Status: checkOK, Message: fmt.Sprintf("spans exported to %s", tracing.Exporter)}
+}
+
+// checkAudit checks the rotation settings and the directory of the audit log
+func checkAudit(fileConfig *MultiChainConfigFile) check {
+	auditConfig := newMultiChainConfig(fileConfig).Audit
+	switch {
+	case auditConfig.Output == "":
+		return check{Name: "audit", Status: checkOK, Message: "not set, claims are not audited"}
+	case auditConfig.Output == audit.OutputStdout:
+		return check{Name: "audit", Status: checkOK, Message: "claims audited to stdout"}
+	case auditConfig.MaxSizeMB < 0 || auditConfig.MaxBackups < 0 || auditConfig.MaxAgeDays < 0:
+		return check{Name: "audit", Status: checkFail, Message: "rotation settings must not be negative"}
+	}
+	if info, err := os.Stat(filepath.Dir(auditConfig.Output)); err != nil || !info.IsDir() {
+		return check{Name: "audit", Status: checkFail, Message: fmt.Sprintf("directory of %s does not exist", auditConfig.Output)}
+	}
+	return check{Name: "audit", Status: checkOK, Message: "claims audited to " + auditConfig.Output}
+}
+
+func checkHTTPPort(port int) check {
+	result := check{Name: "http_port", Status: checkOK, Message: fmt.Sprint(port)}
+	switch {
+	case port < 0 || port > 65535:
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%d is not a valid port", port)
+	case port == 0:
+		result.Status = checkWarn
+		result.Message = "not set, the server listens on a random port"
+	}
+	return result
+}
+
+func validateNetwork(netConfig NetworkConfigFile, duplicate, online bool, timeout time.Duration) networkReport {
+	report := networkReport{Network: netConfig.Name, Checks: []check{}}
+	add := func(name string, status checkStatus, format string, a ...interface{}) {
+		report.Checks = append(report.Checks, check{Name: name, Status: status, Message: fmt.Sprintf(format, a...)})
+	}
+
+	networkConfig, supported := config.GetNetworkByName(netConfig.Name)
+	switch {
+	case !supported:
+		add("network", checkFail, "unsupported network %q", netConfig.Name)
+		return report
+	case duplicate:
+		add("network", checkFail, "%s is configured more than once", netConfig.Name)
+		return report
+	}
+	if sunset, err := parseSunset(netConfig.Sunset); err == nil && !sunset.IsZero() {
+		networkConfig.Sunset = sunset
+	}
+	switch networkConfig.StateAt(time.Now()) {
+	case config.NetworkRemoved:
+		add("network", checkFail, "%s (chain ID %d) has been removed", networkConfig.Name, networkConfig.ChainID)
+		return report
+	case config.NetworkDeprecated:
+		if networkConfig.Sunset.IsZero() {
+			add("network", checkWarn, "%s (chain ID %d) is deprecated", networkConfig.Name, networkConfig.ChainID)
+		} else {
+			add("network", checkWarn, "%s (chain ID %d) is deprecated, payouts end on %s", networkConfig.Name, networkConfig.ChainID, networkConfig.Sunset.Format("2006-01-02"))
+		}
+	default:
+		add("network", checkOK, "%s (chain ID %d)", networkConfig.Name, networkConfig.ChainID)
+	}
+
+	// A scratch config applies the same defaults and checks as the server
+	scratch := config.NewMultiChainConfig()
+	chainInput, err := chainInputFromFile(netConfig)
+	if err == nil {
+		err = scratch.AddChainWithKey(chainInput, nil)
+	}
+	chainInstance, hasSettings := scratch.GetChain(netConfig.Name)
+	if err != nil {
+		add("settings", checkFail, "%v", err)
+	} else {
+		add("settings", checkOK, "payout %v %s, provider %s", chainInstance.Payout, networkConfig.Symbol, chainInstance.Provider)
+	}
+
+	privateKey, err := networkPrivateKey(netConfig)
+	if err != nil {
+		add("key", checkFail, "%v", err)
+	} else {
+		add("key", checkOK, "%s", crypto.PubkeyToAddress(privateKey.PublicKey).Hex())
+	}
+
+	if !online || !hasSettings || privateKey == nil {
+		return report
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	info, err := chain.Probe(ctx, chainInstance.Provider, crypto.PubkeyToAddress(privateKey.PublicKey))
+	if err != nil {
+		add("provider", checkFail, "%s: %v", chainInstance.Provider, err)
+		return report
+	}
+	add("provider", checkOK, "%s", chainInstance.Provider)
+
+	if info.ChainID.Cmp(big.NewInt(networkConfig.ChainID)) != 0 {
+		add("chain_id", checkFail, "provider reports chain ID %s, expected %d", info.ChainID, networkConfig.ChainID)
+	} else {
+		add("chain_id", checkOK, "%s", info.ChainID)
+	}
+
+	// AddChainWithKey only accepts payouts that are exact in base units
+	payout, _ := chain.ToBaseUnits(chainInstance.Payout, chainInstance.Config.Decimals)
+	payouts := new(big.Int).Div(info.Balance, payout)
+	balance := fmt.Sprintf("%s %s", chain.FromBaseUnits(info.Balance, chainInstance.Config.Decimals), networkConfig.Symbol)
+	switch {
+	case info.Balance.Cmp(payout) < 0:
+		add("balance", checkFail, "%s is less than the payout of %v %s", balance, chainInstance.Payout, networkConfig.Symbol)
+	case payouts.Cmp(big.NewInt(lowBalancePayouts)) < 0:
+		add("balance", checkWarn, "%s is only enough for %s payouts", balance, payouts)
+	default:
+		add("balance", checkOK, "%s, enough for %s payouts", balance, payouts)
+	}
+
+	if info.SupportsEIP1559 {
+		add("eip1559", checkOK, "supported")
+	} else {
+		add("eip1559", checkOK, "not supported, legacy transactions are used")
+	}
+	add("gas_price", checkOK, "%s gwei", decimal.NewFromBigInt(info.GasPrice, 0).Div(decimal.NewFromInt(params.GWei)))
+
+	return report
+}
+
+func (r *validationReport) failures() int {
+	count := 0
+	for _, c := range r.allChecks() {
+		if c.Status == checkFail {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *validationReport) allChecks() []check {
+	checks := append([]check{}, r.Checks...)
+	for _, network := range r.Networks {
+		checks = append(checks, network.Checks...)
+	}
+	return checks
+}
+
+func (r *validationReport) print(w io.Writer) {
+	printChecks := func(checks []check) {
+		for _, c := range checks {
+			line := fmt.Sprintf("  %-5s %-16s %s", c.Status, c.Name, c.Message)
+			fmt.Fprintln(w, strings.TrimRight(line, " "))
+		}
+	}
+
+	fmt.Fprintf(w, "Config %s\n", r.Config)
+	printChecks(r.Checks)
+	for _, network := range r.Networks {
+		fmt.Fprintf(w, "Network %s\n", network.Network)
+		printChecks(network.Checks)
+	}
+
+	warnings := 0
+	for _, c := range r.allChecks() {
+		if c.Status == checkWarn {
+			warnings++
+		}
+	}
+	result := "valid"
+	if !r.Valid {
+		result = "invalid"
+	}
+	fmt.Fprintf(w, "Result: %s (%d failures, %d warnings)\n", result, r.failures(), warnings)
+}
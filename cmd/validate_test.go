@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const testPrivateKey = "0x976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8"
+
+// newFakeProvider answers the JSON-RPC calls made by chain.Probe
+func newFakeProvider(t *testing.T, chainID int64, balance *big.Int) *httptest.Server {
+	header, err := json.Marshal(&types.Header{
+		Number:     big.NewInt(100),
+		Difficulty: big.NewInt(0),
+		BaseFee:    big.NewInt(1000000000),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := map[string]interface{}{
+		"eth_chainId":          hexutil.EncodeBig(big.NewInt(chainID)),
+		"eth_getBlockByNumber": json.RawMessage(header),
+		"eth_gasPrice":         hexutil.EncodeBig(big.NewInt(2000000000)),
+		"eth_getBalance":       hexutil.EncodeBig(balance),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      req.ID,
+			"result":  results[req.Method],
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func findCheck(report *validationReport, network, name string) (check, bool) {
+	checks := report.Checks
+	for _, n := range report.Networks {
+		if n.Network == network {
+			checks = n.Checks
+			break
+		}
+	}
+	for _, c := range checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return check{}, false
+}
+
+func TestValidateConfig(t *testing.T) {
+	ether := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	provider := newFakeProvider(t, 11155111, new(big.Int).Mul(big.NewInt(5), ether)).URL
+
+	type wantCheck struct {
+		network string
+		name    string
+		status  checkStatus
+	}
+	tests := []struct {
+		name      string
+		config    string
+		online    bool
+		wantValid bool
+		want      []wantCheck
+	}{
+		{
+			name:   "broken json",
+			config: `{"networks": [`,
+			want:   []wantCheck{{name: "schema", status: checkFail}},
+		},
+		{
+			name: "offline checks",
+			config: `{"http_port": 8080, "default_network": "goerli", "typo": 1, "name_service": {"network": "polygon"}, "tracing": {"exporter": "zipkin"}, "networks": [
+				{"name": "sepolia", "provider": "` + provider + `", "private_key": "` + testPrivateKey + `"},
+				{"name": "sepolia", "private_key": "` + testPrivateKey + `"},
+				{"name": "unknown", "private_key": "` + testPrivateKey + `"},
+				{"name": "holesky", "private_key": "0xzz", "rate_limits": [{"key": "address", "limit": 1, "window": "soon"}]}
+			]}`,
+			want: []wantCheck{
+				{name: "schema", status: checkWarn},
+				{name: "default_network", status: checkFail},
+				{name: "name_service", status: checkFail},
+				{name: "tracing", status: checkFail},
+				{network: "sepolia", name: "key", status: checkOK},
+				{network: "unknown", name: "network", status: checkFail},
+				{network: "holesky", name: "settings", status: checkFail},
+				{network: "holesky", name: "key", status: checkFail},
+			},
+		},
+		{
+			name: "payouts finer than the asset",
+			config: `{"http_port": 8080, "name_service": {"network": "sepolia"}, "networks": [
+				{"name": "sepolia", "private_key": "` + testPrivateKey + `", "payout": "0.0000000000000000001"},
+				{"name": "holesky", "private_key": "` + testPrivateKey + `", "decimals": 6, "payout": 0.1234567}
+			]}`,
+			want: []wantCheck{
+				{name: "name_service", status: checkOK},
+				{network: "sepolia", name: "settings", status: checkFail},
+				{network: "holesky", name: "settings", status: checkFail},
+			},
+		},
+		{
+			name: "network lifecycle",
+			config: `{"http_port": 8080, "networks": [
+				{"name": "goerli", "private_key": "` + testPrivateKey + `"},
+				{"name": "sepolia", "private_key": "` + testPrivateKey + `", "sunset": "2999-01-01"},
+				{"name": "holesky", "private_key": "` + testPrivateKey + `", "sunset": "2024-06-01"}
+			]}`,
+			want: []wantCheck{
+				{network: "goerli", name: "network", status: checkFail},
+				{network: "sepolia", name: "network", status: checkWarn},
+				{network: "sepolia", name: "settings", status: checkOK},
+				{network: "holesky", name: "network", status: checkFail},
+			},
+		},
+		{
+			name:      "online low balance",
+			config:    `{"http_port": 8080, "networks": [{"name": "sepolia", "provider": "` + provider + `", "private_key": "` + testPrivateKey + `", "payout": 1}]}`,
+			online:    true,
+			wantValid: true,
+			want: []wantCheck{
+				{network: "sepolia", name: "chain_id", status: checkOK},
+				{network: "sepolia", name: "balance", status: checkWarn},
+				{network: "sepolia", name: "eip1559", status: checkOK},
+				{network: "sepolia", name: "gas_price", status: checkOK},
+			},
+		},
+		{
+			name:   "online wrong chain and payout above balance",
+			config: `{"http_port": 8080, "networks": [{"name": "holesky", "provider": "` + provider + `", "private_key": "` + testPrivateKey + `", "payout": 10}]}`,
+			online: true,
+			want: []wantCheck{
+				{network: "holesky", name: "chain_id", status: checkFail},
+				{network: "holesky", name: "balance", status: checkFail},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := validateConfig(writeConfig(t, tt.config), tt.online, 5*time.Second)
+			if report.Valid != tt.wantValid {
+				t.Errorf("Valid = %v, want %v", report.Valid, tt.wantValid)
+			}
+			for _, want := range tt.want {
+				c, found := findCheck(report, want.network, want.name)
+				if !found || c.Status != want.status {
+					t.Errorf("check %s/%s = %+v, want status %s", want.network, want.name, c, want.status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package atomicfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "nonces.json")
+	var got map[string]int
+	if found, err := ReadJSON(path, &got); found || err != nil {
+		t.Fatalf("ReadJSON() of a missing file = %v, %v", found, err)
+	}
+
+	for _, want := range []int{1, 2} {
+		if err := WriteJSON(path, map[string]int{"next": want}); err != nil {
+			t.Fatal(err)
+		}
+		if found, err := ReadJSON(path, &got); !found || err != nil || got["next"] != want {
+			t.Fatalf("ReadJSON() = %v, %v, %v, want next %d", got, found, err, want)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left behind: %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.jsonl")
+	// A crash while writing leaves the temporary file behind
+	if err := os.WriteFile(path+".tmp", []byte("incomplete"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range [][]byte{[]byte("old content\n"), []byte("new\n")} {
+		if err := Write(path, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("file = %q, %v, want %q", got, err, want)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("file mode = %v, want 0600", mode)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temporary file is left behind: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// OutputStdout writes audit events to standard output instead of a file
+const OutputStdout = "stdout"
+
+// Config selects where audit events are written to
+type Config struct {
+	// Output is a file path or stdout, empty disables the audit log
+	Output string
+	// MaxSizeMB is the size a file is rotated at, 100 MB by default
+	MaxSizeMB int
+	// MaxBackups is how many rotated files are kept, all of them by default
+	MaxBackups int
+	// MaxAgeDays is how long rotated files are kept, forever by default
+	MaxAgeDays int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// Decision is what one stage of the claim chain decided and why
+type Decision struct {
+	Stage    string `json:"stage"`
+	Decision string `json:"decision"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Decisions of a stage
+const (
+	DecisionAllow  = "allow"
+	DecisionReject = "reject"
+	DecisionSkip   = "skip"
+)
+
+// Result is the outcome of a claim on one network
+type Result struct {
+	Network string `json:"network"`
+	ClaimID string `json:"claim_id,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Amount  string `json:"amount,omitempty"`
+	TxHash  string `json:"tx_hash,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Outcomes of a claim attempt
+const (
+	// OutcomePaid claims were broadcast on at least one network
+	OutcomePaid = "paid"
+	// OutcomeQueued claims are waiting for their payout
+	OutcomeQueued = "queued"
+	// OutcomeRejected claims were refused before a payout was attempted
+	OutcomeRejected = "rejected"
+	// OutcomeFailed claims were accepted but could not be paid
+	OutcomeFailed = "failed"
+)
+
+// Event is the audit record of one claim attempt
+type Event struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id"`
+	Route     string    `json:"route"`
+	ClientIP  string    `json:"client_ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// APIKey is a fingerprint of the X-API-Key header, never the key itself
+	APIKey    string     `json:"api_key,omitempty"`
+	Address   string     `json:"address,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Tier      string     `json:"tier,omitempty"`
+	Networks  []string   `json:"networks,omitempty"`
+	Decisions []Decision `json:"decisions"`
+	Results   []Result   `json:"results,omitempty"`
+	Outcome   string     `json:"outcome"`
+	Status    int        `json:"status"`
+	// Code and Error describe why a rejected or failed claim was refused
+	Code       string `json:"code,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// Logger writes audit events as JSON lines. A nil Logger drops them.
+type Logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewLogger writes events to w
+func NewLogger(w io.Writer) *Logger {
+	return &Logger{w: w}
+}
+
+// Open creates the logger of c, nil when the audit log is disabled. Files
+// are rotated once they reach MaxSizeMB.
+func Open(c Config) (*Logger, error) {
+	switch c.Output {
+	case "":
+		return nil, nil
+	case OutputStdout:
+		return NewLogger(os.Stdout), nil
+	}
+	if c.MaxSizeMB < 0 || c.MaxBackups < 0 || c.MaxAgeDays < 0 {
+		return nil, fmt.Errorf("audit log rotation settings must not be negative")
+	}
+	file := &lumberjack.Logger{
+		Filename:   c.Output,
+		MaxSize:    c.MaxSizeMB,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAgeDays,
+		Compress:   c.Compress,
+	}
+	// Fail at startup rather than on the first claim when the file cannot be written
+	if _, err := file.Write(nil); err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return NewLogger(file), nil
+}
+
+// Log writes one event
+func (l *Logger) Log(event Event) error {
+	if l == nil {
+		return nil
+	}
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.w.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the file of the logger
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if closer, ok := l.w.(io.Closer); ok && l.w != os.Stdout {
+		return closer.Close()
+	}
+	return nil
+}
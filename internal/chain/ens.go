@@ -0,0 +1,115 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ENSRegistry is the address of the ENS registry on Ethereum mainnet, Sepolia and Holesky
+var ENSRegistry = common.HexToAddress("0x00000000000C2E074eC69A0dFb2997BA6C7d2e1e")
+
+// ErrNameNotFound is returned for names that do not resolve to an address
+var ErrNameNotFound = errors.New("name does not resolve to an address")
+
+var ensABI = mustParseABI(`[
+	{"type":"function","name":"resolver","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]},
+	{"type":"function","name":"addr","stateMutability":"view","inputs":[{"name":"node","type":"bytes32"}],"outputs":[{"name":"","type":"address"}]}
+]`)
+
+// NameResolver resolves names such as vitalik.eth to addresses
+type NameResolver interface {
+	Resolve(ctx context.Context, name string) (common.Address, error)
+}
+
+// ENSResolver resolves names through an ENS registry or a registry with the
+// same interface, e.g. one deployed on a local network
+type ENSResolver struct {
+	Caller   ethereum.ContractCaller
+	Registry common.Address
+}
+
+// NewENSResolver connects to provider to resolve names through registry
+func NewENSResolver(provider string, registry common.Address) (*ENSResolver, error) {
+	client, err := ethclient.Dial(provider)
+	if err != nil {
+		return nil, err
+	}
+	return &ENSResolver{Caller: client, Registry: registry}, nil
+}
+
+// Resolve looks up the resolver of name in the registry and asks it for the address
+func (r *ENSResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	node := NameHash(name)
+	resolver, err := r.call(ctx, r.Registry, "resolver", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to look up the resolver of %s: %w", name, err)
+	}
+	if resolver == (common.Address{}) {
+		return common.Address{}, ErrNameNotFound
+	}
+	address, err := r.call(ctx, resolver, "addr", node)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("failed to resolve %s: %w", name, err)
+	}
+	if address == (common.Address{}) {
+		return common.Address{}, ErrNameNotFound
+	}
+	return address, nil
+}
+
+// call calls a function of the ENS ABI that returns an address
+func (r *ENSResolver) call(ctx context.Context, contract common.Address, method string, node common.Hash) (common.Address, error) {
+	data, err := ensABI.Pack(method, node)
+	if err != nil {
+		return common.Address{}, err
+	}
+	result, err := r.Caller.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	// A registry without the name, or an account without code, returns nothing
+	if len(result) == 0 {
+		return common.Address{}, nil
+	}
+	values, err := ensABI.Unpack(method, result)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return values[0].(common.Address), nil
+}
+
+// NameHash returns the ENS node of a normalized name
+func NameHash(name string) common.Hash {
+	var node common.Hash
+	if name == "" {
+		return node
+	}
+	labels := strings.Split(name, ".")
+	for i := len(labels) - 1; i >= 0; i-- {
+		node = crypto.Keccak256Hash(node.Bytes(), crypto.Keccak256([]byte(labels[i])))
+	}
+	return node
+}
+
+// NormalizeName lowercases a name and reports whether it looks like a name
+// rather than an address: at least two labels, none of them empty. Names
+// have to be normalized otherwise, full UTS-46 mapping is not applied.
+func NormalizeName(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if IsValidAddress(name, false) || !strings.Contains(name, ".") {
+		return "", false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || strings.ContainsAny(label, " \t\n/\\") {
+			return "", false
+		}
+	}
+	return name, true
+}
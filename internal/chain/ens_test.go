@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// fakeRegistry answers resolver() for the registry and addr() for every
+// other contract from records keyed by node
+type fakeRegistry struct {
+	registry  common.Address
+	resolvers map[common.Hash]common.Address
+	addresses map[common.Hash]common.Address
+}
+
+func (f *fakeRegistry) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	node := common.BytesToHash(call.Data[4:36])
+	records := f.addresses
+	if *call.To == f.registry {
+		records = f.resolvers
+	}
+	return common.LeftPadBytes(records[node].Bytes(), 32), nil
+}
+
+func TestNameHash(t *testing.T) {
+	// Test vectors of EIP-137
+	tests := map[string]string{
+		"":        "0x0000000000000000000000000000000000000000000000000000000000000000",
+		"eth":     "0x93cdeb708b7545dc668eb9280176169d1c33cfd8ed6f04690a0bcc88a93fc4ae",
+		"foo.eth": "0xde9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f",
+	}
+	for name, want := range tests {
+		if got := NameHash(name).Hex(); got != want {
+			t.Errorf("NameHash(%q) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{name: "Vitalik.ETH ", want: "vitalik.eth", wantOK: true},
+		{name: "pay.faucet.test", want: "pay.faucet.test", wantOK: true},
+		{name: "0xab5801a7d398351b8be11c439e05c5b3259aec9b"},
+		{name: "vitalik"},
+		{name: "vitalik..eth"},
+		{name: "vital ik.eth"},
+	}
+	for _, tt := range tests {
+		got, ok := NormalizeName(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("NormalizeName(%q) = %q, %v, want %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestENSResolver(t *testing.T) {
+	resolver := common.HexToAddress("0x4976fb03C32e5B8cfe2b6cCB31c09Ba78EBaBa41")
+	owner := common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045")
+	registry := &fakeRegistry{
+		registry: ENSRegistry,
+		resolvers: map[common.Hash]common.Address{
+			NameHash("vitalik.eth"): resolver,
+			NameHash("empty.eth"):   resolver,
+		},
+		addresses: map[common.Hash]common.Address{NameHash("vitalik.eth"): owner},
+	}
+	r := &ENSResolver{Caller: registry, Registry: ENSRegistry}
+
+	tests := []struct {
+		name    string
+		want    common.Address
+		wantErr error
+	}{
+		{name: "vitalik.eth", want: owner},
+		{name: "empty.eth", wantErr: ErrNameNotFound},
+		{name: "unknown.eth", wantErr: ErrNameNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.Resolve(context.Background(), tt.name)
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Errorf("Resolve() = %s, %v, want %s, %v", got.Hex(), err, tt.want.Hex(), tt.wantErr)
+			}
+		})
+	}
+}
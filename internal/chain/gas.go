@@ -0,0 +1,364 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// TransferGas is the gas limit of a plain transfer under DefaultGas. It
+// leaves some room above the 21000 an externally owned recipient needs.
+const TransferGas = 23100
+
+// ErrFeeCapExceeded is returned when the network asks for more than the max fee cap
+var ErrFeeCapExceeded = errors.New("gas price exceeds the max fee cap")
+
+// GasClient is the part of the JSON-RPC API gas strategies use
+type GasClient interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	SuggestGasTipCap(ctx context.Context) (*big.Int, error)
+	EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error)
+}
+
+// FeeHistoryReader is implemented by clients that support eth_feeHistory
+type FeeHistoryReader interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// GasParams are the gas limit and fees of a transaction. Legacy
+// transactions set GasPrice, EIP-1559 ones BaseFee, TipCap and FeeCap.
+type GasParams struct {
+	Limit    uint64
+	GasPrice *big.Int
+	BaseFee  *big.Int
+	TipCap   *big.Int
+	FeeCap   *big.Int
+	// L1Fee is the data fee an OP-stack rollup charges for posting the
+	// transaction to L1, nil elsewhere
+	L1Fee *big.Int
+}
+
+// Dynamic reports whether the transaction uses the EIP-1559 fee market
+func (p *GasParams) Dynamic() bool {
+	return p.FeeCap != nil
+}
+
+// MaxCost returns the most the transaction can cost in fees
+func (p *GasParams) MaxCost() *big.Int {
+	price := p.GasPrice
+	if p.Dynamic() {
+		price = p.FeeCap
+	}
+	cost := new(big.Int).Mul(price, new(big.Int).SetUint64(p.Limit))
+	if p.L1Fee != nil {
+		cost.Add(cost, p.L1Fee)
+	}
+	return cost
+}
+
+// GasStrategy decides the gas limit and fees of a transaction
+type GasStrategy interface {
+	Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error)
+}
+
+// GasStrategyName selects a GasStrategy in a GasConfig
+type GasStrategyName string
+
+const (
+	// DefaultGasStrategy selects DefaultGas
+	DefaultGasStrategy GasStrategyName = "default"
+	// EstimateGasStrategy selects EstimatedGas
+	EstimateGasStrategy GasStrategyName = "estimate"
+	// FeeHistoryGasStrategy selects FeeHistoryGas
+	FeeHistoryGasStrategy GasStrategyName = "fee_history"
+)
+
+// GasConfig selects and tunes the gas strategy of a network
+type GasConfig struct {
+	Strategy GasStrategyName
+	// Margin is added to estimated gas limits, in percent. 0 uses 20.
+	Margin uint64
+	// Blocks and Percentile select the priority fees FeeHistoryGas tips.
+	// 0 uses the last 20 blocks and their median.
+	Blocks     uint64
+	Percentile float64
+	// MaxFeeCap caps the fee per gas in wei, nil leaves it uncapped
+	MaxFeeCap *big.Int
+	// OPStack adds the L1 data fee of OP-stack rollups to the cost
+	OPStack bool
+}
+
+// Validate reports whether the configuration is usable
+func (c GasConfig) Validate() error {
+	switch c.Strategy {
+	case "", DefaultGasStrategy, EstimateGasStrategy, FeeHistoryGasStrategy:
+	default:
+		return fmt.Errorf("unknown gas strategy %q", c.Strategy)
+	}
+	if c.Percentile < 0 || c.Percentile > 100 {
+		return fmt.Errorf("gas fee percentile must be between 0 and 100, got %v", c.Percentile)
+	}
+	if c.MaxFeeCap != nil && c.MaxFeeCap.Sign() <= 0 {
+		return errors.New("max fee cap must be positive")
+	}
+	return nil
+}
+
+// NewGasStrategy returns the strategy c selects. c must be valid.
+func NewGasStrategy(c GasConfig) GasStrategy {
+	margin := c.Margin
+	if margin == 0 {
+		margin = 20
+	}
+
+	var strategy GasStrategy
+	switch c.Strategy {
+	case EstimateGasStrategy:
+		strategy = EstimatedGas{Margin: margin}
+	case FeeHistoryGasStrategy:
+		strategy = FeeHistoryGas{Margin: margin, Blocks: c.Blocks, Percentile: c.Percentile}
+	default:
+		strategy = DefaultGas{}
+	}
+	if c.MaxFeeCap != nil {
+		strategy = CappedGas{GasStrategy: strategy, MaxFeeCap: c.MaxFeeCap}
+	}
+	if c.OPStack {
+		strategy = OPStackGas{GasStrategy: strategy}
+	}
+	return strategy
+}
+
+// DefaultGas gives plain transfers TransferGas and estimates the gas of
+// contract calls. It tips what the node suggests with a fee cap of twice the
+// base fee, or pays the suggested gas price before London.
+type DefaultGas struct{}
+
+func (DefaultGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	params := &GasParams{Limit: TransferGas}
+	if len(msg.Data) > 0 {
+		limit, err := client.EstimateGas(ctx, msg)
+		if err != nil {
+			return nil, err
+		}
+		params.Limit = limit
+	}
+	return params, suggestedFees(ctx, client, params)
+}
+
+// EstimatedGas limits every transaction to eth_estimateGas plus Margin
+// percent, which recipients that are contracts and chains such as zkSync
+// need. Fees are those of DefaultGas.
+type EstimatedGas struct {
+	Margin uint64
+}
+
+func (s EstimatedGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	limit, err := estimateLimit(ctx, client, msg, s.Margin)
+	if err != nil {
+		return nil, err
+	}
+	params := &GasParams{Limit: limit}
+	return params, suggestedFees(ctx, client, params)
+}
+
+// FeeHistoryGas tips the Percentile of the priority fees paid in the last
+// Blocks blocks according to eth_feeHistory, with a fee cap of twice the
+// base fee. Limits are those of EstimatedGas.
+type FeeHistoryGas struct {
+	Margin     uint64
+	Blocks     uint64
+	Percentile float64
+}
+
+func (s FeeHistoryGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	history, ok := client.(FeeHistoryReader)
+	if !ok {
+		return nil, errors.New("the client does not support eth_feeHistory")
+	}
+	limit, err := estimateLimit(ctx, client, msg, s.Margin)
+	if err != nil {
+		return nil, err
+	}
+	params := &GasParams{Limit: limit}
+
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header.BaseFee == nil || header.BaseFee.Sign() == 0 {
+		params.GasPrice, err = client.SuggestGasPrice(ctx)
+		return params, err
+	}
+
+	blocks, percentile := s.Blocks, s.Percentile
+	if blocks == 0 {
+		blocks = 20
+	}
+	if percentile == 0 {
+		percentile = 50
+	}
+	fees, err := history.FeeHistory(ctx, blocks, nil, []float64{percentile})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get fee history: %w", err)
+	}
+	var rewards []*big.Int
+	for _, reward := range fees.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			rewards = append(rewards, reward[0])
+		}
+	}
+	if len(rewards) == 0 {
+		return nil, errors.New("fee history has no priority fees")
+	}
+	// The median of the blocks smooths out single blocks with unusual tips
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+	params.BaseFee = header.BaseFee
+	params.TipCap = rewards[len(rewards)/2]
+	params.FeeCap = feeCap(header.BaseFee, params.TipCap)
+	return params, nil
+}
+
+// CappedGas limits the fee per gas of another strategy to MaxFeeCap. It
+// fails with ErrFeeCapExceeded when the current price alone is higher.
+type CappedGas struct {
+	GasStrategy
+	MaxFeeCap *big.Int
+}
+
+func (s CappedGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	params, err := s.GasStrategy.Gas(ctx, client, msg)
+	if err != nil {
+		return nil, err
+	}
+	if !params.Dynamic() {
+		if params.GasPrice.Cmp(s.MaxFeeCap) > 0 {
+			return nil, fmt.Errorf("%w: gas price %s, cap %s", ErrFeeCapExceeded, params.GasPrice, s.MaxFeeCap)
+		}
+		return params, nil
+	}
+	if params.BaseFee.Cmp(s.MaxFeeCap) > 0 {
+		return nil, fmt.Errorf("%w: base fee %s, cap %s", ErrFeeCapExceeded, params.BaseFee, s.MaxFeeCap)
+	}
+	if params.FeeCap.Cmp(s.MaxFeeCap) > 0 {
+		params.FeeCap = new(big.Int).Set(s.MaxFeeCap)
+	}
+	if params.TipCap.Cmp(params.FeeCap) > 0 {
+		params.TipCap = new(big.Int).Set(params.FeeCap)
+	}
+	return params, nil
+}
+
+// GasPriceOracle is the predeploy OP-stack rollups report the L1 data fee of a transaction with
+var GasPriceOracle = common.HexToAddress("0x420000000000000000000000000000000000000F")
+
+var gasPriceOracleABI = mustParseABI(`[
+	{"type":"function","name":"getL1Fee","stateMutability":"view","inputs":[{"name":"_data","type":"bytes"}],"outputs":[{"name":"","type":"uint256"}]}
+]`)
+
+// OPStackGas adds the L1 data fee of an OP-stack rollup to the fees of
+// another strategy. The rollup charges it on top of the L2 gas, so the cost
+// of a payout is wrong without it. The client has to implement
+// ethereum.ContractCaller.
+type OPStackGas struct {
+	GasStrategy
+}
+
+func (s OPStackGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	caller, ok := client.(ethereum.ContractCaller)
+	if !ok {
+		return nil, errors.New("the client cannot call the gas price oracle")
+	}
+	params, err := s.GasStrategy.Gas(ctx, client, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The oracle prices the serialized transaction. Nonce and signature are
+	// not known yet, the oracle adds a fixed overhead for them.
+	tx, err := newTx(params, nil, 0, msg.To, msg.Value, msg.Data).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	data, err := gasPriceOracleABI.Pack("getL1Fee", tx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := caller.CallContract(ctx, ethereum.CallMsg{To: &GasPriceOracle, Data: data}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get L1 fee: %w", err)
+	}
+	values, err := gasPriceOracleABI.Unpack("getL1Fee", result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get L1 fee: %w", err)
+	}
+	params.L1Fee = values[0].(*big.Int)
+	return params, nil
+}
+
+// estimateLimit returns the estimated gas of msg plus margin percent
+func estimateLimit(ctx context.Context, client GasClient, msg ethereum.CallMsg, margin uint64) (uint64, error) {
+	limit, err := client.EstimateGas(ctx, msg)
+	if err != nil {
+		return 0, err
+	}
+	return limit + limit*margin/100, nil
+}
+
+// suggestedFees sets the fees the node suggests
+func suggestedFees(ctx context.Context, client GasClient, params *GasParams) error {
+	header, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if header.BaseFee == nil || header.BaseFee.Sign() == 0 {
+		params.GasPrice, err = client.SuggestGasPrice(ctx)
+		return err
+	}
+
+	tip, err := client.SuggestGasTipCap(ctx)
+	if err != nil {
+		return err
+	}
+	params.BaseFee = header.BaseFee
+	params.TipCap = tip
+	params.FeeCap = feeCap(header.BaseFee, tip)
+	return nil
+}
+
+// feeCap leaves room for the base fee to double before the transaction is mined
+func feeCap(baseFee, tip *big.Int) *big.Int {
+	fee := new(big.Int).Mul(baseFee, big.NewInt(2))
+	return fee.Add(fee, tip)
+}
+
+// newTx builds the unsigned transaction params price
+func newTx(params *GasParams, chainID *big.Int, nonce uint64, to *common.Address, value *big.Int, data []byte) *types.Transaction {
+	if params.Dynamic() {
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:   chainID,
+			Nonce:     nonce,
+			GasTipCap: params.TipCap,
+			GasFeeCap: params.FeeCap,
+			Gas:       params.Limit,
+			To:        to,
+			Value:     value,
+			Data:      data,
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: params.GasPrice,
+		Gas:      params.Limit,
+		To:       to,
+		Value:    value,
+		Data:     data,
+	})
+}
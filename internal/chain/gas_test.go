@@ -0,0 +1,199 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// fakeGasClient answers with fixed values. A nil baseFee makes it a chain
+// before London.
+type fakeGasClient struct {
+	baseFee  *big.Int
+	gasPrice *big.Int
+	tip      *big.Int
+	estimate uint64
+	rewards  []int64
+	l1Fee    *big.Int
+	calls    []ethereum.CallMsg
+}
+
+func (c *fakeGasClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{BaseFee: c.baseFee}, nil
+}
+
+func (c *fakeGasClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return c.gasPrice, nil
+}
+
+func (c *fakeGasClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return c.tip, nil
+}
+
+func (c *fakeGasClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	if c.estimate == 0 {
+		return 0, errors.New("execution reverted")
+	}
+	return c.estimate, nil
+}
+
+func (c *fakeGasClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	history := &ethereum.FeeHistory{}
+	for _, reward := range c.rewards {
+		history.Reward = append(history.Reward, []*big.Int{big.NewInt(reward)})
+	}
+	return history, nil
+}
+
+func (c *fakeGasClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls = append(c.calls, call)
+	return common.LeftPadBytes(c.l1Fee.Bytes(), 32), nil
+}
+
+func TestGasStrategies(t *testing.T) {
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	transfer := ethereum.CallMsg{To: &recipient, Value: big.NewInt(1000)}
+	call := ethereum.CallMsg{To: &recipient, Value: big.NewInt(1000), Data: []byte{1, 2, 3, 4}}
+
+	tests := []struct {
+		name     string
+		strategy GasStrategy
+		client   *fakeGasClient
+		msg      ethereum.CallMsg
+		want     GasParams
+		wantErr  error
+	}{
+		{
+			name:     "default transfer",
+			strategy: DefaultGas{},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2)},
+			msg:      transfer,
+			want:     GasParams{Limit: TransferGas, BaseFee: big.NewInt(100), TipCap: big.NewInt(2), FeeCap: big.NewInt(202)},
+		},
+		{
+			name:     "default contract call before London",
+			strategy: DefaultGas{},
+			client:   &fakeGasClient{gasPrice: big.NewInt(50), estimate: 40000},
+			msg:      call,
+			want:     GasParams{Limit: 40000, GasPrice: big.NewInt(50)},
+		},
+		{
+			name:     "estimate with margin",
+			strategy: EstimatedGas{Margin: 20},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2), estimate: 21000},
+			msg:      transfer,
+			want:     GasParams{Limit: 25200, BaseFee: big.NewInt(100), TipCap: big.NewInt(2), FeeCap: big.NewInt(202)},
+		},
+		{
+			name:     "estimate reverts",
+			strategy: EstimatedGas{Margin: 20},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2)},
+			msg:      transfer,
+			wantErr:  errors.New("execution reverted"),
+		},
+		{
+			name:     "fee history median",
+			strategy: FeeHistoryGas{Percentile: 60},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), estimate: 21000, rewards: []int64{9, 1, 5, 3, 7}},
+			msg:      transfer,
+			want:     GasParams{Limit: 21000, BaseFee: big.NewInt(100), TipCap: big.NewInt(5), FeeCap: big.NewInt(205)},
+		},
+		{
+			name:     "fee cap lowers fee and tip",
+			strategy: CappedGas{GasStrategy: DefaultGas{}, MaxFeeCap: big.NewInt(150)},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(200)},
+			msg:      transfer,
+			want:     GasParams{Limit: TransferGas, BaseFee: big.NewInt(100), TipCap: big.NewInt(150), FeeCap: big.NewInt(150)},
+		},
+		{
+			name:     "base fee above cap",
+			strategy: CappedGas{GasStrategy: DefaultGas{}, MaxFeeCap: big.NewInt(90)},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2)},
+			msg:      transfer,
+			wantErr:  ErrFeeCapExceeded,
+		},
+		{
+			name:     "gas price above cap",
+			strategy: CappedGas{GasStrategy: DefaultGas{}, MaxFeeCap: big.NewInt(40)},
+			client:   &fakeGasClient{gasPrice: big.NewInt(50)},
+			msg:      transfer,
+			wantErr:  ErrFeeCapExceeded,
+		},
+		{
+			name:     "OP stack L1 fee",
+			strategy: OPStackGas{GasStrategy: DefaultGas{}},
+			client:   &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2), l1Fee: big.NewInt(123456)},
+			msg:      transfer,
+			want:     GasParams{Limit: TransferGas, BaseFee: big.NewInt(100), TipCap: big.NewInt(2), FeeCap: big.NewInt(202), L1Fee: big.NewInt(123456)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.strategy.Gas(context.Background(), tt.client, tt.msg)
+			if tt.wantErr != nil {
+				if err == nil || !errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error() {
+					t.Fatalf("Gas() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Limit != tt.want.Limit || !equalBig(got.GasPrice, tt.want.GasPrice) || !equalBig(got.BaseFee, tt.want.BaseFee) ||
+				!equalBig(got.TipCap, tt.want.TipCap) || !equalBig(got.FeeCap, tt.want.FeeCap) || !equalBig(got.L1Fee, tt.want.L1Fee) {
+				t.Errorf("Gas() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOPStackGasCallsOracle(t *testing.T) {
+	client := &fakeGasClient{baseFee: big.NewInt(100), tip: big.NewInt(2), l1Fee: big.NewInt(1000)}
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	params, err := OPStackGas{GasStrategy: DefaultGas{}}.Gas(context.Background(), client, ethereum.CallMsg{To: &recipient, Value: big.NewInt(1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(client.calls) != 1 || *client.calls[0].To != GasPriceOracle || !bytes.Equal(client.calls[0].Data[:4], gasPriceOracleABI.Methods["getL1Fee"].ID) {
+		t.Fatalf("unexpected oracle calls %+v", client.calls)
+	}
+	// 23100 gas at a fee cap of 202 plus the L1 fee
+	if want := big.NewInt(23100*202 + 1000); params.MaxCost().Cmp(want) != 0 {
+		t.Errorf("MaxCost() = %s, want %s", params.MaxCost(), want)
+	}
+}
+
+func TestNewGasStrategy(t *testing.T) {
+	strategy := NewGasStrategy(GasConfig{Strategy: FeeHistoryGasStrategy, MaxFeeCap: big.NewInt(100), OPStack: true})
+	opStack, ok := strategy.(OPStackGas)
+	if !ok {
+		t.Fatalf("expected OPStackGas, got %T", strategy)
+	}
+	capped, ok := opStack.GasStrategy.(CappedGas)
+	if !ok {
+		t.Fatalf("expected CappedGas, got %T", opStack.GasStrategy)
+	}
+	if got, ok := capped.GasStrategy.(FeeHistoryGas); !ok || got.Margin != 20 {
+		t.Errorf("expected FeeHistoryGas with the default margin, got %+v", capped.GasStrategy)
+	}
+
+	for _, c := range []GasConfig{{Strategy: "cheapest"}, {Percentile: 101}, {MaxFeeCap: big.NewInt(0)}} {
+		if err := c.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+}
+
+func equalBig(a, b *big.Int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Cmp(b) == 0
+}
@@ -0,0 +1,129 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MultisendABI is the interface of the multisend contract in contracts/multisend.easm
+const MultisendABI = `[
+	{"type":"function","name":"multisend","stateMutability":"payable","inputs":[{"name":"recipients","type":"address[]"},{"name":"amounts","type":"uint256[]"}],"outputs":[]},
+	{"type":"event","name":"Sent","anonymous":false,"inputs":[{"name":"recipient","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]},
+	{"type":"event","name":"Failed","anonymous":false,"inputs":[{"name":"recipient","type":"address","indexed":true},{"name":"amount","type":"uint256","indexed":false}]}
+]`
+
+// multisendRuntime is contracts/multisend.easm compiled with go-ethereum's core/asm
+const multisendRuntime = "60003560e01c63aad41a4114630000001657600080fd5b6004356004016024356004018135808235141563000000f95760005b81811463000000cf5780600101602002808501359084013580602051016020526000808080848661c350f1630000009b5780604051016040526000527f325cf12a5a810dd6b21d7aedc0fc5e08fc623604ee1d61fdba2a60e7719f646260206000a263000000c5565b6000527f510ffb4dcab972ae9d2007a58e13f1b0881776d23cd8f5cc32f8c5be2dbf70d260206000a25b6001016300000032565b60205134141563000000f957604051801563000000f757600080808084335af11563000000f9575b005b600080fd"
+
+var (
+	multisendABI = mustParseABI(MultisendABI)
+	sentTopic    = crypto.Keccak256Hash([]byte("Sent(address,uint256)"))
+	failedTopic  = crypto.Keccak256Hash([]byte("Failed(address,uint256)"))
+)
+
+// BatchLog is the event of the multisend contract for one recipient of a batch
+type BatchLog struct {
+	Index uint
+	// Failed is set when the recipient refused the transfer, whose amount
+	// the contract refunded
+	Failed bool
+}
+
+// BatchTxBuilder pays several recipients in a single multisend transaction
+type BatchTxBuilder interface {
+	TxBuilder
+	BatchTransfer(ctx context.Context, contract common.Address, to []string, values []*big.Int) (common.Hash, error)
+	BatchLogs(ctx context.Context, contract common.Address, txHash common.Hash) ([]BatchLog, error)
+}
+
+// MultisendDeployCode returns the creation code of the multisend contract
+func MultisendDeployCode() []byte {
+	runtime := common.FromHex(multisendRuntime)
+	// PUSH2 len, DUP1, PUSH1 12, PUSH1 0, CODECOPY, PUSH1 0, RETURN
+	init := []byte{0x61, byte(len(runtime) >> 8), byte(len(runtime)), 0x80, 0x60, 0x0c, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}
+	return append(init, runtime...)
+}
+
+// DeployMultisend deploys the multisend contract used for batched payouts
+func DeployMultisend(opts *bind.TransactOpts, backend bind.ContractBackend) (common.Address, *types.Transaction, error) {
+	address, tx, _, err := bind.DeployContract(opts, multisendABI, MultisendDeployCode(), backend)
+	return address, tx, err
+}
+
+// BatchTransfer sends values[i] to to[i] through the multisend contract
+func (b *TxBuild) BatchTransfer(ctx context.Context, contract common.Address, to []string, values []*big.Int) (common.Hash, error) {
+	if len(to) != len(values) {
+		return common.Hash{}, errors.New("recipients and values differ in length")
+	}
+
+	recipients := make([]common.Address, len(to))
+	total := new(big.Int)
+	for i := range to {
+		recipients[i] = common.HexToAddress(to[i])
+		total.Add(total, values[i])
+	}
+
+	data, err := multisendABI.Pack("multisend", recipients, values)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return b.send(ctx, &contract, total, data)
+}
+
+// BatchLogs waits until the multisend transaction is mined and returns the
+// Sent or Failed event of every recipient, in call order. Only events of
+// contract count, recipients may emit events of the same signature.
+func (b *TxBuild) BatchLogs(ctx context.Context, contract common.Address, txHash common.Hash) ([]BatchLog, error) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		receipt, err := b.client.TransactionReceipt(ctx, txHash)
+		if err == nil {
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				return nil, errors.New("multisend transaction reverted")
+			}
+			var logs []BatchLog
+			for _, l := range receipt.Logs {
+				if l.Address != contract || len(l.Topics) == 0 {
+					continue
+				}
+				switch l.Topics[0] {
+				case sentTopic:
+					logs = append(logs, BatchLog{Index: l.Index})
+				case failedTopic:
+					logs = append(logs, BatchLog{Index: l.Index, Failed: true})
+				}
+			}
+			return logs, nil
+		}
+		if !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func mustParseABI(definition string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(definition))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
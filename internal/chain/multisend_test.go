@@ -0,0 +1,148 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/asm"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestMultisendRuntimeMatchesSource(t *testing.T) {
+	src, err := os.ReadFile("contracts/multisend.easm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiler := asm.NewCompiler(false)
+	compiler.Feed(asm.Lex(src, false))
+	code, errs := compiler.Compile()
+	if len(errs) != 0 {
+		t.Fatalf("failed to compile multisend.easm: %v", errs)
+	}
+	if code != multisendRuntime {
+		t.Errorf("multisendRuntime is out of date with contracts/multisend.easm, want %s", code)
+	}
+}
+
+func TestBatchTransfer(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	// A contract that reverts whenever it receives ether
+	reverter := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	// A contract that emits an event with the signature of Sent whenever it receives ether
+	emitter := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	// A contract that loops until it runs out of gas
+	burner := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+			reverter:    {Balance: new(big.Int), Code: common.FromHex("600080fd")},
+			emitter:     {Balance: new(big.Int), Code: append(append([]byte{0x7f}, sentTopic.Bytes()...), common.FromHex("60006000a100")...)},
+			burner:      {Balance: new(big.Int), Code: common.FromHex("5b600056")},
+		}, 10000000,
+	)
+	defer simClient.Close()
+	bgCtx := context.Background()
+
+	auth, err := bind.NewKeyedTransactorWithChainID(privateKey, big.NewInt(1337))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contract, _, err := DeployMultisend(auth, simClient)
+	if err != nil {
+		t.Fatalf("could not deploy multisend: %v", err)
+	}
+	simClient.Commit()
+
+	txBuilder := &TxBuild{
+		client:      simClient,
+		privateKey:  privateKey,
+		signer:      types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress: fromAddress,
+		nonces:      NewNonceManager(simClient, fromAddress, nil),
+		gas:         DefaultGas{},
+	}
+
+	recipients := []string{
+		"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+		emitter.Hex(),
+		"0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B",
+	}
+	values := []*big.Int{big.NewInt(1000), big.NewInt(2000), big.NewInt(3000)}
+	txHash, err := txBuilder.BatchTransfer(bgCtx, contract, recipients, values)
+	if err != nil {
+		t.Fatalf("could not send multisend transaction: %v", err)
+	}
+	simClient.Commit()
+
+	simClient.Commit()
+
+	status, err := txBuilder.TxStatus(bgCtx, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Mined || !status.Successful || status.Confirmations != 2 {
+		t.Errorf("unexpected transaction status %+v", status)
+	}
+
+	logs, err := txBuilder.BatchLogs(bgCtx, contract, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The event of the emitter is log 1
+	if !reflect.DeepEqual(logs, []BatchLog{{Index: 0}, {Index: 2}, {Index: 3}}) {
+		t.Errorf("unexpected logs %+v", logs)
+	}
+
+	wantBalances := map[string]*big.Int{
+		recipients[0]: big.NewInt(4000),
+		recipients[1]: big.NewInt(2000),
+	}
+	for address, want := range wantBalances {
+		bal, err := simClient.BalanceAt(bgCtx, common.HexToAddress(address), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bal.Cmp(want) != 0 {
+			t.Errorf("balance of %s = %v, want %v", address, bal, want)
+		}
+	}
+
+	// Recipients that revert or use up their gas are skipped, the others are paid
+	txHash, err = txBuilder.BatchTransfer(bgCtx, contract, []string{reverter.Hex(), burner.Hex(), recipients[0]}, values)
+	if err != nil {
+		t.Fatalf("could not send multisend transaction with refusing recipients: %v", err)
+	}
+	simClient.Commit()
+	logs, err = txBuilder.BatchLogs(bgCtx, contract, txHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(logs, []BatchLog{{Index: 0, Failed: true}, {Index: 1, Failed: true}, {Index: 2}}) {
+		t.Errorf("unexpected logs %+v", logs)
+	}
+	wantBalances = map[string]*big.Int{
+		reverter.Hex(): new(big.Int),
+		burner.Hex():   new(big.Int),
+		recipients[0]:  big.NewInt(7000),
+		// The refused amounts are refunded
+		contract.Hex(): new(big.Int),
+	}
+	for address, want := range wantBalances {
+		bal, err := simClient.BalanceAt(bgCtx, common.HexToAddress(address), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bal.Cmp(want) != 0 {
+			t.Errorf("balance of %s = %v, want %v", address, bal, want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/atomicfile"
+)
+
+// NonceClient is the part of the JSON-RPC API the nonce manager uses
+type NonceClient interface {
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// NonceState is what a NonceManager persists across restarts
+type NonceState struct {
+	Account common.Address `json:"account"`
+	// Next is the lowest nonce that was never handed out
+	Next uint64 `json:"next"`
+	// Released are nonces below Next that were handed out but not used
+	Released []uint64 `json:"released,omitempty"`
+}
+
+// NonceStore persists the nonces of an account
+type NonceStore interface {
+	Load() (*NonceState, error)
+	Save(state NonceState) error
+}
+
+// FileNonceStore keeps the nonce state of an account in a JSON file
+type FileNonceStore struct {
+	path string
+}
+
+func NewFileNonceStore(path string) *FileNonceStore {
+	return &FileNonceStore{path: path}
+}
+
+func (s *FileNonceStore) Load() (*NonceState, error) {
+	var state NonceState
+	if found, err := atomicfile.ReadJSON(s.path, &state); !found || err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (s *FileNonceStore) Save(state NonceState) error {
+	return atomicfile.WriteJSON(s.path, state)
+}
+
+// NonceManager hands out the nonces of an account. A nonce that is not
+// broadcast is released and handed out again, so a failed transaction does
+// not leave a gap that blocks every later one. Gaps that appear anyway, e.g.
+// when the node drops a transaction, are found by comparing with the nonces
+// of the node.
+type NonceManager struct {
+	client  NonceClient
+	account common.Address
+	store   NonceStore
+
+	mu       sync.Mutex
+	synced   bool
+	next     uint64
+	released []uint64
+	// held are the nonces handed out and neither sent nor released yet
+	held map[uint64]bool
+}
+
+// NonceStatus compares the nonces of the manager with those of the node
+type NonceStatus struct {
+	// Latest is the nonce of the account in the latest block
+	Latest uint64
+	// Pending is the nonce after the transactions the node can mine next
+	Pending uint64
+	// Next is the lowest nonce the manager never handed out
+	Next uint64
+}
+
+// NewNonceManager manages the nonces of account, persisted to store unless it is nil
+func NewNonceManager(client NonceClient, account common.Address, store NonceStore) *NonceManager {
+	return &NonceManager{
+		client:  client,
+		account: account,
+		store:   store,
+		held:    make(map[uint64]bool),
+	}
+}
+
+// Acquire hands out the lowest released nonce, or else the next one. The
+// nonce has to be returned with Sent once it is broadcast or with Release.
+func (m *NonceManager) Acquire(ctx context.Context) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.synced {
+		if err := m.syncLocked(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	var nonce uint64
+	if len(m.released) > 0 {
+		// Not persisted, the saved Next covers the nonce already. Handed out
+		// again after a restart, the node reports it as used.
+		nonce = m.released[0]
+		m.released = m.released[1:]
+	} else {
+		nonce = m.next
+		m.next++
+		m.saveLocked()
+	}
+	m.held[nonce] = true
+	return nonce, nil
+}
+
+// Sent marks a nonce as used by a broadcast transaction
+func (m *NonceManager) Sent(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.held, nonce)
+}
+
+// Release gives back a nonce that was not broadcast, to be handed out again
+func (m *NonceManager) Release(nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.held[nonce] {
+		return
+	}
+	delete(m.held, nonce)
+
+	i := sort.Search(len(m.released), func(i int) bool { return m.released[i] >= nonce })
+	m.released = append(m.released, 0)
+	copy(m.released[i+1:], m.released[i:])
+	m.released[i] = nonce
+	// Released nonces at the end are simply not handed out yet
+	for len(m.released) > 0 && m.released[len(m.released)-1] == m.next-1 {
+		m.released = m.released[:len(m.released)-1]
+		m.next--
+	}
+	m.saveLocked()
+}
+
+// Sync catches up with the node, e.g. after a transaction of the account
+// was sent elsewhere. Nonces below the pending nonce of the node are used.
+func (m *NonceManager) Sync(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.syncLocked(ctx)
+}
+
+func (m *NonceManager) syncLocked(ctx context.Context) error {
+	pending, err := m.client.PendingNonceAt(ctx, m.account)
+	if err != nil {
+		return err
+	}
+	if !m.synced {
+		m.restoreLocked()
+		m.synced = true
+	}
+	if m.advanceLocked(pending) {
+		m.saveLocked()
+	}
+	return nil
+}
+
+// restoreLocked loads the persisted state of the account, if any
+func (m *NonceManager) restoreLocked() {
+	if m.store == nil {
+		return
+	}
+	state, err := m.store.Load()
+	if err != nil {
+		log.WithError(err).WithField("address", m.account).Warn("Failed to load nonces, starting from the node's")
+		return
+	}
+	if state == nil || state.Account != m.account {
+		return
+	}
+	m.next = state.Next
+	m.released = append([]uint64(nil), state.Released...)
+	sort.Slice(m.released, func(i, j int) bool { return m.released[i] < m.released[j] })
+}
+
+// advanceLocked forgets the nonces below pending, which the node already
+// has, and reports whether that changed anything
+func (m *NonceManager) advanceLocked(pending uint64) bool {
+	changed := false
+	if m.next < pending {
+		m.next = pending
+		changed = true
+	}
+	if i := sort.Search(len(m.released), func(i int) bool { return m.released[i] >= pending }); i > 0 {
+		m.released = m.released[i:]
+		changed = true
+	}
+	return changed
+}
+
+// Status returns the nonces of the node next to the next nonce of the manager
+func (m *NonceManager) Status(ctx context.Context) (NonceStatus, error) {
+	latest, err := m.client.NonceAt(ctx, m.account, nil)
+	if err != nil {
+		return NonceStatus{}, err
+	}
+	pending, err := m.client.PendingNonceAt(ctx, m.account)
+	if err != nil {
+		return NonceStatus{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.synced {
+		m.restoreLocked()
+		m.synced = true
+	}
+	if m.advanceLocked(pending) {
+		m.saveLocked()
+	}
+	return NonceStatus{Latest: latest, Pending: pending, Next: m.next}, nil
+}
+
+// Gap returns the lowest nonce the node is missing although the manager
+// handed out a higher one. The node cannot mine any later transaction until
+// the gap is filled. The nonce is held like one from Acquire.
+//
+// A gap is only reported once the node has mined everything it can, i.e. its
+// pending nonce is its latest one. Until then the missing transaction may
+// just not have reached it yet.
+func (m *NonceManager) Gap(ctx context.Context) (uint64, bool, error) {
+	status, err := m.Status(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Below Next the latest nonce is missing, unless it is being sent right now
+	if status.Pending != status.Latest || status.Latest >= m.next || m.held[status.Latest] {
+		return 0, false, nil
+	}
+	if len(m.released) > 0 && m.released[0] == status.Latest {
+		m.released = m.released[1:]
+	}
+	m.held[status.Latest] = true
+	return status.Latest, true, nil
+}
+
+func (m *NonceManager) saveLocked() {
+	if m.store == nil {
+		return
+	}
+	state := NonceState{Account: m.account, Next: m.next, Released: m.released}
+	if err := m.store.Save(state); err != nil {
+		log.WithError(err).WithField("address", m.account).Error("Failed to persist nonces")
+	}
+}
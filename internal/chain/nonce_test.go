@@ -0,0 +1,204 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func newNonceTestBuilder(t *testing.T, store NonceStore) (*TxBuild, *backends.SimulatedBackend) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	simClient := backends.NewSimulatedBackend(
+		core.GenesisAlloc{
+			fromAddress: {Balance: big.NewInt(params.Ether)},
+		}, 10000000,
+	)
+	t.Cleanup(func() { simClient.Close() })
+	baseFee := big.NewInt(params.InitialBaseFee)
+	return &TxBuild{
+		client:      simClient,
+		privateKey:  privateKey,
+		signer:      types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress: fromAddress,
+		nonces:      NewNonceManager(simClient, fromAddress, store),
+		gas:         fixedGas{GasParams{Limit: 21000, BaseFee: baseFee, TipCap: big.NewInt(1), FeeCap: new(big.Int).Mul(baseFee, big.NewInt(2))}},
+	}, simClient
+}
+
+func acquire(t *testing.T, m *NonceManager) uint64 {
+	nonce, err := m.Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nonce
+}
+
+func TestNonceManagerRelease(t *testing.T) {
+	txBuilder, _ := newNonceTestBuilder(t, nil)
+	m := txBuilder.nonces
+
+	for want := uint64(0); want < 3; want++ {
+		if got := acquire(t, m); got != want {
+			t.Fatalf("Acquire() = %d, want %d", got, want)
+		}
+	}
+	m.Release(1)
+	if got := acquire(t, m); got != 1 {
+		t.Errorf("Acquire() after Release(1) = %d, want the released 1", got)
+	}
+	if got := acquire(t, m); got != 3 {
+		t.Errorf("Acquire() = %d, want 3", got)
+	}
+	// Releasing the highest nonces hands them out again in order
+	m.Release(3)
+	m.Release(2)
+	if m.next != 2 || len(m.released) != 0 {
+		t.Errorf("next = %d, released = %v, want 2 and none", m.next, m.released)
+	}
+	// A nonce that was sent cannot be released
+	m.Sent(1)
+	m.Release(1)
+	if len(m.released) != 0 {
+		t.Errorf("released = %v after releasing a sent nonce", m.released)
+	}
+}
+
+func TestNonceGaps(t *testing.T) {
+	txBuilder, simClient := newNonceTestBuilder(t, nil)
+	ctx := context.Background()
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+
+	if _, err := txBuilder.Transfer(ctx, recipient.Hex(), big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+	status, err := txBuilder.nonces.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != (NonceStatus{Latest: 0, Pending: 1, Next: 1}) {
+		t.Errorf("Status() = %+v before the block is mined", status)
+	}
+
+	// A transaction that got nonce 1 and was dropped by the node
+	lost := acquire(t, txBuilder.nonces)
+	txBuilder.nonces.Sent(lost)
+	// Nonce 1 may still be on its way while the node has nonce 0 pending
+	if _, found, err := txBuilder.nonces.Gap(ctx); err != nil || found {
+		t.Fatalf("Gap() = %v, %v while the node has pending transactions", found, err)
+	}
+	simClient.Commit()
+	if status, err := txBuilder.nonces.Status(ctx); err != nil || status.Latest != lost || status.Pending != lost || status.Next != lost+1 {
+		t.Fatalf("Status() = %+v, %v, want the node to miss nonce %d", status, err, lost)
+	}
+
+	filled, err := txBuilder.FillNonceGaps(ctx)
+	if err != nil || filled != 1 {
+		t.Fatalf("FillNonceGaps() = %d, %v, want 1 gap filled", filled, err)
+	}
+	simClient.Commit()
+	if _, found, _ := txBuilder.nonces.Gap(ctx); found {
+		t.Error("Gap() found a gap after it was filled")
+	}
+
+	// Later transactions are mined again
+	if _, err := txBuilder.Transfer(ctx, recipient.Hex(), big.NewInt(1000)); err != nil {
+		t.Fatal(err)
+	}
+	simClient.Commit()
+	nonce, err := simClient.NonceAt(ctx, txBuilder.fromAddress, nil)
+	if err != nil || nonce != 3 {
+		t.Errorf("account nonce = %d, %v, want 3", nonce, err)
+	}
+	balance, err := simClient.BalanceAt(ctx, recipient, nil)
+	if err != nil || balance.Cmp(big.NewInt(2000)) != 0 {
+		t.Errorf("recipient balance = %v, %v, want 2000", balance, err)
+	}
+}
+
+func TestNonceManagerPersistence(t *testing.T) {
+	store := NewFileNonceStore(filepath.Join(t.TempDir(), "nonces", "sepolia.json"))
+	txBuilder, simClient := newNonceTestBuilder(t, store)
+	for i := 0; i < 3; i++ {
+		acquire(t, txBuilder.nonces)
+	}
+	txBuilder.nonces.Release(0)
+
+	state, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &NonceState{Account: txBuilder.fromAddress, Next: 3, Released: []uint64{0}}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("persisted state = %+v, want %+v", state, want)
+	}
+
+	// After a restart the released nonce is handed out first, and nonce 2
+	// is not handed out again although the node never saw it
+	restarted := NewNonceManager(simClient, txBuilder.fromAddress, store)
+	if got := acquire(t, restarted); got != 0 {
+		t.Errorf("Acquire() after restart = %d, want 0", got)
+	}
+	if got := acquire(t, restarted); got != 3 {
+		t.Errorf("Acquire() after restart = %d, want 3", got)
+	}
+
+	// The state of another account is ignored
+	other := NewNonceManager(simClient, common.HexToAddress("0x00000000000000000000000000000000000000aa"), store)
+	if got := acquire(t, other); got != 0 {
+		t.Errorf("Acquire() for another account = %d, want 0", got)
+	}
+}
+
+// countingNonceStore counts the saves of the nonce state
+type countingNonceStore struct {
+	saves int
+}
+
+func (s *countingNonceStore) Load() (*NonceState, error) {
+	return nil, nil
+}
+
+func (s *countingNonceStore) Save(state NonceState) error {
+	s.saves++
+	return nil
+}
+
+func TestNonceManagerSaves(t *testing.T) {
+	store := &countingNonceStore{}
+	txBuilder, _ := newNonceTestBuilder(t, store)
+	m := txBuilder.nonces
+	ctx := context.Background()
+
+	steps := []struct {
+		name      string
+		do        func()
+		wantSaves int
+	}{
+		{name: "new nonce", do: func() { acquire(t, m) }, wantSaves: 1},
+		{name: "another new nonce", do: func() { acquire(t, m) }, wantSaves: 2},
+		{name: "release", do: func() { m.Release(0) }, wantSaves: 3},
+		{name: "released nonce handed out again", do: func() { acquire(t, m) }, wantSaves: 3},
+		{name: "sent", do: func() { m.Sent(0) }, wantSaves: 3},
+		{name: "status without changes", do: func() {
+			if _, err := m.Status(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}, wantSaves: 3},
+	}
+	for _, step := range steps {
+		step.do()
+		if store.saves != step.wantSaves {
+			t.Fatalf("after %s saves = %d, want %d", step.name, store.saves, step.wantSaves)
+		}
+	}
+}
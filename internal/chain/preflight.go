@@ -0,0 +1,90 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Errors of transactions that cannot succeed, returned before they are sent
+var (
+	// ErrInsufficientFaucetFunds is returned when the faucet account cannot
+	// pay the value and the maximum fee of a transaction
+	ErrInsufficientFaucetFunds = errors.New("insufficient faucet funds")
+	// ErrRecipientReverts is returned when the recipient, a contract, reverts
+	// the transfer or needs more gas than the transaction has
+	ErrRecipientReverts = errors.New("recipient reverts the transfer")
+	// ErrFeeCapBelowBaseFee is returned when the fee cap of a transaction
+	// does not cover the base fee of the latest block
+	ErrFeeCapBelowBaseFee = errors.New("fee cap below base fee")
+)
+
+// BalanceReader is implemented by clients that can read account balances
+type BalanceReader interface {
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// preflight checks that a priced transaction can succeed before it gets a
+// nonce, so that it fails with a typed error instead of a cryptic one from the
+// RPC, and without leaving a gap in the nonces. The balance check needs a
+// BalanceReader and the simulation an ethereum.ContractCaller.
+func (b *TxBuild) preflight(ctx context.Context, msg ethereum.CallMsg, params *GasParams) error {
+	ctx, span := tracer.Start(ctx, "preflight")
+	defer span.End()
+
+	if params.Dynamic() && params.FeeCap.Cmp(params.BaseFee) < 0 {
+		return fmt.Errorf("%w: fee cap %s, base fee %s", ErrFeeCapBelowBaseFee, params.FeeCap, params.BaseFee)
+	}
+
+	if reader, ok := b.client.(BalanceReader); ok {
+		balance, err := reader.BalanceAt(ctx, b.fromAddress, nil)
+		if err != nil {
+			return fmt.Errorf("failed to get the faucet balance: %w", err)
+		}
+		cost := params.MaxCost()
+		if msg.Value != nil {
+			cost.Add(cost, msg.Value)
+		}
+		if balance.Cmp(cost) < 0 {
+			return fmt.Errorf("%w: balance %s, value and fees up to %s", ErrInsufficientFaucetFunds, balance, cost)
+		}
+	}
+
+	// The node checks the fees against the base fee and the balance, and runs
+	// the recipient with the gas limit of the transaction
+	if caller, ok := b.client.(ethereum.ContractCaller); ok {
+		msg.Gas = params.Limit
+		if params.Dynamic() {
+			msg.GasFeeCap, msg.GasTipCap = params.FeeCap, params.TipCap
+		} else {
+			msg.GasPrice = params.GasPrice
+		}
+		if _, err := caller.CallContract(ctx, msg, nil); err != nil {
+			return fmt.Errorf("simulation failed: %w", classifyError(err))
+		}
+	}
+	return nil
+}
+
+// classifyError wraps the errors nodes return for transactions that cannot
+// succeed in the typed error they stand for. Other errors are returned as is.
+func classifyError(err error) error {
+	if err == nil || errors.Is(err, ErrInsufficientFaucetFunds) || errors.Is(err, ErrRecipientReverts) || errors.Is(err, ErrFeeCapBelowBaseFee) {
+		return err
+	}
+	message := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(message, "insufficient funds"):
+		return fmt.Errorf("%w: %v", ErrInsufficientFaucetFunds, err)
+	case strings.Contains(message, "less than block base fee"):
+		return fmt.Errorf("%w: %v", ErrFeeCapBelowBaseFee, err)
+	case strings.Contains(message, "revert"), strings.Contains(message, "out of gas"):
+		return fmt.Errorf("%w: %v", ErrRecipientReverts, err)
+	}
+	return err
+}
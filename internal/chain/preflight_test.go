@@ -0,0 +1,101 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// fixedGas prices every transaction with params
+type fixedGas struct {
+	params GasParams
+}
+
+func (g fixedGas) Gas(ctx context.Context, client GasClient, msg ethereum.CallMsg) (*GasParams, error) {
+	params := g.params
+	return &params, nil
+}
+
+func TestPreflight(t *testing.T) {
+	privateKey, _ := crypto.HexToECDSA("976f9f7772781ff6d1c93941129d417c49a209c674056a3cf5e27e225ee55fa8")
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
+	recipient := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
+	// A contract that reverts whenever it receives ether
+	reverter := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	baseFee := big.NewInt(params.InitialBaseFee)
+	priced := GasParams{Limit: 21000, BaseFee: baseFee, TipCap: big.NewInt(1), FeeCap: new(big.Int).Mul(baseFee, big.NewInt(2))}
+	stale := GasParams{Limit: 21000, BaseFee: big.NewInt(1), TipCap: big.NewInt(1), FeeCap: big.NewInt(1)}
+
+	tests := []struct {
+		name    string
+		balance *big.Int
+		to      common.Address
+		gas     GasParams
+		wantErr error
+	}{
+		{name: "ok", balance: big.NewInt(params.Ether), to: recipient, gas: priced},
+		{name: "underfunded", balance: big.NewInt(1000), to: recipient, gas: priced, wantErr: ErrInsufficientFaucetFunds},
+		{name: "reverting recipient", balance: big.NewInt(params.Ether), to: reverter, gas: GasParams{Limit: 50000, BaseFee: baseFee, TipCap: big.NewInt(1), FeeCap: priced.FeeCap}, wantErr: ErrRecipientReverts},
+		{name: "base fee rose since pricing", balance: big.NewInt(params.Ether), to: recipient, gas: stale, wantErr: ErrFeeCapBelowBaseFee},
+		{name: "fee cap below base fee", balance: big.NewInt(params.Ether), to: recipient, gas: GasParams{Limit: 21000, BaseFee: baseFee, TipCap: big.NewInt(1), FeeCap: big.NewInt(1)}, wantErr: ErrFeeCapBelowBaseFee},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simClient := backends.NewSimulatedBackend(
+				core.GenesisAlloc{
+					fromAddress: {Balance: tt.balance},
+					reverter:    {Balance: new(big.Int), Code: common.FromHex("600080fd")},
+				}, 10000000,
+			)
+			defer simClient.Close()
+			txBuilder := &TxBuild{
+				client:      simClient,
+				privateKey:  privateKey,
+				signer:      types.NewLondonSigner(big.NewInt(1337)),
+				fromAddress: fromAddress,
+				nonces:      NewNonceManager(simClient, fromAddress, nil),
+				gas:         fixedGas{tt.gas},
+			}
+
+			_, err := txBuilder.Transfer(context.Background(), tt.to.Hex(), big.NewInt(1000))
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil) != (err == nil) {
+				t.Fatalf("Transfer() error = %v, want %v", err, tt.wantErr)
+			}
+			// A transaction refused before sending must not use up a nonce
+			wantNonce := uint64(0)
+			if tt.wantErr == nil {
+				wantNonce = 1
+			}
+			if txBuilder.nonces.next != wantNonce {
+				t.Errorf("nonce = %d, want %d", txBuilder.nonces.next, wantNonce)
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{err: errors.New("insufficient funds for gas * price + value"), want: ErrInsufficientFaucetFunds},
+		{err: errors.New("execution reverted"), want: ErrRecipientReverts},
+		{err: errors.New("max fee per gas less than block base fee: address 0x0, maxFeePerGas: 1 baseFee: 7"), want: ErrFeeCapBelowBaseFee},
+		{err: errors.New("connection refused"), want: nil},
+	}
+	for _, tt := range tests {
+		got := classifyError(tt.err)
+		if tt.want == nil && got != tt.err || tt.want != nil && !errors.Is(got, tt.want) {
+			t.Errorf("classifyError(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// ProviderInfo is what a JSON-RPC provider reports about the chain and a faucet account
+type ProviderInfo struct {
+	ChainID         *big.Int
+	SupportsEIP1559 bool
+	GasPrice        *big.Int
+	Balance         *big.Int
+}
+
+// Probe connects to provider and reads the chain ID, fee market, gas price
+// and the balance of account
+func Probe(ctx context.Context, provider string, account common.Address) (*ProviderInfo, error) {
+	client, err := ethclient.DialContext(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	info := &ProviderInfo{}
+	if info.ChainID, err = client.ChainID(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get chain ID: %w", err)
+	}
+	if info.SupportsEIP1559, err = checkEIP1559Support(ctx, client); err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	if info.GasPrice, err = client.SuggestGasPrice(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get gas price: %w", err)
+	}
+	if info.Balance, err = client.BalanceAt(ctx, account, nil); err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return info, nil
+}
+
+// StatusReader is the part of the JSON-RPC API readiness checks use
+type StatusReader interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error)
+}
+
+// NewStatusReader connects to provider to check the status of its chain
+func NewStatusReader(provider string) (StatusReader, error) {
+	return ethclient.Dial(provider)
+}
+
+// ChainStatus is the latest block of a chain and the balance of a faucet account
+type ChainStatus struct {
+	BlockNumber uint64
+	BlockTime   time.Time
+	Balance     *big.Int
+}
+
+// ReadStatus reads the latest block and the balance of account
+func ReadStatus(ctx context.Context, reader StatusReader, account common.Address) (*ChainStatus, error) {
+	head, err := reader.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest block: %w", err)
+	}
+	balance, err := reader.BalanceAt(ctx, account, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return &ChainStatus{
+		BlockNumber: head.Number.Uint64(),
+		BlockTime:   time.Unix(int64(head.Time), 0),
+		Balance:     balance,
+	}, nil
+}
@@ -0,0 +1,41 @@
+package chain
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// TxTrace holds hooks that are called while a transaction is sent, in the
+// spirit of net/http/httptrace
+type TxTrace struct {
+	// Signed is called with the hash of the transaction once it is signed
+	// and about to be broadcast
+	Signed func(txHash common.Hash)
+}
+
+type txTraceKey struct{}
+
+// WithTxTrace returns a context that makes TxBuilder calls report to trace
+func WithTxTrace(ctx context.Context, trace *TxTrace) context.Context {
+	return context.WithValue(ctx, txTraceKey{}, trace)
+}
+
+// ContextTxTrace returns the TxTrace associated with ctx, if any
+func ContextTxTrace(ctx context.Context) *TxTrace {
+	trace, _ := ctx.Value(txTraceKey{}).(*TxTrace)
+	return trace
+}
+
+// TxStatus is the on-chain state of a sent transaction
+type TxStatus struct {
+	Mined         bool
+	Successful    bool
+	BlockNumber   uint64
+	Confirmations uint64
+}
+
+// TxWatcher reports the on-chain state of sent transactions
+type TxWatcher interface {
+	TxStatus(ctx context.Context, txHash common.Hash) (*TxStatus, error)
+}
@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/guyuxiang/multi-chain-faucet/internal/chain")
+
+// tracedClient reports every JSON-RPC call of a TxBuild as a client span
+// named after the RPC method. Besides Client it implements the optional
+// interfaces gas strategies look for.
+type tracedClient struct {
+	client  *ethclient.Client
+	chainID int64
+}
+
+func newTracedClient(client *ethclient.Client, chainID *big.Int) *tracedClient {
+	return &tracedClient{client: client, chainID: chainID.Int64()}
+}
+
+// start starts the span of an RPC call, end has to be called with its error
+func (c *tracedClient) start(ctx context.Context, method string) (context.Context, func(error)) {
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("rpc.system", "jsonrpc"),
+		attribute.String("rpc.method", method),
+		attribute.Int64("chain.id", c.chainID),
+	))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+func (c *tracedClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	ctx, end := c.start(ctx, "eth_getBlockByNumber")
+	header, err := c.client.HeaderByNumber(ctx, number)
+	end(err)
+	return header, err
+}
+
+func (c *tracedClient) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	ctx, end := c.start(ctx, "eth_getCode")
+	code, err := c.client.PendingCodeAt(ctx, account)
+	end(err)
+	return code, err
+}
+
+func (c *tracedClient) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	ctx, end := c.start(ctx, "eth_getCode")
+	code, err := c.client.CodeAt(ctx, account, blockNumber)
+	end(err)
+	return code, err
+}
+
+func (c *tracedClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	ctx, end := c.start(ctx, "eth_getTransactionCount")
+	nonce, err := c.client.PendingNonceAt(ctx, account)
+	end(err)
+	return nonce, err
+}
+
+func (c *tracedClient) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	ctx, end := c.start(ctx, "eth_getBalance")
+	balance, err := c.client.BalanceAt(ctx, account, blockNumber)
+	end(err)
+	return balance, err
+}
+
+func (c *tracedClient) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	ctx, end := c.start(ctx, "eth_getTransactionCount")
+	nonce, err := c.client.NonceAt(ctx, account, blockNumber)
+	end(err)
+	return nonce, err
+}
+
+func (c *tracedClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	ctx, end := c.start(ctx, "eth_gasPrice")
+	price, err := c.client.SuggestGasPrice(ctx)
+	end(err)
+	return price, err
+}
+
+func (c *tracedClient) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	ctx, end := c.start(ctx, "eth_maxPriorityFeePerGas")
+	tip, err := c.client.SuggestGasTipCap(ctx)
+	end(err)
+	return tip, err
+}
+
+func (c *tracedClient) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	ctx, end := c.start(ctx, "eth_feeHistory")
+	history, err := c.client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+	end(err)
+	return history, err
+}
+
+func (c *tracedClient) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	ctx, end := c.start(ctx, "eth_estimateGas")
+	gas, err := c.client.EstimateGas(ctx, call)
+	end(err)
+	return gas, err
+}
+
+func (c *tracedClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	ctx, end := c.start(ctx, "eth_call")
+	result, err := c.client.CallContract(ctx, call, blockNumber)
+	end(err)
+	return result, err
+}
+
+func (c *tracedClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	ctx, end := c.start(ctx, "eth_sendRawTransaction")
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tx.hash", tx.Hash().Hex()), attribute.Int64("tx.nonce", int64(tx.Nonce())))
+	err := c.client.SendTransaction(ctx, tx)
+	end(err)
+	return err
+}
+
+func (c *tracedClient) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	ctx, end := c.start(ctx, "eth_getTransactionReceipt")
+	receipt, err := c.client.TransactionReceipt(ctx, txHash)
+	// A receipt that is not there yet is no failure of the call
+	if errors.Is(err, ethereum.NotFound) {
+		end(nil)
+	} else {
+		end(err)
+	}
+	return receipt, err
+}
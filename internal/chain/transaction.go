@@ -3,33 +3,59 @@ package chain
 import (
 	"context"
 	"crypto/ecdsa"
+	"errors"
+	"fmt"
 	"math/big"
 	"strings"
-	"sync/atomic"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrBroadcastUnknown is returned with the hash of a signed transaction
+// when sending it failed without an answer of the node, e.g. on a timeout.
+// The transaction may still be mined.
+var ErrBroadcastUnknown = errors.New("transaction may have been broadcast")
+
 type TxBuilder interface {
 	Sender() common.Address
 	Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error)
 }
 
+// Client is the part of the JSON-RPC API used to build, send and track transactions
+type Client interface {
+	bind.ContractTransactor
+	bind.DeployBackend
+	NonceClient
+}
+
 type TxBuild struct {
-	client          bind.ContractTransactor
-	privateKey      *ecdsa.PrivateKey
-	signer          types.Signer
-	fromAddress     common.Address
-	nonce           uint64
-	supportsEIP1559 bool
+	client      Client
+	privateKey  *ecdsa.PrivateKey
+	signer      types.Signer
+	fromAddress common.Address
+	nonces      *NonceManager
+	gas         GasStrategy
+}
+
+// NonceGapFiller is implemented by builders that can fill gaps in the nonces
+// of their account
+type NonceGapFiller interface {
+	FillNonceGaps(ctx context.Context) (int, error)
 }
 
-func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.Int) (TxBuilder, error) {
+// NewTxBuilder connects to provider. Transactions are priced by gas, or by
+// DefaultGas when gas is nil. Nonces are persisted to nonces unless it is nil.
+func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.Int, gas GasStrategy, nonces NonceStore) (TxBuilder, error) {
 	client, err := ethclient.Dial(provider)
 	if err != nil {
 		return nil, err
@@ -42,21 +68,33 @@ func NewTxBuilder(provider string, privateKey *ecdsa.PrivateKey, chainID *big.In
 		}
 	}
 
-	supportsEIP1559, err := checkEIP1559Support(client)
-	if err != nil {
-		return nil, err
+	return NewTxBuilderWithClient(newTracedClient(client, chainID), privateKey, chainID, gas, nonces), nil
+}
+
+// NewTxBuilderWithClient builds transactions for chainID and sends them
+// through client, e.g. a simulated backend
+func NewTxBuilderWithClient(client Client, privateKey *ecdsa.PrivateKey, chainID *big.Int, gas GasStrategy, nonces NonceStore) TxBuilder {
+	if gas == nil {
+		gas = DefaultGas{}
 	}
 
+	fromAddress := crypto.PubkeyToAddress(privateKey.PublicKey)
 	txBuilder := &TxBuild{
-		client:          client,
-		privateKey:      privateKey,
-		signer:          types.NewLondonSigner(chainID),
-		fromAddress:     crypto.PubkeyToAddress(privateKey.PublicKey),
-		supportsEIP1559: supportsEIP1559,
+		client:      client,
+		privateKey:  privateKey,
+		signer:      types.NewLondonSigner(chainID),
+		fromAddress: fromAddress,
+		nonces:      NewNonceManager(client, fromAddress, nonces),
+		gas:         gas,
+	}
+	if err := txBuilder.nonces.Sync(context.Background()); err != nil {
+		log.WithFields(log.Fields{
+			"address": fromAddress,
+			"error":   err,
+		}).Error("failed to refresh account nonce")
 	}
-	txBuilder.refreshNonce(context.Background())
 
-	return txBuilder, nil
+	return txBuilder
 }
 
 func (b *TxBuild) Sender() common.Address {
@@ -64,98 +102,198 @@ func (b *TxBuild) Sender() common.Address {
 }
 
 func (b *TxBuild) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
-	gasLimit := uint64(23100)
 	toAddress := common.HexToAddress(to)
-	nonce := b.getAndIncrementNonce()
+	return b.send(ctx, &toAddress, value, nil)
+}
 
-	var err error
-	var unsignedTx *types.Transaction
+func (b *TxBuild) send(ctx context.Context, to *common.Address, value *big.Int, data []byte) (txHash common.Hash, err error) {
+	ctx, span := tracer.Start(ctx, "send transaction", trace.WithAttributes(attribute.String("tx.from", b.fromAddress.Hex())))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
 
-	if b.supportsEIP1559 {
-		unsignedTx, err = b.buildEIP1559Tx(ctx, &toAddress, value, gasLimit, nonce)
-	} else {
-		unsignedTx, err = b.buildLegacyTx(ctx, &toAddress, value, gasLimit, nonce)
+	msg := ethereum.CallMsg{
+		From:  b.fromAddress,
+		To:    to,
+		Value: value,
+		Data:  data,
 	}
-
+	params, err := b.price(ctx, msg)
 	if err != nil {
 		return common.Hash{}, err
 	}
 
-	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
+	nonce, err := b.nonces.Acquire(ctx)
 	if err != nil {
 		return common.Hash{}, err
 	}
-
-	if err = b.client.SendTransaction(ctx, signedTx); err != nil {
-		if strings.Contains(strings.ToLower(err.Error()), "nonce") {
-			b.refreshNonce(context.Background())
-		}
-		return common.Hash{}, err
-	}
-
-	return signedTx.Hash(), nil
+	return b.broadcast(ctx, params, nonce, msg)
 }
 
-func (b *TxBuild) buildEIP1559Tx(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
-	header, err := b.client.HeaderByNumber(ctx, nil)
+// price decides the gas of a transaction and checks that it can succeed
+func (b *TxBuild) price(ctx context.Context, msg ethereum.CallMsg) (*GasParams, error) {
+	params, err := b.gas.Gas(ctx, b.client, msg)
 	if err != nil {
+		return nil, classifyError(err)
+	}
+	log.WithFields(log.Fields{
+		"gas":     params.Limit,
+		"l1Fee":   params.L1Fee,
+		"maxCost": params.MaxCost(),
+	}).Debug("Priced transaction")
+	if err := b.preflight(ctx, msg, params); err != nil {
 		return nil, err
 	}
+	return params, nil
+}
 
-	gasTipCap, err := b.client.SuggestGasTipCap(ctx)
+// broadcast signs and sends a transaction with a held nonce. The nonce is
+// released when the node refused the transaction, so that it is not left as
+// a gap. When the node did not answer, the hash is returned together with
+// ErrBroadcastUnknown.
+func (b *TxBuild) broadcast(ctx context.Context, params *GasParams, nonce uint64, msg ethereum.CallMsg) (common.Hash, error) {
+	unsignedTx := newTx(params, b.signer.ChainID(), nonce, msg.To, msg.Value, msg.Data)
+	signedTx, err := types.SignTx(unsignedTx, b.signer, b.privateKey)
 	if err != nil {
-		return nil, err
+		b.nonces.Release(nonce)
+		return common.Hash{}, err
+	}
+	if trace := ContextTxTrace(ctx); trace != nil && trace.Signed != nil {
+		trace.Signed(signedTx.Hash())
 	}
 
-	// gasFeeCap = baseFee * 2 + gasTipCap
-	gasFeeCap := new(big.Int).Mul(header.BaseFee, big.NewInt(2))
-	gasFeeCap = new(big.Int).Add(gasFeeCap, gasTipCap)
+	err = b.client.SendTransaction(ctx, signedTx)
+	switch {
+	case err == nil || alreadyKnown(err):
+		b.nonces.Sent(nonce)
+		return signedTx.Hash(), nil
+	case nonceTaken(err):
+		// The nonce is used by another transaction, take the node's
+		b.nonces.Sent(nonce)
+		if err := b.nonces.Sync(context.Background()); err != nil {
+			log.WithFields(log.Fields{
+				"address": b.Sender(),
+				"error":   err,
+			}).Error("failed to refresh account nonce")
+		}
+		return common.Hash{}, classifyError(err)
+	case rejected(err):
+		b.nonces.Release(nonce)
+		return common.Hash{}, classifyError(err)
+	default:
+		// The node may have taken the transaction before the call failed,
+		// e.g. on a timeout, so the nonce is kept
+		b.nonces.Sent(nonce)
+		return signedTx.Hash(), fmt.Errorf("%w: %v", ErrBroadcastUnknown, err)
+	}
+}
 
-	return types.NewTx(&types.DynamicFeeTx{
-		ChainID:   b.signer.ChainID(),
-		Nonce:     nonce,
-		GasTipCap: gasTipCap,
-		GasFeeCap: gasFeeCap,
-		Gas:       gasLimit,
-		To:        to,
-		Value:     value,
-	}), nil
+// alreadyKnown reports whether the node already has the transaction
+func alreadyKnown(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
 }
 
-func (b *TxBuild) buildLegacyTx(ctx context.Context, to *common.Address, value *big.Int, gasLimit uint64, nonce uint64) (*types.Transaction, error) {
-	gasPrice, err := b.client.SuggestGasPrice(ctx)
-	if err != nil {
-		return nil, err
-	}
+// nonceTaken reports whether the node refused a transaction because another
+// one has its nonce
+func nonceTaken(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "nonce too low") || strings.Contains(message, "replacement transaction underpriced")
+}
 
-	return types.NewTx(&types.LegacyTx{
-		Nonce:    nonce,
-		GasPrice: gasPrice,
-		Gas:      gasLimit,
-		To:       to,
-		Value:    value,
-	}), nil
+// rejections are parts of the errors nodes refuse invalid transactions with
+var rejections = []string{
+	"insufficient funds",
+	"less than block base fee",
+	"intrinsic gas too low",
+	"exceeds block gas limit",
+	"underpriced",
+	"nonce too high",
+	"invalid sender",
+	"invalid transaction",
+	"tip higher than",
+	"oversized data",
+	"txpool is full",
+	"exceeds the configured cap",
 }
 
-func (b *TxBuild) getAndIncrementNonce() uint64 {
-	return atomic.AddUint64(&b.nonce, 1) - 1
+// rejected reports whether the node answered that it refuses a transaction,
+// as opposed to failing before it could answer
+func rejected(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, rejection := range rejections {
+		if strings.Contains(message, rejection) {
+			return true
+		}
+	}
+	return false
 }
 
-func (b *TxBuild) refreshNonce(ctx context.Context) {
-	nonce, err := b.client.PendingNonceAt(ctx, b.Sender())
-	if err != nil {
+// FillNonceGaps sends a zero-value transfer to the faucet account itself for
+// every nonce the node is missing, which would otherwise block all later
+// transactions. It returns how many gaps were filled.
+func (b *TxBuild) FillNonceGaps(ctx context.Context) (int, error) {
+	filled := 0
+	for {
+		nonce, found, err := b.nonces.Gap(ctx)
+		if err != nil || !found {
+			return filled, err
+		}
+		msg := ethereum.CallMsg{From: b.fromAddress, To: &b.fromAddress, Value: new(big.Int)}
+		params, err := b.price(ctx, msg)
+		if err != nil {
+			b.nonces.Release(nonce)
+			return filled, err
+		}
+		txHash, err := b.broadcast(ctx, params, nonce, msg)
+		if err != nil {
+			return filled, err
+		}
 		log.WithFields(log.Fields{
-			"address": b.Sender(),
-			"error":   err,
-		}).Error("failed to refresh account nonce")
-		return
+			"address": b.fromAddress,
+			"nonce":   nonce,
+			"txHash":  txHash,
+		}).Warn("Filled nonce gap with a self-transfer")
+		filled++
+	}
+}
+
+// TxStatus returns whether the transaction is mined and how many blocks confirm it
+func (b *TxBuild) TxStatus(ctx context.Context, txHash common.Hash) (*TxStatus, error) {
+	receipt, err := b.client.TransactionReceipt(ctx, txHash)
+	if errors.Is(err, ethereum.NotFound) {
+		return &TxStatus{}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	atomic.StoreUint64(&b.nonce, nonce)
+	header, err := b.client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &TxStatus{
+		Mined:       true,
+		Successful:  receipt.Status == types.ReceiptStatusSuccessful,
+		BlockNumber: receipt.BlockNumber.Uint64(),
+	}
+	if latest := header.Number.Uint64(); latest >= status.BlockNumber {
+		status.Confirmations = latest - status.BlockNumber + 1
+	}
+	return status, nil
 }
 
-func checkEIP1559Support(client *ethclient.Client) (bool, error) {
-	header, err := client.HeaderByNumber(context.Background(), nil)
+func checkEIP1559Support(ctx context.Context, client ethereum.ChainReader) (bool, error) {
+	header, err := client.HeaderByNumber(ctx, nil)
 	if err != nil {
 		return false, err
 	}
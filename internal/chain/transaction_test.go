@@ -2,6 +2,7 @@ package chain
 
 import (
 	"context"
+	"errors"
 	"math/big"
 	"reflect"
 	"testing"
@@ -30,11 +31,12 @@ func TestTxBuilder(t *testing.T) {
 	defer patches.Reset()
 
 	txBuilder := &TxBuild{
-		client:          simClient,
-		privateKey:      privateKey,
-		signer:          types.NewLondonSigner(big.NewInt(1337)),
-		fromAddress:     crypto.PubkeyToAddress(privateKey.PublicKey),
-		supportsEIP1559: false,
+		client:      simClient,
+		privateKey:  privateKey,
+		signer:      types.NewLondonSigner(big.NewInt(1337)),
+		fromAddress: crypto.PubkeyToAddress(privateKey.PublicKey),
+		nonces:      NewNonceManager(simClient, fromAddress, nil),
+		gas:         DefaultGas{},
 	}
 	bgCtx := context.Background()
 	toAddress := common.HexToAddress("0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B")
@@ -61,3 +63,83 @@ func TestTxBuilder(t *testing.T) {
 		t.Errorf("expected balance for to address not received. expected: %v actual: %v", value, bal)
 	}
 }
+
+// sendErrClient fails SendTransaction with err, after passing the
+// transaction on to the backend when forward is set
+type sendErrClient struct {
+	*backends.SimulatedBackend
+	forward bool
+	err     error
+}
+
+func (c *sendErrClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if c.forward {
+		if err := c.SimulatedBackend.SendTransaction(ctx, tx); err != nil {
+			return err
+		}
+	}
+	return c.err
+}
+
+// jsonRPCError is an error answer of a node
+type jsonRPCError struct {
+	message string
+}
+
+func (e jsonRPCError) Error() string  { return e.message }
+func (e jsonRPCError) ErrorCode() int { return -32000 }
+
+func TestBroadcastErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		forward   bool
+		err       error
+		wantHash  bool
+		wantErr   error
+		wantNonce uint64
+	}{
+		{name: "already known", forward: true, err: jsonRPCError{"already known"}, wantHash: true, wantNonce: 1},
+		{name: "timeout", forward: true, err: context.DeadlineExceeded, wantHash: true, wantErr: ErrBroadcastUnknown, wantNonce: 1},
+		{name: "connection reset", err: errors.New("read tcp 127.0.0.1:8545: connection reset by peer"), wantHash: true, wantErr: ErrBroadcastUnknown, wantNonce: 1},
+		{name: "rejected by the node", err: jsonRPCError{"intrinsic gas too low"}, wantNonce: 0},
+		{name: "nonce too high", err: errors.New("nonce too high"), wantNonce: 0},
+		{name: "insufficient funds", err: errors.New("insufficient funds for gas * price + value"), wantErr: ErrInsufficientFaucetFunds, wantNonce: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txBuilder, simClient := newNonceTestBuilder(t, nil)
+			client := &sendErrClient{SimulatedBackend: simClient, forward: tt.forward, err: tt.err}
+			txBuilder.client = client
+
+			txHash, err := txBuilder.Transfer(context.Background(), "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B", big.NewInt(1000))
+			wantFail := tt.wantErr != nil || !tt.wantHash
+			if (err != nil) != wantFail || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transfer() error = %v, want %v", err, tt.wantErr)
+			}
+			if (txHash != common.Hash{}) != tt.wantHash {
+				t.Errorf("Transfer() hash = %s, want a hash %v", txHash, tt.wantHash)
+			}
+			// A nonce the node may have is not handed out again
+			if got := acquire(t, txBuilder.nonces); got != tt.wantNonce {
+				t.Errorf("next nonce = %d, want %d", got, tt.wantNonce)
+			}
+		})
+	}
+}
+
+func TestNonceTaken(t *testing.T) {
+	tests := []struct {
+		err  string
+		want bool
+	}{
+		{err: "nonce too low", want: true},
+		{err: "replacement transaction underpriced", want: true},
+		{err: "nonce too high", want: false},
+		{err: "already known", want: false},
+	}
+	for _, tt := range tests {
+		if got := nonceTaken(errors.New(tt.err)); got != tt.want {
+			t.Errorf("nonceTaken(%q) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,17 +1,30 @@
 package chain
 
 import (
+	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/shopspring/decimal"
 )
 
-func EtherToWei(amount float64) *big.Int {
-	oneEther := decimal.NewFromFloat(1e18)
-	result := decimal.NewFromFloat(amount).Mul(oneEther)
-	wei, _ := new(big.Int).SetString(result.String(), 10)
-	return wei
+// DefaultDecimals is the number of decimals of ether and most native assets
+const DefaultDecimals = 18
+
+// ToBaseUnits converts an amount of an asset with the given decimals to its
+// smallest unit, e.g. ether to wei. Amounts with more fractional digits than
+// the asset has cannot be paid exactly and are an error.
+func ToBaseUnits(amount decimal.Decimal, decimals int) (*big.Int, error) {
+	if !amount.Equal(amount.Truncate(int32(decimals))) {
+		return nil, fmt.Errorf("%s has more than %d decimals", amount, decimals)
+	}
+	return amount.Shift(int32(decimals)).BigInt(), nil
+}
+
+// FromBaseUnits converts an amount in the smallest unit of an asset with the
+// given decimals, e.g. wei, to the asset
+func FromBaseUnits(amount *big.Int, decimals int) decimal.Decimal {
+	return decimal.NewFromBigInt(amount, -int32(decimals))
 }
 
 func Has0xPrefix(str string) bool {
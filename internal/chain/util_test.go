@@ -4,6 +4,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/shopspring/decimal"
 )
 
 func TestIsValidAddress(t *testing.T) {
@@ -32,20 +34,33 @@ func TestIsValidAddress(t *testing.T) {
 	}
 }
 
-func TestEtherToWei(t *testing.T) {
+func TestToBaseUnits(t *testing.T) {
 	tests := []struct {
-		name   string
-		amount float64
-		want   *big.Int
+		name     string
+		amount   string
+		decimals int
+		want     *big.Int
+		wantErr  bool
 	}{
-		{name: "0.01ether", amount: 0.01, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(16), nil)},
-		{name: "0.1ether", amount: 0.1, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(17), nil)},
-		{name: "1ether", amount: 1, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+		{name: "0.01ether", amount: "0.01", decimals: 18, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(16), nil)},
+		{name: "0.1ether", amount: "0.1", decimals: 18, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(17), nil)},
+		{name: "1ether", amount: "1", decimals: 18, want: new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)},
+		{name: "every wei", amount: "1.000000000000000001", decimals: 18, want: new(big.Int).Add(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil), big.NewInt(1))},
+		{name: "six decimals", amount: "2.5", decimals: 6, want: big.NewInt(2500000)},
+		{name: "trailing zeros", amount: "0.1000000", decimals: 6, want: big.NewInt(100000)},
+		{name: "too many decimals", amount: "0.0000001", decimals: 6, wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := EtherToWei(tt.amount); !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("EtherToWei() = %v, want %v", got, tt.want)
+			got, err := ToBaseUnits(decimal.RequireFromString(tt.amount), tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ToBaseUnits() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ToBaseUnits() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && !FromBaseUnits(got, tt.decimals).Equal(decimal.RequireFromString(tt.amount)) {
+				t.Errorf("FromBaseUnits() = %v, want %v", FromBaseUnits(got, tt.decimals), tt.amount)
 			}
 		})
 	}
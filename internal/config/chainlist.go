@@ -0,0 +1,205 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChainlistEntry is a chain in the JSON format of chainlist.org and of the
+// ethereum-lists/chains repository
+type ChainlistEntry struct {
+	Name           string `json:"name"`
+	ChainID        int64  `json:"chainId"`
+	NativeCurrency struct {
+		Name     string `json:"name"`
+		Symbol   string `json:"symbol"`
+		Decimals int    `json:"decimals"`
+	} `json:"nativeCurrency"`
+	RPC       []chainlistRPC `json:"rpc"`
+	Explorers []struct {
+		URL      string `json:"url"`
+		Standard string `json:"standard"`
+	} `json:"explorers"`
+	// Status is "active", "incubating" or "deprecated"
+	Status string `json:"status"`
+	// Testnets set isTestnet on chainlist.org and slip44 1 in ethereum-lists
+	IsTestnet bool `json:"isTestnet"`
+	Slip44    int  `json:"slip44"`
+}
+
+// chainlistRPC is an RPC URL, given as a string by ethereum-lists and as an
+// object by chainlist.org
+type chainlistRPC string
+
+func (r *chainlistRPC) UnmarshalJSON(data []byte) error {
+	var url string
+	if err := json.Unmarshal(data, &url); err == nil {
+		*r = chainlistRPC(url)
+		return nil
+	}
+	var rpc struct {
+		URL string `json:"url"`
+	}
+	if err := json.Unmarshal(data, &rpc); err != nil {
+		return err
+	}
+	*r = chainlistRPC(rpc.URL)
+	return nil
+}
+
+// ParseChainlist parses a list of chains, or the file of a single chain as
+// ethereum-lists has them
+func ParseChainlist(data []byte) ([]ChainlistEntry, error) {
+	var entries []ChainlistEntry
+	if err := json.Unmarshal(data, &entries); err == nil {
+		return entries, nil
+	}
+	var entry ChainlistEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return []ChainlistEntry{entry}, nil
+}
+
+// Deprecated reports whether the chain is no longer maintained
+func (e ChainlistEntry) Deprecated() bool {
+	return e.Status == "deprecated"
+}
+
+// NetworkName returns the name a chain is registered under when no built-in
+// network has its chain ID, e.g. ethereum-classic for "Ethereum Classic"
+func (e ChainlistEntry) NetworkName() string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(e.Name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// NetworkConfig converts the chain to a network. RPCs that need an API key,
+// like those with ${INFURA_API_KEY}, and websocket RPCs are skipped.
+func (e ChainlistEntry) NetworkConfig() NetworkConfig {
+	network := NetworkConfig{
+		ChainID:   e.ChainID,
+		Symbol:    e.NativeCurrency.Symbol,
+		Name:      e.Name,
+		IsTestnet: e.IsTestnet || e.Slip44 == 1,
+		Decimals:  e.NativeCurrency.Decimals,
+	}
+	if e.Deprecated() {
+		network.State = NetworkDeprecated
+	}
+	network.CurrencyName = e.NativeCurrency.Name
+	for _, rpc := range e.RPC {
+		url := string(rpc)
+		if strings.HasPrefix(url, "https://") && !strings.Contains(url, "${") {
+			network.DefaultRPC = url
+			network.PublicRPC = url
+			break
+		}
+	}
+
+	// Prefer explorers with the paths of EIP-3091, which TxURL relies on
+	for _, explorer := range e.Explorers {
+		if network.ExplorerTxURL == "" || explorer.Standard == "EIP3091" {
+			base := strings.TrimSuffix(explorer.URL, "/")
+			network.ExplorerTxURL = base + "/tx/{hash}"
+			network.ExplorerAddressURL = base + "/address/{address}"
+			if explorer.Standard == "EIP3091" {
+				break
+			}
+		}
+	}
+	return network
+}
+
+// ChainlistImport is the outcome of importing chains into the registry
+type ChainlistImport struct {
+	// Added are the networks registered by the import
+	Added []string
+	// Updated are the registered networks the import filled in or deprecated
+	Updated []string
+	// Skipped lists why chains were not imported
+	Skipped []string
+}
+
+// ImportChainlist merges chains into the registry of supported networks.
+// Networks with a known chain ID keep their settings: the import only fills
+// in what they do not set and flags them when the chain is deprecated. Other
+// chains are added under their NetworkName, except deprecated ones unless
+// includeDeprecated is set. Without chainIDs every chain is imported. The
+// registry is not locked, so imports have to happen before servers start.
+func ImportChainlist(entries []ChainlistEntry, chainIDs []int64, includeDeprecated bool) ChainlistImport {
+	wanted := make(map[int64]bool, len(chainIDs))
+	for _, id := range chainIDs {
+		wanted[id] = true
+	}
+	byChainID := make(map[int64]string, len(NetworkConfigs))
+	for name, network := range NetworkConfigs {
+		byChainID[network.ChainID] = name
+	}
+
+	var result ChainlistImport
+	for _, entry := range entries {
+		if len(wanted) > 0 && !wanted[entry.ChainID] {
+			continue
+		}
+		imported := entry.NetworkConfig()
+
+		if name, exists := byChainID[entry.ChainID]; exists {
+			// Networks the chainlist adds nothing to are not reported as updated
+			if filled := NetworkConfigs[name].fill(imported); filled != NetworkConfigs[name] {
+				NetworkConfigs[name] = filled
+				result.Updated = append(result.Updated, name)
+			}
+			continue
+		}
+
+		name := entry.NetworkName()
+		switch {
+		case entry.Deprecated() && !includeDeprecated:
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s (chain ID %d) is deprecated", entry.Name, entry.ChainID))
+		case name == "":
+			result.Skipped = append(result.Skipped, fmt.Sprintf("chain ID %d has no name", entry.ChainID))
+		case imported.Symbol == "":
+			result.Skipped = append(result.Skipped, fmt.Sprintf("%s (chain ID %d) has no native currency", entry.Name, entry.ChainID))
+		default:
+			if _, taken := NetworkConfigs[name]; taken {
+				result.Skipped = append(result.Skipped, fmt.Sprintf("%s (chain ID %d) has the name of another network", entry.Name, entry.ChainID))
+				continue
+			}
+			NetworkConfigs[name] = imported
+			byChainID[entry.ChainID] = name
+			result.Added = append(result.Added, name)
+		}
+	}
+	sort.Strings(result.Added)
+	sort.Strings(result.Updated)
+	return result
+}
+
+// fill returns n with the fields it does not set taken from imported
+func (n NetworkConfig) fill(imported NetworkConfig) NetworkConfig {
+	if n.DefaultRPC == "" {
+		n.DefaultRPC = imported.DefaultRPC
+	}
+	if n.Decimals == 0 {
+		n.Decimals = imported.Decimals
+	}
+	if n.State == "" || n.State == NetworkActive {
+		n.State = imported.State
+	}
+	n.NetworkMetadata = imported.NetworkMetadata.merge(n.NetworkMetadata)
+	return n
+}
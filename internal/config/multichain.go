@@ -4,6 +4,15 @@ import (
 	"crypto/ecdsa"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/telemetry"
 )
 
 // ChainInstance represents a configured blockchain instance
@@ -12,8 +21,49 @@ type ChainInstance struct {
 	Config     NetworkConfig
 	PrivateKey *ecdsa.PrivateKey
 	Provider   string
-	Payout     float64
+	Payout     decimal.Decimal
 	Interval   int
+	RateLimits []ratelimit.Rule
+	Batch      *BatchConfig
+	Gas        chain.GasConfig
+	// Tiers size payouts by who is asking. Without tiers every caller gets Payout.
+	Tiers map[Tier]TierConfig
+	// Paused networks stay listed but refuse claims
+	Paused bool
+	// MaxBlockAge is how old the latest block may get before readiness
+	// checks count the network as behind
+	MaxBlockAge time.Duration
+}
+
+// Tier classifies the caller of a claim by its strongest credential
+type Tier string
+
+const (
+	TierAnonymous Tier = "anonymous"
+	TierCaptcha   Tier = "captcha"
+	TierAPIKey    Tier = "api_key"
+	// TierSocial is a user signed in with a social login through the auth proxy
+	TierSocial Tier = "social"
+)
+
+// Tiers lists every tier from the weakest to the strongest credential
+var Tiers = []Tier{TierAnonymous, TierCaptcha, TierSocial, TierAPIKey}
+
+// TierConfig is what callers of a tier get on a network
+type TierConfig struct {
+	// Payout is paid when a claim does not request an amount
+	Payout decimal.Decimal
+	// MaxAmount is the largest amount a claim may request
+	MaxAmount decimal.Decimal
+	// RateLimits replace the rules of the network for the tier, nil shares them
+	RateLimits []ratelimit.Rule
+}
+
+// BatchConfig enables batched payouts through a multisend contract
+type BatchConfig struct {
+	Contract string
+	Window   time.Duration
+	MaxSize  int
 }
 
 // MultiChainConfig holds configuration for multiple blockchain networks
@@ -24,6 +74,46 @@ type MultiChainConfig struct {
 	ProxyCount      int
 	HcaptchaSiteKey string
 	HcaptchaSecret  string
+	// APIKeys are the X-API-Key values that skip the captcha, e.g. for test suites
+	APIKeys []string
+	// AuthHeader is the header an authenticating proxy sets to the user of a
+	// social login. It must not be set unless the proxy strips it from requests.
+	AuthHeader  string
+	ClaimQueue  ClaimQueueConfig
+	NameService NameServiceConfig
+	// Tracing selects where OpenTelemetry spans are exported to, nowhere by default
+	Tracing telemetry.Config
+	// Audit selects where the audit log of claims is written to, nowhere by default
+	Audit audit.Config
+}
+
+// NameServiceConfig resolves names such as vitalik.eth in claims
+type NameServiceConfig struct {
+	// Network is the network names are resolved on, empty disables names
+	Network string
+	// Provider defaults to the provider of Network when it is active, or else
+	// to its public RPC
+	Provider string
+	// Registry is the address of the registry, defaulting to ENS on networks
+	// it is deployed on
+	Registry string
+}
+
+// ClaimQueueConfig controls how claims are queued before they are paid out
+type ClaimQueueConfig struct {
+	// Async makes /api/claim return as soon as the claim is queued
+	Async bool
+	// Workers is the number of claims each network pays out concurrently
+	Workers int
+	// Capacity is the number of claims each network can hold in its queue
+	Capacity int
+	// StorePath is the file queued claims are persisted to, empty keeps them in memory
+	StorePath string
+	// Confirmations is the number of blocks that must confirm a payout before it is final
+	Confirmations uint64
+	// NonceDir is the directory the nonces of each network's account are
+	// persisted to, empty keeps them in memory
+	NonceDir string
 }
 
 // ChainConfigInput represents input configuration for a single chain
@@ -33,8 +123,25 @@ type ChainConfigInput struct {
 	PrivateKey string
 	Keystore   string
 	KeyPass    string
-	Payout     float64
+	Payout     decimal.Decimal
+	// Decimals overrides the decimals of the native asset of the network
+	Decimals   int
 	Interval   int
+	RateLimits []ratelimit.Rule
+	Batch      *BatchConfig
+	// Gas tunes the gas strategy, unset fields keep the defaults of the network
+	Gas   chain.GasConfig
+	Tiers map[Tier]TierConfig
+	// Metadata overrides the fields of the network metadata it sets
+	Metadata NetworkMetadata
+	// Sunset deprecates the network, payouts end at the sunset
+	Sunset time.Time
+	Paused bool
+	// MaxBlockAge overrides the default of the network derived from its block time
+	MaxBlockAge time.Duration
+	// Custom describes a network that is not built in and is used instead of
+	// looking Network up, e.g. a private network served in single-chain mode
+	Custom *NetworkConfig
 }
 
 // NewMultiChainConfig creates a new multi-chain configuration
@@ -43,6 +150,11 @@ func NewMultiChainConfig() *MultiChainConfig {
 		Chains:     make(map[string]*ChainInstance),
 		HTTPPort:   8080,
 		ProxyCount: 0,
+		ClaimQueue: ClaimQueueConfig{
+			Workers:       1,
+			Capacity:      100,
+			Confirmations: 1,
+		},
 	}
 }
 
@@ -50,7 +162,9 @@ func NewMultiChainConfig() *MultiChainConfig {
 func (mc *MultiChainConfig) AddChainWithKey(input ChainConfigInput, privateKey *ecdsa.PrivateKey) error {
 	// Get network configuration
 	networkConfig, exists := GetNetworkByName(input.Network)
-	if !exists {
+	if input.Custom != nil {
+		networkConfig = *input.Custom
+	} else if !exists {
 		return fmt.Errorf("unsupported network: %s", input.Network)
 	}
 
@@ -63,10 +177,42 @@ func (mc *MultiChainConfig) AddChainWithKey(input ChainConfigInput, privateKey *
 		}
 	}
 
+	if !input.Sunset.IsZero() {
+		networkConfig.Sunset = input.Sunset
+	}
+	if networkConfig.StateAt(time.Now()) == NetworkRemoved {
+		if networkConfig.Sunset.IsZero() {
+			return fmt.Errorf("network %s has been removed", input.Network)
+		}
+		return fmt.Errorf("network %s has been removed, payouts ended on %s", input.Network, networkConfig.Sunset.Format("2006-01-02"))
+	}
+
+	networkConfig.NetworkMetadata = networkConfig.NetworkMetadata.merge(input.Metadata)
+	if input.Decimals < 0 {
+		return fmt.Errorf("decimals of network %s must not be negative", input.Network)
+	}
+	if input.Decimals > 0 {
+		networkConfig.Decimals = input.Decimals
+	}
+	if networkConfig.Decimals == 0 {
+		networkConfig.Decimals = chain.DefaultDecimals
+	}
+
 	// Set default values
 	payout := input.Payout
-	if payout == 0 {
-		payout = 1.0
+	if payout.IsZero() {
+		payout = decimal.NewFromInt(1)
+	}
+	if err := validateAmount(payout, networkConfig.Decimals); err != nil {
+		return fmt.Errorf("invalid payout for network %s: %w", input.Network, err)
+	}
+
+	maxBlockAge := input.MaxBlockAge
+	if maxBlockAge < 0 {
+		return fmt.Errorf("max block age of network %s must not be negative", input.Network)
+	}
+	if maxBlockAge == 0 {
+		maxBlockAge = networkConfig.DefaultMaxBlockAge()
 	}
 
 	interval := input.Interval
@@ -74,14 +220,81 @@ func (mc *MultiChainConfig) AddChainWithKey(input ChainConfigInput, privateKey *
 		interval = 1440 // 24 hours default
 	}
 
+	// Without explicit rules allow one claim per address and IP per interval.
+	// An empty, non-nil list disables rate limiting.
+	rateLimits := input.RateLimits
+	if rateLimits == nil {
+		rateLimits = DefaultRateLimits(time.Duration(interval) * time.Minute)
+	}
+	for _, rule := range rateLimits {
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("invalid rate limit for network %s: %w", input.Network, err)
+		}
+	}
+
+	tiers := make(map[Tier]TierConfig, len(input.Tiers))
+	for tier, tierConfig := range input.Tiers {
+		if !tier.Valid() {
+			return fmt.Errorf("unknown tier %q for network %s", tier, input.Network)
+		}
+		if tierConfig.Payout.IsZero() {
+			tierConfig.Payout = payout
+		}
+		if tierConfig.MaxAmount.IsZero() {
+			tierConfig.MaxAmount = tierConfig.Payout
+		}
+		for _, amount := range []decimal.Decimal{tierConfig.Payout, tierConfig.MaxAmount} {
+			if err := validateAmount(amount, networkConfig.Decimals); err != nil {
+				return fmt.Errorf("invalid payout of tier %s for network %s: %w", tier, input.Network, err)
+			}
+		}
+		if tierConfig.MaxAmount.LessThan(tierConfig.Payout) {
+			return fmt.Errorf("max amount of tier %s for network %s is less than its payout", tier, input.Network)
+		}
+		for _, rule := range tierConfig.RateLimits {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("invalid rate limit of tier %s for network %s: %w", tier, input.Network, err)
+			}
+		}
+		tiers[tier] = tierConfig
+	}
+
+	gas := input.Gas
+	if gas.Strategy == "" {
+		gas.Strategy = networkConfig.GasStrategy
+	}
+	gas.OPStack = gas.OPStack || networkConfig.OPStack
+	if err := gas.Validate(); err != nil {
+		return fmt.Errorf("invalid gas settings for network %s: %w", input.Network, err)
+	}
+
+	batch := input.Batch
+	if batch != nil {
+		if !common.IsHexAddress(batch.Contract) {
+			return fmt.Errorf("invalid multisend contract for network %s: %q", input.Network, batch.Contract)
+		}
+		if batch.Window == 0 {
+			batch.Window = 5 * time.Second
+		}
+		if batch.MaxSize == 0 {
+			batch.MaxSize = 50
+		}
+	}
+
 	// Create chain instance
 	chainInstance := &ChainInstance{
-		Network:    input.Network,
-		Config:     networkConfig,
-		PrivateKey: privateKey,
-		Provider:   provider,
-		Payout:     payout,
-		Interval:   interval,
+		Network:     input.Network,
+		Config:      networkConfig,
+		PrivateKey:  privateKey,
+		Provider:    provider,
+		Payout:      payout,
+		Interval:    interval,
+		RateLimits:  rateLimits,
+		Batch:       batch,
+		Gas:         gas,
+		Tiers:       tiers,
+		Paused:      input.Paused,
+		MaxBlockAge: maxBlockAge,
 	}
 
 	mc.Chains[input.Network] = chainInstance
@@ -94,6 +307,74 @@ func (mc *MultiChainConfig) AddChainWithKey(input ChainConfigInput, privateKey *
 	return nil
 }
 
+// NameServiceEndpoint returns the provider and registry names are resolved
+// with. It must only be called with a name service network set.
+func (mc *MultiChainConfig) NameServiceEndpoint() (string, common.Address, error) {
+	ns := mc.NameService
+	networkConfig, known := GetNetworkByName(ns.Network)
+	provider := ns.Provider
+	if provider == "" {
+		if chainInstance, active := mc.GetChain(ns.Network); active {
+			provider = chainInstance.Provider
+		} else {
+			provider = networkConfig.PublicRPC
+		}
+	}
+	if provider == "" {
+		return "", common.Address{}, fmt.Errorf("no provider for the name service on %s", ns.Network)
+	}
+
+	switch {
+	case ns.Registry != "":
+		if !common.IsHexAddress(ns.Registry) {
+			return "", common.Address{}, fmt.Errorf("invalid name service registry %q", ns.Registry)
+		}
+		return provider, common.HexToAddress(ns.Registry), nil
+	case known && networkConfig.ENS:
+		return provider, chain.ENSRegistry, nil
+	default:
+		return "", common.Address{}, fmt.Errorf("ENS is not deployed on %s, set the registry of the name service", ns.Network)
+	}
+}
+
+// validateAmount reports whether amount can be paid exactly in an asset
+// with the given decimals
+func validateAmount(amount decimal.Decimal, decimals int) error {
+	if amount.IsNegative() {
+		return fmt.Errorf("%s must not be negative", amount)
+	}
+	_, err := chain.ToBaseUnits(amount, decimals)
+	return err
+}
+
+// Valid reports whether t is a known tier
+func (t Tier) Valid() bool {
+	for _, tier := range Tiers {
+		if t == tier {
+			return true
+		}
+	}
+	return false
+}
+
+// Tier returns what callers of tier get on the network. Without configured
+// tiers every tier gets the network payout and rate limits.
+func (ci *ChainInstance) Tier(tier Tier) (TierConfig, bool) {
+	if len(ci.Tiers) == 0 {
+		return TierConfig{Payout: ci.Payout, MaxAmount: ci.Payout}, true
+	}
+	tierConfig, exists := ci.Tiers[tier]
+	return tierConfig, exists
+}
+
+// DefaultRateLimits returns the rules used when a network configures none
+func DefaultRateLimits(interval time.Duration) []ratelimit.Rule {
+	return []ratelimit.Rule{
+		{Key: ratelimit.KeyAddress, Limit: 1, Window: interval},
+		{Key: ratelimit.KeyIP, Limit: 1, Window: interval},
+	}
+}
+
 // GetChain returns a specific chain instance
 func (mc *MultiChainConfig) GetChain(network string) (*ChainInstance, bool) {
 	chain, exists := mc.Chains[network]
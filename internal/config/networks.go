@@ -1,6 +1,11 @@
 package config
 
-import "strings"
+import (
+	"strings"
+	"time"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+)
 
 type NetworkConfig struct {
 	ChainID    int64
@@ -8,51 +13,155 @@ type NetworkConfig struct {
 	Name       string
 	IsTestnet  bool
 	DefaultRPC string
+	// Decimals of the native asset, 0 means chain.DefaultDecimals
+	Decimals int
+	// GasStrategy is the default gas strategy of the network
+	GasStrategy chain.GasStrategyName
+	// OPStack marks OP-stack rollups, which charge an L1 data fee
+	OPStack bool
+	// ENS marks networks the ENS registry is deployed on
+	ENS bool
+	// State is where the network is in its lifecycle, empty for active networks
+	State NetworkState
+	// Sunset is when payouts on a deprecated network end, zero when no date is announced
+	Sunset time.Time
+	// BlockTime is the usual time between blocks, zero when it is unknown
+	BlockTime time.Duration
+	NetworkMetadata
+}
+
+// Readiness checks count a network as behind once its latest block is older
+// than maxBlockAgeBlocks block times, but never sooner than minMaxBlockAge
+const (
+	maxBlockAgeBlocks  = 20
+	minMaxBlockAge     = time.Minute
+	defaultMaxBlockAge = 5 * time.Minute
+)
+
+// DefaultMaxBlockAge is how old the latest block may get before the network
+// counts as behind, derived from its block time when it is known
+func (n NetworkConfig) DefaultMaxBlockAge() time.Duration {
+	if n.BlockTime == 0 {
+		return defaultMaxBlockAge
+	}
+	if age := maxBlockAgeBlocks * n.BlockTime; age > minMaxBlockAge {
+		return age
+	}
+	return minMaxBlockAge
+}
+
+// NetworkState is the lifecycle state of a network
+type NetworkState string
+
+const (
+	NetworkActive NetworkState = "active"
+	// NetworkDeprecated networks still pay out until their sunset
+	NetworkDeprecated NetworkState = "deprecated"
+	// NetworkRemoved networks are shut down and cannot be configured
+	NetworkRemoved NetworkState = "removed"
+)
+
+// StateAt returns the state of the network at t. A network is removed once
+// its sunset has passed and deprecated while one is announced.
+func (n NetworkConfig) StateAt(t time.Time) NetworkState {
+	switch {
+	case n.State == NetworkRemoved || !n.Sunset.IsZero() && !t.Before(n.Sunset):
+		return NetworkRemoved
+	case n.State == NetworkDeprecated || !n.Sunset.IsZero():
+		return NetworkDeprecated
+	default:
+		return NetworkActive
+	}
+}
+
+// NetworkMetadata describes a network to the frontend and to wallets
+type NetworkMetadata struct {
+	// ExplorerTxURL and ExplorerAddressURL link to a block explorer, with
+	// {hash} and {address} replaced by a transaction hash or an address
+	ExplorerTxURL      string
+	ExplorerAddressURL string
+	// PublicRPC is an RPC endpoint wallets can add the network with. Unlike
+	// DefaultRPC it needs no API key.
+	PublicRPC string
+	// CurrencyName is the name of the native asset, e.g. Ether
+	CurrencyName string
+	// Icon is the URL of an image of the network
+	Icon string
+}
+
+// merge returns m with the fields that override sets replaced
+func (m NetworkMetadata) merge(override NetworkMetadata) NetworkMetadata {
+	if override.ExplorerTxURL != "" {
+		m.ExplorerTxURL = override.ExplorerTxURL
+	}
+	if override.ExplorerAddressURL != "" {
+		m.ExplorerAddressURL = override.ExplorerAddressURL
+	}
+	if override.PublicRPC != "" {
+		m.PublicRPC = override.PublicRPC
+	}
+	if override.CurrencyName != "" {
+		m.CurrencyName = override.CurrencyName
+	}
+	if override.Icon != "" {
+		m.Icon = override.Icon
+	}
+	return m
+}
+
+// TxURL returns the explorer link of a transaction, empty without an explorer
+func (m NetworkMetadata) TxURL(txHash string) string {
+	return strings.ReplaceAll(m.ExplorerTxURL, "{hash}", txHash)
+}
+
+// AddressURL returns the explorer link of an address, empty without an explorer
+func (m NetworkMetadata) AddressURL(address string) string {
+	return strings.ReplaceAll(m.ExplorerAddressURL, "{address}", address)
 }
 
 // Network configurations with chain IDs and default settings
 var NetworkConfigs = map[string]NetworkConfig{
 	// Ethereum Networks
-	"mainnet": {ChainID: 1, Symbol: "ETH", Name: "Ethereum Mainnet", IsTestnet: false, DefaultRPC: "https://eth.public-rpc.com"},
-	"sepolia": {ChainID: 11155111, Symbol: "ETH", Name: "Ethereum Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.infura.io/v3/"},
-	"holesky": {ChainID: 17000, Symbol: "ETH", Name: "Ethereum Holesky", IsTestnet: true, DefaultRPC: "https://ethereum-holesky.publicnode.com"},
-	"goerli":  {ChainID: 5, Symbol: "ETH", Name: "Ethereum Goerli", IsTestnet: true, DefaultRPC: "https://goerli.infura.io/v3/"},
+	"mainnet": {ChainID: 1, Symbol: "ETH", Name: "Ethereum Mainnet", IsTestnet: false, DefaultRPC: "https://eth.public-rpc.com", ENS: true, BlockTime: 12 * time.Second},
+	"sepolia": {ChainID: 11155111, Symbol: "ETH", Name: "Ethereum Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.infura.io/v3/", ENS: true, BlockTime: 12 * time.Second},
+	"holesky": {ChainID: 17000, Symbol: "ETH", Name: "Ethereum Holesky", IsTestnet: true, DefaultRPC: "https://ethereum-holesky.publicnode.com", ENS: true, BlockTime: 12 * time.Second},
+	"goerli":  {ChainID: 5, Symbol: "ETH", Name: "Ethereum Goerli", IsTestnet: true, DefaultRPC: "https://goerli.infura.io/v3/", State: NetworkRemoved, BlockTime: 12 * time.Second},
 
 	// Polygon Networks
-	"polygon":      {ChainID: 137, Symbol: "POL", Name: "Polygon Mainnet", IsTestnet: false, DefaultRPC: "https://polygon-rpc.com"},
-	"polygon-amoy": {ChainID: 80002, Symbol: "POL", Name: "Polygon Amoy", IsTestnet: true, DefaultRPC: "https://rpc-amoy.polygon.technology"},
+	"polygon":      {ChainID: 137, Symbol: "POL", Name: "Polygon Mainnet", IsTestnet: false, DefaultRPC: "https://polygon-rpc.com", BlockTime: 2 * time.Second},
+	"polygon-amoy": {ChainID: 80002, Symbol: "POL", Name: "Polygon Amoy", IsTestnet: true, DefaultRPC: "https://rpc-amoy.polygon.technology", BlockTime: 2 * time.Second},
 
 	// BSC Networks
-	"bsc":         {ChainID: 56, Symbol: "BNB", Name: "BNB Smart Chain", IsTestnet: false, DefaultRPC: "https://bsc-dataseed.binance.org"},
-	"bsc-testnet": {ChainID: 97, Symbol: "BNB", Name: "BNB Smart Chain Testnet", IsTestnet: true, DefaultRPC: "https://data-seed-prebsc-1-s1.binance.org:8545"},
+	"bsc":         {ChainID: 56, Symbol: "BNB", Name: "BNB Smart Chain", IsTestnet: false, DefaultRPC: "https://bsc-dataseed.binance.org", BlockTime: 3 * time.Second},
+	"bsc-testnet": {ChainID: 97, Symbol: "BNB", Name: "BNB Smart Chain Testnet", IsTestnet: true, DefaultRPC: "https://data-seed-prebsc-1-s1.binance.org:8545", BlockTime: 3 * time.Second},
 
 	// Arbitrum Networks
-	"arbitrum":         {ChainID: 42161, Symbol: "ETH", Name: "Arbitrum One", IsTestnet: false, DefaultRPC: "https://arb1.arbitrum.io/rpc"},
-	"arbitrum-sepolia": {ChainID: 421614, Symbol: "ETH", Name: "Arbitrum Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia-rollup.arbitrum.io/rpc"},
+	"arbitrum":         {ChainID: 42161, Symbol: "ETH", Name: "Arbitrum One", IsTestnet: false, DefaultRPC: "https://arb1.arbitrum.io/rpc", GasStrategy: chain.EstimateGasStrategy, BlockTime: 250 * time.Millisecond},
+	"arbitrum-sepolia": {ChainID: 421614, Symbol: "ETH", Name: "Arbitrum Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia-rollup.arbitrum.io/rpc", GasStrategy: chain.EstimateGasStrategy, BlockTime: 250 * time.Millisecond},
 
 	// Optimism Networks
-	"optimism":         {ChainID: 10, Symbol: "ETH", Name: "Optimism Mainnet", IsTestnet: false, DefaultRPC: "https://mainnet.optimism.io"},
-	"optimism-sepolia": {ChainID: 11155420, Symbol: "ETH", Name: "Optimism Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.optimism.io"},
+	"optimism":         {ChainID: 10, Symbol: "ETH", Name: "Optimism Mainnet", IsTestnet: false, DefaultRPC: "https://mainnet.optimism.io", OPStack: true, BlockTime: 2 * time.Second},
+	"optimism-sepolia": {ChainID: 11155420, Symbol: "ETH", Name: "Optimism Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.optimism.io", OPStack: true, BlockTime: 2 * time.Second},
 
 	// Avalanche Networks
-	"avalanche":      {ChainID: 43114, Symbol: "AVAX", Name: "Avalanche C-Chain", IsTestnet: false, DefaultRPC: "https://api.avax.network/ext/bc/C/rpc"},
-	"avalanche-fuji": {ChainID: 43113, Symbol: "AVAX", Name: "Avalanche Fuji", IsTestnet: true, DefaultRPC: "https://api.avax-test.network/ext/bc/C/rpc"},
+	"avalanche":      {ChainID: 43114, Symbol: "AVAX", Name: "Avalanche C-Chain", IsTestnet: false, DefaultRPC: "https://api.avax.network/ext/bc/C/rpc", BlockTime: 2 * time.Second},
+	"avalanche-fuji": {ChainID: 43113, Symbol: "AVAX", Name: "Avalanche Fuji", IsTestnet: true, DefaultRPC: "https://api.avax-test.network/ext/bc/C/rpc", BlockTime: 2 * time.Second},
 
 	// Base Networks
-	"base":         {ChainID: 8453, Symbol: "ETH", Name: "Base Mainnet", IsTestnet: false, DefaultRPC: "https://mainnet.base.org"},
-	"base-sepolia": {ChainID: 84532, Symbol: "ETH", Name: "Base Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.base.org"},
+	"base":         {ChainID: 8453, Symbol: "ETH", Name: "Base Mainnet", IsTestnet: false, DefaultRPC: "https://mainnet.base.org", OPStack: true, BlockTime: 2 * time.Second},
+	"base-sepolia": {ChainID: 84532, Symbol: "ETH", Name: "Base Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.base.org", OPStack: true, BlockTime: 2 * time.Second},
 
 	// Fantom Networks
-	"fantom":         {ChainID: 250, Symbol: "FTM", Name: "Fantom Opera", IsTestnet: false, DefaultRPC: "https://rpc.ftm.tools"},
-	"fantom-testnet": {ChainID: 4002, Symbol: "FTM", Name: "Fantom Testnet", IsTestnet: true, DefaultRPC: "https://rpc.testnet.fantom.network"},
+	"fantom":         {ChainID: 250, Symbol: "FTM", Name: "Fantom Opera", IsTestnet: false, DefaultRPC: "https://rpc.ftm.tools", BlockTime: time.Second},
+	"fantom-testnet": {ChainID: 4002, Symbol: "FTM", Name: "Fantom Testnet", IsTestnet: true, DefaultRPC: "https://rpc.testnet.fantom.network", BlockTime: time.Second},
 
 	// Linea Networks
-	"linea":         {ChainID: 59144, Symbol: "ETH", Name: "Linea Mainnet", IsTestnet: false, DefaultRPC: "https://rpc.linea.build"},
-	"linea-sepolia": {ChainID: 59141, Symbol: "ETH", Name: "Linea Sepolia", IsTestnet: true, DefaultRPC: "https://rpc.sepolia.linea.build"},
+	"linea":         {ChainID: 59144, Symbol: "ETH", Name: "Linea Mainnet", IsTestnet: false, DefaultRPC: "https://rpc.linea.build", BlockTime: 2 * time.Second},
+	"linea-sepolia": {ChainID: 59141, Symbol: "ETH", Name: "Linea Sepolia", IsTestnet: true, DefaultRPC: "https://rpc.sepolia.linea.build", BlockTime: 2 * time.Second},
 
 	// zkSync Networks
-	"zksync":         {ChainID: 324, Symbol: "ETH", Name: "zkSync Era", IsTestnet: false, DefaultRPC: "https://mainnet.era.zksync.io"},
-	"zksync-sepolia": {ChainID: 300, Symbol: "ETH", Name: "zkSync Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.era.zksync.dev"},
+	"zksync":         {ChainID: 324, Symbol: "ETH", Name: "zkSync Era", IsTestnet: false, DefaultRPC: "https://mainnet.era.zksync.io", GasStrategy: chain.EstimateGasStrategy, BlockTime: time.Second},
+	"zksync-sepolia": {ChainID: 300, Symbol: "ETH", Name: "zkSync Sepolia", IsTestnet: true, DefaultRPC: "https://sepolia.era.zksync.dev", GasStrategy: chain.EstimateGasStrategy, BlockTime: time.Second},
 }
 
 // GetSupportedNetworks returns a list of all supported networks
@@ -60,6 +169,63 @@ func GetSupportedNetworks() map[string]NetworkConfig {
 	return NetworkConfigs
 }
 
+// explorers are the block explorers of the built-in networks. All of them
+// link transactions under /tx/ and addresses under /address/.
+var explorers = map[string]string{
+	"mainnet":          "https://etherscan.io",
+	"sepolia":          "https://sepolia.etherscan.io",
+	"holesky":          "https://holesky.etherscan.io",
+	"goerli":           "https://goerli.etherscan.io",
+	"polygon":          "https://polygonscan.com",
+	"polygon-amoy":     "https://amoy.polygonscan.com",
+	"bsc":              "https://bscscan.com",
+	"bsc-testnet":      "https://testnet.bscscan.com",
+	"arbitrum":         "https://arbiscan.io",
+	"arbitrum-sepolia": "https://sepolia.arbiscan.io",
+	"optimism":         "https://optimistic.etherscan.io",
+	"optimism-sepolia": "https://sepolia-optimism.etherscan.io",
+	"avalanche":        "https://snowtrace.io",
+	"avalanche-fuji":   "https://testnet.snowtrace.io",
+	"base":             "https://basescan.org",
+	"base-sepolia":     "https://sepolia.basescan.org",
+	"fantom":           "https://ftmscan.com",
+	"fantom-testnet":   "https://testnet.ftmscan.com",
+	"linea":            "https://lineascan.build",
+	"linea-sepolia":    "https://sepolia.lineascan.build",
+	"zksync":           "https://explorer.zksync.io",
+	"zksync-sepolia":   "https://sepolia.explorer.zksync.io",
+}
+
+// currencyNames names the native assets of the built-in networks by symbol
+var currencyNames = map[string]string{
+	"ETH":  "Ether",
+	"POL":  "POL",
+	"BNB":  "BNB",
+	"AVAX": "Avalanche",
+	"FTM":  "Fantom",
+}
+
+// publicRPCs replace default RPCs that need an API key for wallets
+var publicRPCs = map[string]string{
+	"sepolia": "https://ethereum-sepolia-rpc.publicnode.com",
+	"goerli":  "https://ethereum-goerli-rpc.publicnode.com",
+}
+
+func init() {
+	for name, network := range NetworkConfigs {
+		if explorer, exists := explorers[name]; exists {
+			network.ExplorerTxURL = explorer + "/tx/{hash}"
+			network.ExplorerAddressURL = explorer + "/address/{address}"
+		}
+		network.PublicRPC = network.DefaultRPC
+		if rpc, exists := publicRPCs[name]; exists {
+			network.PublicRPC = rpc
+		}
+		network.CurrencyName = currencyNames[network.Symbol]
+		NetworkConfigs[name] = network
+	}
+}
+
 // GetNetworkByName returns the network configuration for a given network name
 func GetNetworkByName(name string) (NetworkConfig, bool) {
 	config, exists := NetworkConfigs[strings.ToLower(name)]
@@ -0,0 +1,737 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+)
+
+var tracer = otel.Tracer("github.com/guyuxiang/multi-chain-faucet/internal/queue")
+
+var (
+	ErrQueueFull      = errors.New("claim queue is full")
+	ErrUnknownNetwork = errors.New("network has no claim queue")
+	ErrClaimNotFound  = errors.New("claim not found")
+)
+
+// Status is the processing state of a claim
+type Status string
+
+const (
+	StatusQueued     Status = "queued"
+	StatusProcessing Status = "processing"
+	StatusSigned     Status = "signed"
+	StatusBroadcast  Status = "broadcast"
+	StatusMined      Status = "mined"
+	StatusFailed     Status = "failed"
+)
+
+// Cause is why a claim failed before its transaction was sent, for the
+// failures users can be told about
+type Cause string
+
+const (
+	// CauseInsufficientFunds is a faucet account that cannot pay the claim
+	CauseInsufficientFunds Cause = "insufficient_funds"
+	// CauseRecipientReverts is a recipient contract that rejects the payout
+	CauseRecipientReverts Cause = "recipient_reverts"
+	// CauseFeeTooHigh is a network whose fees exceed what the faucet pays
+	CauseFeeTooHigh Cause = "fee_too_high"
+)
+
+// causeOf returns the cause of a payout error, empty when it has none
+func causeOf(err error) Cause {
+	switch {
+	case errors.Is(err, chain.ErrInsufficientFaucetFunds):
+		return CauseInsufficientFunds
+	case errors.Is(err, chain.ErrRecipientReverts):
+		return CauseRecipientReverts
+	case errors.Is(err, chain.ErrFeeCapBelowBaseFee), errors.Is(err, chain.ErrFeeCapExceeded):
+		return CauseFeeTooHigh
+	}
+	return ""
+}
+
+// Claim is a payout request waiting for or processed by a worker. BlockNumber
+// and Confirmations are set once its transaction is mined, and a Final claim
+// does not change anymore.
+type Claim struct {
+	ID            string    `json:"id"`
+	Network       string    `json:"network"`
+	Address       string    `json:"address"`
+	Amount        *big.Int  `json:"amount"`
+	Status        Status    `json:"status"`
+	TxHash        string    `json:"tx_hash,omitempty"`
+	LogIndex      *uint     `json:"log_index,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	Cause         Cause     `json:"cause,omitempty"`
+	BlockNumber   uint64    `json:"block_number,omitempty"`
+	Confirmations uint64    `json:"confirmations,omitempty"`
+	Final         bool      `json:"final"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+type entry struct {
+	claim Claim
+	// span is the span the claim was submitted in, its payout continues the trace
+	span        trace.SpanContext
+	done        chan struct{}
+	onDone      func(Claim)
+	subscribers []chan Claim
+}
+
+type networkQueue struct {
+	builder  chain.TxBuilder
+	workers  int
+	capacity int
+	batch    *Batching
+	pending  []string
+}
+
+// Batching collects claims for a short window and pays them with a single
+// call to a multisend contract
+type Batching struct {
+	Contract common.Address
+	Window   time.Duration
+	MaxSize  int
+}
+
+// pruneInterval is how often final claims past retention are dropped
+const pruneInterval = time.Minute
+
+// Manager runs a bounded queue with its own workers for every network and
+// persists all claims to a single store
+type Manager struct {
+	mutex         sync.Mutex
+	cond          *sync.Cond
+	queues        map[string]*networkQueue
+	claims        map[string]*entry
+	tracked       map[common.Hash]*trackedTx
+	store         Store
+	timeout       time.Duration
+	retention     time.Duration
+	confirmations uint64
+	trackInterval time.Duration
+	// pruned is when final claims past retention were last dropped
+	pruned time.Time
+	closed bool
+	stop   chan struct{}
+	// running counts the workers and the tracker, Close waits for them
+	running sync.WaitGroup
+}
+
+// NewManager creates a claim queue manager. A nil store keeps claims in memory only.
+func NewManager(store Store, timeout time.Duration) *Manager {
+	m := &Manager{
+		queues:        make(map[string]*networkQueue),
+		claims:        make(map[string]*entry),
+		tracked:       make(map[common.Hash]*trackedTx),
+		store:         store,
+		timeout:       timeout,
+		retention:     24 * time.Hour,
+		confirmations: 1,
+		trackInterval: 3 * time.Second,
+		stop:          make(chan struct{}),
+	}
+	m.cond = sync.NewCond(&m.mutex)
+	return m
+}
+
+// AddNetwork registers a queue for the network. It must be called before Start.
+func (m *Manager) AddNetwork(network string, builder chain.TxBuilder, workers, capacity int) {
+	if workers <= 0 {
+		workers = 1
+	}
+	m.queues[network] = &networkQueue{
+		builder:  builder,
+		workers:  workers,
+		capacity: capacity,
+	}
+}
+
+// SetBatching enables batched payouts for a network added with AddNetwork
+func (m *Manager) SetBatching(network string, batch Batching) error {
+	q, ok := m.queues[network]
+	if !ok {
+		return ErrUnknownNetwork
+	}
+	if _, ok := q.builder.(chain.BatchTxBuilder); !ok {
+		return fmt.Errorf("%s cannot send batched payouts", network)
+	}
+	if batch.MaxSize < 2 {
+		return fmt.Errorf("batch size for %s must be at least 2", network)
+	}
+	q.batch = &batch
+	return nil
+}
+
+// SetConfirmations sets how many blocks must confirm a payout before the
+// tracker stops following it. It must be called before Start.
+func (m *Manager) SetConfirmations(confirmations uint64) {
+	if confirmations == 0 {
+		confirmations = 1
+	}
+	m.confirmations = confirmations
+}
+
+// Start restores persisted claims and starts the workers of every network
+// together with the transaction tracker
+func (m *Manager) Start() error {
+	if err := m.restore(); err != nil {
+		return err
+	}
+	for network, q := range m.queues {
+		network, q := network, q
+		// Payouts that were sent before a restart may have left gaps
+		m.goRun(func() { m.fillNonceGaps(network, q) })
+		for i := 0; i < q.workers; i++ {
+			m.goRun(func() { m.work(network, q) })
+		}
+	}
+	m.goRun(m.track)
+	return nil
+}
+
+// goRun runs f in a goroutine that Close waits for
+func (m *Manager) goRun(f func()) {
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		f()
+	}()
+}
+
+// fillNonceGaps fills the gaps in the nonces of the network's account, which
+// keep every later payout from being mined
+func (m *Manager) fillNonceGaps(network string, q *networkQueue) {
+	filler, ok := q.builder.(chain.NonceGapFiller)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	defer cancel()
+	filled, err := filler.FillNonceGaps(ctx)
+	if err != nil {
+		log.WithError(err).WithField("network", network).Error("Failed to fill nonce gaps")
+		return
+	}
+	if filled > 0 {
+		log.WithFields(log.Fields{
+			"network": network,
+			"gaps":    filled,
+		}).Warn("Filled nonce gaps")
+	}
+}
+
+// Close stops the workers and waits until their current claims are done
+func (m *Manager) Close() {
+	m.mutex.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.stop)
+	}
+	m.mutex.Unlock()
+	m.cond.Broadcast()
+	m.running.Wait()
+}
+
+// Submit queues a payout and returns the claim together with its 1-based
+// position in the network's queue. onDone, if not nil, is called once the
+// claim is final, e.g. after its transaction is confirmed or the tracker
+// fails it. It is called with the manager locked and must not call it back.
+// The payout is traced as part of the span of ctx.
+func (m *Manager) Submit(ctx context.Context, network, address string, amount *big.Int, onDone func(Claim)) (Claim, int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	q, ok := m.queues[network]
+	if !ok {
+		return Claim{}, 0, ErrUnknownNetwork
+	}
+	if q.capacity > 0 && len(q.pending) >= q.capacity {
+		return Claim{}, 0, ErrQueueFull
+	}
+
+	now := time.Now()
+	e := &entry{
+		claim: Claim{
+			ID:        newClaimID(),
+			Network:   network,
+			Address:   address,
+			Amount:    amount,
+			Status:    StatusQueued,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		span:   trace.SpanContextFromContext(ctx),
+		done:   make(chan struct{}),
+		onDone: onDone,
+	}
+	m.claims[e.claim.ID] = e
+	q.pending = append(q.pending, e.claim.ID)
+	m.updateLocked(e)
+	m.cond.Broadcast()
+
+	return e.claim, len(q.pending), nil
+}
+
+// Get returns a claim and, while it is queued, its position in the queue
+func (m *Manager) Get(id string) (Claim, int, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, ok := m.claims[id]
+	if !ok {
+		return Claim{}, 0, false
+	}
+	return e.claim, m.positionLocked(e.claim), true
+}
+
+// Subscribe returns the current state of a claim and a channel that receives
+// every later update. The channel is closed once the claim is final; call
+// cancel to stop listening earlier. Updates are dropped for subscribers that
+// fall behind, so the last snapshot should be read with Get after the channel
+// is closed.
+func (m *Manager) Subscribe(id string) (Claim, <-chan Claim, func(), error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	e, ok := m.claims[id]
+	if !ok {
+		return Claim{}, nil, nil, ErrClaimNotFound
+	}
+	ch := make(chan Claim, 16)
+	if e.claim.Final {
+		close(ch)
+		return e.claim, ch, func() {}, nil
+	}
+	e.subscribers = append(e.subscribers, ch)
+
+	cancel := func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		for i, sub := range e.subscribers {
+			if sub == ch {
+				e.subscribers = append(e.subscribers[:i], e.subscribers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+	return e.claim, ch, cancel, nil
+}
+
+// Wait blocks until the claim is broadcast or has failed, or ctx is done
+func (m *Manager) Wait(ctx context.Context, id string) (Claim, error) {
+	m.mutex.Lock()
+	e, ok := m.claims[id]
+	m.mutex.Unlock()
+	if !ok {
+		return Claim{}, ErrClaimNotFound
+	}
+
+	select {
+	case <-e.done:
+	case <-ctx.Done():
+		return Claim{}, ctx.Err()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return e.claim, nil
+}
+
+func (m *Manager) positionLocked(claim Claim) int {
+	if claim.Status != StatusQueued {
+		return 0
+	}
+	for i, id := range m.queues[claim.Network].pending {
+		if id == claim.ID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func (m *Manager) work(network string, q *networkQueue) {
+	for {
+		m.mutex.Lock()
+		for len(q.pending) == 0 && !m.closed {
+			m.cond.Wait()
+		}
+		if q.batch != nil && !m.closed {
+			// Give other claims a chance to join the batch
+			m.mutex.Unlock()
+			time.Sleep(q.batch.Window)
+			m.mutex.Lock()
+		}
+		if m.closed || len(q.pending) == 0 {
+			closed := m.closed
+			m.mutex.Unlock()
+			if closed {
+				return
+			}
+			continue
+		}
+
+		size := 1
+		if q.batch != nil {
+			size = len(q.pending)
+			if size > q.batch.MaxSize {
+				size = q.batch.MaxSize
+			}
+		}
+		entries := make([]*entry, size)
+		for i, id := range q.pending[:size] {
+			entries[i] = m.claims[id]
+			entries[i].claim.Status = StatusProcessing
+			entries[i].claim.UpdatedAt = time.Now()
+		}
+		q.pending = q.pending[size:]
+		for _, e := range entries {
+			m.updateLocked(e)
+		}
+		m.mutex.Unlock()
+
+		if len(entries) == 1 {
+			m.transfer(network, q, entries[0])
+		} else {
+			m.batchTransfer(network, q, entries)
+		}
+	}
+}
+
+func (m *Manager) transfer(network string, q *networkQueue, e *entry) {
+	ctx, span := tracer.Start(trace.ContextWithSpanContext(context.Background(), e.span), "transfer", trace.WithAttributes(
+		attribute.String("claim.id", e.claim.ID),
+		attribute.String("network", network),
+		attribute.Int64("queue.wait_ms", time.Since(e.claim.CreatedAt).Milliseconds()),
+	))
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	ctx = chain.WithTxTrace(ctx, m.signedTrace(e))
+	txHash, err := q.builder.Transfer(ctx, e.claim.Address, e.claim.Amount)
+	cancel()
+	endSpan(span, err)
+
+	if errors.Is(err, chain.ErrBroadcastUnknown) {
+		// The tracker settles the claim once the transaction is mined or not
+		log.WithError(err).WithFields(log.Fields{
+			"claim":   e.claim.ID,
+			"txHash":  txHash,
+			"network": network,
+		}).Warn("Transaction may have been sent, tracking it")
+		m.finish(e, StatusBroadcast, txHash.Hex(), nil)
+		return
+	}
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"claim":   e.claim.ID,
+			"network": network,
+		}).Error("Failed to send transaction")
+		m.finish(e, StatusFailed, "", err)
+		return
+	}
+	log.WithFields(log.Fields{
+		"claim":   e.claim.ID,
+		"txHash":  txHash,
+		"address": e.claim.Address,
+		"network": network,
+	}).Info("Transaction sent successfully")
+	m.finish(e, StatusBroadcast, txHash.Hex(), nil)
+}
+
+// batchTransfer pays all entries in one multisend transaction. When the
+// batch fails before it is signed, e.g. because the faucet cannot cover all
+// of it, every claim is paid on its own instead. Once it is signed, the
+// claims stay on the batch, as it may have been broadcast.
+func (m *Manager) batchTransfer(network string, q *networkQueue, entries []*entry) {
+	builder := q.builder.(chain.BatchTxBuilder)
+	to := make([]string, len(entries))
+	values := make([]*big.Int, len(entries))
+	for i, e := range entries {
+		to[i] = e.claim.Address
+		values[i] = e.claim.Amount
+	}
+
+	// A batch pays claims of several traces, it is linked to each of them
+	links := make([]trace.Link, len(entries))
+	for i, e := range entries {
+		links[i] = trace.Link{SpanContext: e.span, Attributes: []attribute.KeyValue{attribute.String("claim.id", e.claim.ID)}}
+	}
+	ctx, span := tracer.Start(context.Background(), "batch transfer", trace.WithLinks(links...), trace.WithAttributes(
+		attribute.String("network", network),
+		attribute.Int("batch.size", len(entries)),
+	))
+	ctx, cancel := context.WithTimeout(ctx, m.timeout)
+	ctx = chain.WithTxTrace(ctx, m.signedTrace(entries...))
+	txHash, err := builder.BatchTransfer(ctx, q.batch.Contract, to, values)
+	cancel()
+	endSpan(span, err)
+
+	switch {
+	case errors.Is(err, chain.ErrBroadcastUnknown):
+		// The tracker settles the claims once the batch is mined or not
+		log.WithError(err).WithFields(log.Fields{
+			"txHash":  txHash,
+			"network": network,
+			"claims":  len(entries),
+		}).Warn("Batched payout may have been sent, tracking it")
+	case err != nil && m.signed(entries[0]):
+		log.WithError(err).WithFields(log.Fields{
+			"network": network,
+			"claims":  len(entries),
+		}).Error("Batched payout was refused by the node")
+		for _, e := range entries {
+			m.finish(e, StatusFailed, "", err)
+		}
+		return
+	case err != nil:
+		log.WithError(err).WithFields(log.Fields{
+			"network": network,
+			"claims":  len(entries),
+		}).Warn("Failed to send batched payout, paying claims one by one")
+		for _, e := range entries {
+			m.transfer(network, q, e)
+		}
+		return
+	default:
+		log.WithFields(log.Fields{
+			"txHash":  txHash,
+			"network": network,
+			"claims":  len(entries),
+		}).Info("Batched transaction sent successfully")
+	}
+	for _, e := range entries {
+		m.finish(e, StatusBroadcast, txHash.Hex(), nil)
+	}
+}
+
+// endSpan records err, if any, on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// signedTrace moves the entries to StatusSigned once their transaction is signed
+func (m *Manager) signedTrace(entries ...*entry) *chain.TxTrace {
+	return &chain.TxTrace{
+		Signed: func(txHash common.Hash) {
+			m.mutex.Lock()
+			defer m.mutex.Unlock()
+			for _, e := range entries {
+				e.claim.Status = StatusSigned
+				e.claim.TxHash = txHash.Hex()
+				e.claim.UpdatedAt = time.Now()
+				m.updateLocked(e)
+			}
+		},
+	}
+}
+
+// signed reports whether the transaction of e was signed
+func (m *Manager) signed(e *entry) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return e.claim.Status == StatusSigned
+}
+
+// resolveBatchLogs records which log of the mined batch paid each claim, and
+// fails the claims whose recipient refused the transfer. The batch was mined
+// successfully, so claims whose log cannot be told apart stay paid, only
+// without a log index.
+func (m *Manager) resolveBatchLogs(builder chain.BatchTxBuilder, contract common.Address, entries []*entry, txHash common.Hash) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	logs, err := builder.BatchLogs(ctx, contract, txHash)
+	if err == nil && len(logs) != len(entries) {
+		err = fmt.Errorf("expected %d transfer logs, got %d", len(entries), len(logs))
+	}
+	if err != nil {
+		log.WithError(err).WithField("txHash", txHash).Error("Failed to find the logs of batched payout")
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for i, e := range entries {
+		if logs[i].Failed {
+			log.WithFields(log.Fields{
+				"claim":   e.claim.ID,
+				"txHash":  txHash,
+				"address": e.claim.Address,
+			}).Warn("Recipient refused its batched payout")
+			e.claim.Status = StatusFailed
+			e.claim.Error = chain.ErrRecipientReverts.Error()
+			e.claim.Cause = causeOf(chain.ErrRecipientReverts)
+			e.claim.Final = true
+		} else {
+			e.claim.LogIndex = &logs[i].Index
+		}
+		e.claim.UpdatedAt = time.Now()
+		m.updateLocked(e)
+	}
+}
+
+// finish records the outcome of sending a claim. Broadcast claims are handed
+// to the tracker when the network's builder can watch transactions.
+func (m *Manager) finish(e *entry, status Status, txHash string, err error) {
+	m.mutex.Lock()
+	e.claim.Status = status
+	e.claim.TxHash = txHash
+	if err != nil {
+		e.claim.Error = err.Error()
+		e.claim.Cause = causeOf(err)
+	}
+	e.claim.UpdatedAt = time.Now()
+	if status == StatusBroadcast {
+		e.claim.Final = !m.trackLocked(e)
+	} else {
+		e.claim.Final = true
+	}
+	m.updateLocked(e)
+	close(e.done)
+	m.mutex.Unlock()
+}
+
+// restore loads persisted claims. Queued claims are queued again in their
+// original order and signed or broadcast claims are tracked again, while
+// claims that were being processed are failed because their transaction may
+// or may not have been sent.
+func (m *Manager) restore() error {
+	if m.store == nil {
+		return nil
+	}
+	claims, err := m.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load claims: %w", err)
+	}
+	sort.Slice(claims, func(i, j int) bool {
+		return claims[i].CreatedAt.Before(claims[j].CreatedAt)
+	})
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, claim := range claims {
+		e := &entry{claim: claim, done: make(chan struct{})}
+		q, ok := m.queues[claim.Network]
+		changed := true
+		switch {
+		case claim.Final:
+			changed = false
+			close(e.done)
+		case !ok:
+			e.claim.Status = StatusFailed
+			e.claim.Error = "network is no longer configured"
+			e.claim.Final = true
+			close(e.done)
+		case claim.Status == StatusQueued:
+			changed = false
+			q.pending = append(q.pending, claim.ID)
+		case claim.TxHash != "" && claim.Status != StatusProcessing:
+			e.claim.Final = !m.trackLocked(e)
+			changed = e.claim.Final
+			close(e.done)
+		default:
+			e.claim.Status = StatusFailed
+			e.claim.Error = "interrupted by a restart while the transaction was being sent"
+			e.claim.Final = true
+			close(e.done)
+		}
+		m.claims[claim.ID] = e
+		if changed {
+			m.saveLocked(e)
+		}
+	}
+	if len(claims) > 0 {
+		log.Infof("Restored %d claims", len(claims))
+	}
+	m.pruneLocked()
+	return nil
+}
+
+// updateLocked persists e and notifies its subscribers, releasing them and
+// calling onDone once the claim is final
+func (m *Manager) updateLocked(e *entry) {
+	m.saveLocked(e)
+	m.pruneLocked()
+	if e.claim.Final && e.onDone != nil {
+		e.onDone(e.claim)
+		e.onDone = nil
+	}
+	for _, ch := range e.subscribers {
+		select {
+		case ch <- e.claim:
+		default:
+		}
+		if e.claim.Final {
+			close(ch)
+		}
+	}
+	if e.claim.Final {
+		e.subscribers = nil
+	}
+}
+
+// saveLocked persists the claim of e
+func (m *Manager) saveLocked(e *entry) {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Put(e.claim); err != nil {
+		log.WithError(err).WithField("claim", e.claim.ID).Error("Failed to persist claim")
+	}
+}
+
+// pruneLocked drops final claims past retention, at most once per pruneInterval
+func (m *Manager) pruneLocked() {
+	now := time.Now()
+	if now.Sub(m.pruned) < pruneInterval {
+		return
+	}
+	m.pruned = now
+
+	cutoff := now.Add(-m.retention)
+	var expired []string
+	for id, e := range m.claims {
+		if e.claim.Final && e.claim.UpdatedAt.Before(cutoff) {
+			delete(m.claims, id)
+			expired = append(expired, id)
+		}
+	}
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Delete(expired); err != nil {
+		log.WithError(err).Error("Failed to delete expired claims")
+	}
+}
+
+func newClaimID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
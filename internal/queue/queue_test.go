@@ -0,0 +1,520 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+)
+
+const testAddress = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+
+// fakeBuilder blocks every transfer until it is released
+type fakeBuilder struct {
+	release chan error
+}
+
+func newFakeBuilder() *fakeBuilder {
+	return &fakeBuilder{release: make(chan error)}
+}
+
+func (b *fakeBuilder) Sender() common.Address {
+	return common.Address{}
+}
+
+func (b *fakeBuilder) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	if err := <-b.release; err != nil {
+		return common.Hash{}, err
+	}
+	return common.HexToHash("0x01"), nil
+}
+
+func waitClaim(t *testing.T, m *Manager, id string) Claim {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	claim, err := m.Wait(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return claim
+}
+
+func TestManagerSubmit(t *testing.T) {
+	builder := newFakeBuilder()
+	m := NewManager(nil, time.Second)
+	m.AddNetwork("sepolia", builder, 1, 2)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	var finished []Claim
+	done := make(chan struct{}, 3)
+	onDone := func(c Claim) {
+		finished = append(finished, c)
+		done <- struct{}{}
+	}
+
+	first, _, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(1), onDone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the worker to pick up the first claim so the others stay queued
+	for {
+		if claim, _, _ := m.Get(first.ID); claim.Status == StatusProcessing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	second, pos, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(2), onDone)
+	if err != nil || pos != 1 {
+		t.Fatalf("second Submit() position = %d, err = %v", pos, err)
+	}
+	third, pos, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(3), onDone)
+	if err != nil || pos != 2 {
+		t.Fatalf("third Submit() position = %d, err = %v", pos, err)
+	}
+	if _, _, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(4), nil); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Submit() on a full queue error = %v, want %v", err, ErrQueueFull)
+	}
+	if _, _, err := m.Submit(context.Background(), "goerli", testAddress, big.NewInt(1), nil); !errors.Is(err, ErrUnknownNetwork) {
+		t.Fatalf("Submit() on unknown network error = %v, want %v", err, ErrUnknownNetwork)
+	}
+
+	builder.release <- nil
+	if claim := waitClaim(t, m, first.ID); claim.Status != StatusBroadcast || claim.TxHash == "" {
+		t.Errorf("first claim = %+v, want broadcast with tx hash", claim)
+	}
+	<-done
+	if _, pos, _ := m.Get(third.ID); pos != 1 {
+		t.Errorf("third claim position = %d, want 1", pos)
+	}
+
+	builder.release <- fmt.Errorf("%w: balance 0", chain.ErrInsufficientFaucetFunds)
+	if claim := waitClaim(t, m, second.ID); claim.Status != StatusFailed || claim.Error != "insufficient faucet funds: balance 0" || claim.Cause != CauseInsufficientFunds {
+		t.Errorf("second claim = %+v, want failed for insufficient funds", claim)
+	}
+	<-done
+	builder.release <- nil
+	waitClaim(t, m, third.ID)
+	<-done
+
+	if len(finished) != 3 {
+		t.Fatalf("onDone called %d times, want 3", len(finished))
+	}
+}
+
+func TestManagerCloseWaitsForWorkers(t *testing.T) {
+	builder := newFakeBuilder()
+	m := NewManager(nil, time.Second)
+	m.AddNetwork("sepolia", builder, 1, 10)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	claim, _, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if claim, _, _ := m.Get(claim.ID); claim.Status == StatusProcessing {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		m.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close() returned while a transfer was being sent")
+	case <-time.After(50 * time.Millisecond):
+	}
+	builder.release <- nil
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() did not return once the transfer was sent")
+	}
+	if claim, _, _ := m.Get(claim.ID); claim.Status != StatusBroadcast {
+		t.Errorf("claim status = %s, want %s", claim.Status, StatusBroadcast)
+	}
+}
+
+func TestManagerRestore(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "claims.json"))
+	now := time.Now()
+	claims := []Claim{
+		{ID: "processing", Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: StatusProcessing, CreatedAt: now, UpdatedAt: now},
+		{ID: "queued-2", Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: StatusQueued, CreatedAt: now.Add(2 * time.Second), UpdatedAt: now},
+		{ID: "queued-1", Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: StatusQueued, CreatedAt: now.Add(time.Second), UpdatedAt: now},
+		{ID: "removed", Network: "goerli", Address: testAddress, Amount: big.NewInt(1), Status: StatusQueued, CreatedAt: now, UpdatedAt: now},
+		{ID: "expired", Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: StatusBroadcast, Final: true, CreatedAt: now.Add(-48 * time.Hour), UpdatedAt: now.Add(-48 * time.Hour)},
+		{ID: "untracked", Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: StatusSigned, TxHash: "0x01", CreatedAt: now, UpdatedAt: now},
+	}
+	for _, claim := range claims {
+		if err := store.Put(claim); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	builder := newFakeBuilder()
+	m := NewManager(store, time.Second)
+	m.AddNetwork("sepolia", builder, 1, 10)
+	if err := m.restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		id         string
+		wantFound  bool
+		wantStatus Status
+		wantPos    int
+	}{
+		{id: "processing", wantFound: true, wantStatus: StatusFailed},
+		{id: "queued-1", wantFound: true, wantStatus: StatusQueued, wantPos: 1},
+		{id: "queued-2", wantFound: true, wantStatus: StatusQueued, wantPos: 2},
+		{id: "removed", wantFound: true, wantStatus: StatusFailed},
+		{id: "expired", wantFound: false},
+		{id: "untracked", wantFound: true, wantStatus: StatusSigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			claim, pos, found := m.Get(tt.id)
+			if found != tt.wantFound {
+				t.Fatalf("Get() found = %v, want %v", found, tt.wantFound)
+			}
+			if claim.Status != tt.wantStatus || pos != tt.wantPos {
+				t.Errorf("Get() = %s at %d, want %s at %d", claim.Status, pos, tt.wantStatus, tt.wantPos)
+			}
+		})
+	}
+
+	saved, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 5 {
+		t.Errorf("store has %d claims after restore, want 5", len(saved))
+	}
+}
+
+// fakeBatchBuilder records batched payouts. It fails every batch with
+// batchErr, if set, after signing it when signed is set. Its logs report the
+// recipients at the positions in refused as refusing their transfer, and
+// extraLogs more logs than the batch has recipients.
+type fakeBatchBuilder struct {
+	mutex     sync.Mutex
+	batches   [][]string
+	transfers []string
+	batchErr  error
+	signed    bool
+	refused   []int
+	extraLogs int
+}
+
+func (b *fakeBatchBuilder) Sender() common.Address {
+	return common.Address{}
+}
+
+func (b *fakeBatchBuilder) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.transfers = append(b.transfers, to)
+	return common.BigToHash(big.NewInt(int64(len(b.transfers)))), nil
+}
+
+func (b *fakeBatchBuilder) BatchTransfer(ctx context.Context, contract common.Address, to []string, values []*big.Int) (common.Hash, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	txHash := common.HexToHash("0xba7c4")
+	if b.signed {
+		chain.ContextTxTrace(ctx).Signed(txHash)
+	}
+	if b.batchErr != nil {
+		return txHash, b.batchErr
+	}
+	b.batches = append(b.batches, to)
+	return txHash, nil
+}
+
+func (b *fakeBatchBuilder) BatchLogs(ctx context.Context, contract common.Address, txHash common.Hash) ([]chain.BatchLog, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	logs := make([]chain.BatchLog, len(b.batches[len(b.batches)-1])+b.extraLogs)
+	for i := range logs {
+		logs[i].Index = uint(i) + 1
+	}
+	for _, i := range b.refused {
+		logs[i].Failed = true
+	}
+	return logs, nil
+}
+
+func TestManagerBatching(t *testing.T) {
+	tests := []struct {
+		name          string
+		batchErr      error
+		signed        bool
+		wantStatus    Status
+		wantBatches   int
+		wantTransfers int
+	}{
+		{name: "batched", signed: true, wantStatus: StatusBroadcast, wantBatches: 1},
+		{name: "fallback", batchErr: errors.New("execution reverted"), wantStatus: StatusBroadcast, wantTransfers: 3},
+		// A batch that may have been sent is not paid again claim by claim
+		{name: "timed out after signing", batchErr: fmt.Errorf("%w: context deadline exceeded", chain.ErrBroadcastUnknown), signed: true, wantStatus: StatusBroadcast},
+		{name: "refused after signing", batchErr: errors.New("transaction underpriced"), signed: true, wantStatus: StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &fakeBatchBuilder{batchErr: tt.batchErr, signed: tt.signed}
+			m := NewManager(nil, time.Second)
+			m.AddNetwork("sepolia", builder, 1, 10)
+			if err := m.SetBatching("sepolia", Batching{Window: 50 * time.Millisecond, MaxSize: 10}); err != nil {
+				t.Fatal(err)
+			}
+			if err := m.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			var ids []string
+			for i := 0; i < 3; i++ {
+				claim, _, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(int64(i+1)), nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, claim.ID)
+			}
+			for _, id := range ids {
+				if claim := waitClaim(t, m, id); claim.Status != tt.wantStatus {
+					t.Errorf("claim %s status = %s, want %s", id, claim.Status, tt.wantStatus)
+				}
+			}
+
+			builder.mutex.Lock()
+			defer builder.mutex.Unlock()
+			if len(builder.batches) != tt.wantBatches || len(builder.transfers) != tt.wantTransfers {
+				t.Fatalf("got %d batches and %d transfers, want %d and %d",
+					len(builder.batches), len(builder.transfers), tt.wantBatches, tt.wantTransfers)
+			}
+		})
+	}
+}
+
+func TestManagerBatchLogs(t *testing.T) {
+	tests := []struct {
+		name      string
+		refused   []int
+		extraLogs int
+		// wantIndexes are the log indexes of the claims, 0 for none
+		wantIndexes []uint
+		wantStatus  []Status
+	}{
+		{name: "one log per claim", wantIndexes: []uint{1, 2}, wantStatus: []Status{StatusMined, StatusMined}},
+		// A mined batch paid its claims even when its logs cannot be told apart
+		{name: "more logs than claims", extraLogs: 1, wantIndexes: []uint{0, 0}, wantStatus: []Status{StatusMined, StatusMined}},
+		{name: "refused by a recipient", refused: []int{1}, wantIndexes: []uint{1, 0}, wantStatus: []Status{StatusMined, StatusFailed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &fakeBatchBuilder{refused: tt.refused, extraLogs: tt.extraLogs}
+			m := NewManager(nil, time.Second)
+			m.AddNetwork("sepolia", builder, 1, 10)
+			entries := []*entry{
+				{claim: Claim{ID: "a", Status: StatusMined}, done: make(chan struct{})},
+				{claim: Claim{ID: "b", Status: StatusMined}, done: make(chan struct{})},
+			}
+			builder.batches = [][]string{{testAddress, testAddress}}
+
+			m.resolveBatchLogs(builder, common.Address{}, entries, common.HexToHash("0xba7c4"))
+			for i, e := range entries {
+				var index uint
+				if e.claim.LogIndex != nil {
+					index = *e.claim.LogIndex
+				}
+				if e.claim.Status != tt.wantStatus[i] || index != tt.wantIndexes[i] {
+					t.Errorf("claim %s is %s with log index %d, want %s with %d", e.claim.ID, e.claim.Status, index, tt.wantStatus[i], tt.wantIndexes[i])
+				}
+				if failed := e.claim.Status == StatusFailed; e.claim.Final != failed || failed && e.claim.Cause != CauseRecipientReverts {
+					t.Errorf("claim %s = %+v, only a refused claim is final", e.claim.ID, e.claim)
+				}
+			}
+		})
+	}
+}
+
+// watchingBuilder signs and sends every transfer at once and reports the
+// transaction mined after a few polls. Sending fails with sendErr, if set.
+type watchingBuilder struct {
+	mutex    sync.Mutex
+	statuses []chain.TxStatus
+	sendErr  error
+}
+
+func (b *watchingBuilder) Sender() common.Address {
+	return common.Address{}
+}
+
+func (b *watchingBuilder) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	txHash := common.HexToHash("0x01")
+	chain.ContextTxTrace(ctx).Signed(txHash)
+	return txHash, b.sendErr
+}
+
+func (b *watchingBuilder) TxStatus(ctx context.Context, txHash common.Hash) (*chain.TxStatus, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	status := b.statuses[0]
+	if len(b.statuses) > 1 {
+		b.statuses = b.statuses[1:]
+	}
+	return &status, nil
+}
+
+func TestManagerTracking(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []chain.TxStatus
+		sendErr    error
+		wantEvents []string
+		// wantDone is the status onDone is called with, once the claim is final
+		wantDone Status
+	}{
+		{
+			name: "confirmed",
+			statuses: []chain.TxStatus{
+				{},
+				{Mined: true, Successful: true, BlockNumber: 10, Confirmations: 1},
+				{Mined: true, Successful: true, BlockNumber: 10, Confirmations: 2},
+			},
+			wantEvents: []string{"processing", "signed", "broadcast", "mined/1", "mined/2"},
+			wantDone:   StatusMined,
+		},
+		{
+			name: "reverted",
+			statuses: []chain.TxStatus{
+				{Mined: true, BlockNumber: 10, Confirmations: 1},
+			},
+			wantEvents: []string{"processing", "signed", "broadcast", "failed"},
+			wantDone:   StatusFailed,
+		},
+		{
+			// The rate limit reservation of the claim is rolled back
+			name: "broadcast, then failed by the tracker",
+			statuses: []chain.TxStatus{
+				{},
+				{},
+				{Mined: true, BlockNumber: 10, Confirmations: 1},
+			},
+			wantEvents: []string{"processing", "signed", "broadcast", "failed"},
+			wantDone:   StatusFailed,
+		},
+		{
+			name: "send timed out",
+			statuses: []chain.TxStatus{
+				{Mined: true, Successful: true, BlockNumber: 10, Confirmations: 2},
+			},
+			sendErr:    fmt.Errorf("%w: context deadline exceeded", chain.ErrBroadcastUnknown),
+			wantEvents: []string{"processing", "signed", "broadcast", "mined/2"},
+			wantDone:   StatusMined,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &watchingBuilder{statuses: tt.statuses, sendErr: tt.sendErr}
+			m := NewManager(nil, time.Second)
+			m.AddNetwork("sepolia", builder, 1, 10)
+			m.SetConfirmations(2)
+			m.trackInterval = time.Millisecond
+
+			// Subscribe before the workers start so no update is missed
+			done := make(chan Status, 2)
+			claim, _, err := m.Submit(context.Background(), "sepolia", testAddress, big.NewInt(1), func(c Claim) {
+				done <- c.Status
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, updates, cancel, err := m.Subscribe(claim.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cancel()
+			if err := m.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			var events []string
+			timeout := time.After(5 * time.Second)
+			for done := false; !done; {
+				select {
+				case update, ok := <-updates:
+					if !ok {
+						done = true
+						break
+					}
+					event := string(update.Status)
+					if update.Status == StatusMined {
+						event = fmt.Sprintf("%s/%d", event, update.Confirmations)
+					}
+					events = append(events, event)
+				case <-timeout:
+					t.Fatalf("claim was not final in time, got events %v", events)
+				}
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("events = %v, want %v", events, tt.wantEvents)
+			}
+			var calls []Status
+			for len(done) > 0 {
+				calls = append(calls, <-done)
+			}
+			if !reflect.DeepEqual(calls, []Status{tt.wantDone}) {
+				t.Errorf("onDone called with %v, want once with %s", calls, tt.wantDone)
+			}
+		})
+	}
+}
+
+// gapBuilder reports every call to FillNonceGaps
+type gapBuilder struct {
+	*fakeBuilder
+	fills chan struct{}
+}
+
+func (b *gapBuilder) FillNonceGaps(ctx context.Context) (int, error) {
+	b.fills <- struct{}{}
+	return 1, nil
+}
+
+func TestManagerFillsNonceGapsOnStart(t *testing.T) {
+	builder := &gapBuilder{fakeBuilder: newFakeBuilder(), fills: make(chan struct{}, 1)}
+	m := NewManager(nil, time.Second)
+	m.AddNetwork("sepolia", builder, 1, 10)
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	select {
+	case <-builder.fills:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nonce gaps were not filled on start")
+	}
+}
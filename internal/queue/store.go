@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/atomicfile"
+)
+
+// Store persists claims across restarts
+type Store interface {
+	// Load returns the claims that were put and not deleted since
+	Load() ([]Claim, error)
+	// Put saves a new or changed claim
+	Put(claim Claim) error
+	// Delete forgets claims, e.g. final ones past retention
+	Delete(ids []string) error
+}
+
+// minCompactRecords is the size of the log below which it is never compacted
+const minCompactRecords = 1000
+
+// FileStore keeps claims in a log of JSON lines with one record per change,
+// so a change costs the same however many claims are kept. The log is
+// rewritten with only the current claims once most of its records are stale.
+type FileStore struct {
+	path string
+
+	mutex sync.Mutex
+	// records is the number of lines in the log
+	records int
+	// live are the IDs of the claims in the log that are not deleted
+	live map[string]bool
+}
+
+// storeRecord is a line of the log, either a claim or deleted IDs
+type storeRecord struct {
+	Claim   *Claim   `json:"claim,omitempty"`
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path, live: make(map[string]bool)}
+}
+
+// Load replays the log and compacts it
+func (s *FileStore) Load() ([]Claim, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	claims, err := s.replay()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.compactLocked(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *FileStore) Put(claim Claim) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.appendLocked(storeRecord{Claim: &claim}); err != nil {
+		return err
+	}
+	s.live[claim.ID] = true
+	return s.maybeCompactLocked()
+}
+
+func (s *FileStore) Delete(ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := s.appendLocked(storeRecord{Deleted: ids}); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		delete(s.live, id)
+	}
+	return s.maybeCompactLocked()
+}
+
+func (s *FileStore) appendLocked(record storeRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	s.records++
+	return f.Close()
+}
+
+// maybeCompactLocked compacts the log once it has several records per claim
+func (s *FileStore) maybeCompactLocked() error {
+	if s.records < minCompactRecords || s.records < 4*len(s.live) {
+		return nil
+	}
+	claims, err := s.replay()
+	if err != nil {
+		return err
+	}
+	return s.compactLocked(claims)
+}
+
+// compactLocked replaces the log with one record per claim
+func (s *FileStore) compactLocked(claims []Claim) error {
+	var buf bytes.Buffer
+	for i := range claims {
+		data, err := json.Marshal(storeRecord{Claim: &claims[i]})
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	if err := atomicfile.Write(s.path, buf.Bytes()); err != nil {
+		return err
+	}
+
+	s.records = len(claims)
+	s.live = make(map[string]bool, len(claims))
+	for _, claim := range claims {
+		s.live[claim.ID] = true
+	}
+	return nil
+}
+
+// replay reads the current claims from the log, in the order they were first put
+func (s *FileStore) replay() ([]Claim, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	latest := make(map[string]Claim)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record storeRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// A crash while appending leaves the last record incomplete
+			log.WithError(err).WithField("line", line).Warn("Skipping unreadable claim record")
+			continue
+		}
+		if record.Claim != nil {
+			if _, exists := latest[record.Claim.ID]; !exists {
+				order = append(order, record.Claim.ID)
+			}
+			latest[record.Claim.ID] = *record.Claim
+		}
+		for _, id := range record.Deleted {
+			delete(latest, id)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	claims := make([]Claim, 0, len(latest))
+	for _, id := range order {
+		if claim, exists := latest[id]; exists {
+			claims = append(claims, claim)
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,112 @@
+package queue
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countLines returns the number of records in the log at path
+func countLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		lines++
+	}
+	return lines
+}
+
+func TestFileStoreManyClaims(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "claims.json")
+	store := NewFileStore(path)
+	const claims = 5000
+	statuses := []Status{StatusQueued, StatusProcessing, StatusSigned, StatusBroadcast, StatusMined}
+
+	now := time.Now()
+	for _, status := range statuses {
+		for i := 0; i < claims; i++ {
+			claim := Claim{ID: fmt.Sprint(i), Network: "sepolia", Address: testAddress, Amount: big.NewInt(1), Status: status, CreatedAt: now}
+			if err := store.Put(claim); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var expired []string
+	for i := 0; i < claims; i += 2 {
+		expired = append(expired, fmt.Sprint(i))
+	}
+	if err := store.Delete(expired); err != nil {
+		t.Fatal(err)
+	}
+	// Stale records are compacted away while claims change
+	if lines := countLines(t, path); lines > 4*claims+1 {
+		t.Errorf("log has %d records for %d claims", lines, claims)
+	}
+
+	loaded, err := NewFileStore(path).Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != claims/2 {
+		t.Fatalf("Load() = %d claims, want %d", len(loaded), claims/2)
+	}
+	for i, claim := range loaded {
+		if want := fmt.Sprint(2*i + 1); claim.ID != want || claim.Status != StatusMined {
+			t.Fatalf("claim %d = %s %s, want %s mined", i, claim.ID, claim.Status, want)
+		}
+	}
+	if lines := countLines(t, path); lines != claims/2 {
+		t.Errorf("log has %d records after loading %d claims", lines, claims/2)
+	}
+}
+
+func TestFileStoreLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantIDs []string
+	}{
+		{name: "missing"},
+		{name: "incomplete last record", content: `{"claim":{"id":"a","status":"queued"}}` + "\n" + `{"claim":{"id":"b","sta`, wantIDs: []string{"a"}},
+		{name: "deleted", content: `{"claim":{"id":"a"}}` + "\n" + `{"claim":{"id":"b"}}` + "\n" + `{"deleted":["a"]}` + "\n", wantIDs: []string{"b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "claims.json")
+			if tt.content != "" {
+				if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			claims, err := NewFileStore(path).Load()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, claim := range claims {
+				ids = append(ids, claim.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("Load() = %v, want %v", ids, tt.wantIDs)
+			}
+			// Loading leaves a log that loads the same claims
+			data, _ := os.ReadFile(path)
+			if strings.HasPrefix(string(data), "[") {
+				t.Errorf("file was not rewritten as a log: %s", data)
+			}
+			reloaded, err := NewFileStore(path).Load()
+			if err != nil || len(reloaded) != len(claims) {
+				t.Errorf("Load() again = %d claims, %v, want %d", len(reloaded), err, len(claims))
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+)
+
+// trackTimeout is how long a broadcast transaction may take to be mined
+const trackTimeout = 30 * time.Minute
+
+// trackedTx is a broadcast transaction together with the claims it pays
+type trackedTx struct {
+	network string
+	entries []*entry
+	since   time.Time
+	// resolved is set once the logs of a batch were looked up
+	resolved bool
+}
+
+// trackLocked hands a sent claim to the tracker and reports whether the
+// claim's network can watch transactions at all
+func (m *Manager) trackLocked(e *entry) bool {
+	q, ok := m.queues[e.claim.Network]
+	if !ok {
+		return false
+	}
+	if _, ok := q.builder.(chain.TxWatcher); !ok {
+		return false
+	}
+
+	hash := common.HexToHash(e.claim.TxHash)
+	t, ok := m.tracked[hash]
+	if !ok {
+		t = &trackedTx{network: e.claim.Network, since: time.Now()}
+		m.tracked[hash] = t
+	}
+	t.entries = append(t.entries, e)
+	return true
+}
+
+// track polls every tracked transaction until it has enough confirmations,
+// reverts or is not mined in time
+func (m *Manager) track() {
+	ticker := time.NewTicker(m.trackInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+
+		m.mutex.Lock()
+		txs := make(map[common.Hash]*trackedTx, len(m.tracked))
+		for hash, t := range m.tracked {
+			txs[hash] = t
+		}
+		m.mutex.Unlock()
+
+		for hash, t := range txs {
+			m.checkTx(hash, t)
+		}
+	}
+}
+
+func (m *Manager) checkTx(hash common.Hash, t *trackedTx) {
+	builder := m.queues[t.network].builder
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	status, err := builder.(chain.TxWatcher).TxStatus(ctx, hash)
+	cancel()
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"txHash":  hash,
+			"network": t.network,
+		}).Warn("Failed to get transaction status")
+	}
+
+	if err == nil && status.Mined && status.Successful && len(t.entries) > 1 && !t.resolved {
+		batch := m.queues[t.network].batch
+		if batcher, ok := builder.(chain.BatchTxBuilder); ok && batch != nil {
+			t.resolved = true
+			m.resolveBatchLogs(batcher, batch.Contract, t.entries, hash)
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var errMsg string
+	switch {
+	case err != nil || !status.Mined:
+		if time.Since(t.since) < trackTimeout {
+			if err == nil {
+				// The transaction may have been dropped by a reorg
+				for _, e := range t.entries {
+					if e.claim.Status == StatusMined {
+						m.setLocked(e, StatusBroadcast, 0, 0)
+					}
+				}
+			}
+			return
+		}
+		errMsg = fmt.Sprintf("transaction was not mined within %s", trackTimeout)
+		// The node may have dropped it, leaving a gap that blocks later payouts
+		m.goRun(func() { m.fillNonceGaps(t.network, m.queues[t.network]) })
+	case !status.Successful:
+		errMsg = "transaction reverted"
+	}
+
+	final := errMsg != "" || status.Confirmations >= m.confirmations
+	done := true
+	for _, e := range t.entries {
+		if e.claim.Final {
+			continue
+		}
+		done = done && final
+		if errMsg != "" {
+			e.claim.Status = StatusFailed
+			e.claim.Error = errMsg
+			e.claim.Final = true
+			e.claim.UpdatedAt = time.Now()
+			m.updateLocked(e)
+			continue
+		}
+		e.claim.Final = final
+		m.setLocked(e, StatusMined, status.BlockNumber, status.Confirmations)
+	}
+	if done {
+		delete(m.tracked, hash)
+	}
+	if errMsg != "" {
+		log.WithFields(log.Fields{
+			"txHash":  hash,
+			"network": t.network,
+		}).Error(errMsg)
+	}
+}
+
+// setLocked updates the on-chain state of a tracked claim, notifying
+// subscribers only when something changed
+func (m *Manager) setLocked(e *entry, status Status, blockNumber, confirmations uint64) {
+	if e.claim.Status == status && e.claim.BlockNumber == blockNumber &&
+		e.claim.Confirmations == confirmations && !e.claim.Final {
+		return
+	}
+	e.claim.Status = status
+	e.claim.BlockNumber = blockNumber
+	e.claim.Confirmations = confirmations
+	e.claim.UpdatedAt = time.Now()
+	m.updateLocked(e)
+}
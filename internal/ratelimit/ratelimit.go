@@ -0,0 +1,405 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// KeyType identifies what a rule counts claims against
+type KeyType string
+
+const (
+	KeyAddress KeyType = "address"
+	KeyIP      KeyType = "ip"
+	KeySubnet  KeyType = "subnet"
+	KeyAPIKey  KeyType = "api_key"
+	// KeyUser is the user of a social login, as reported by the auth proxy
+	KeyUser KeyType = "user"
+)
+
+// Algorithm selects how a rule accounts for claims over time
+type Algorithm string
+
+const (
+	// SlidingWindow allows at most Limit claims in any Window-long period
+	SlidingWindow Algorithm = "sliding_window"
+	// TokenBucket refills Limit tokens per Window up to Burst tokens
+	TokenBucket Algorithm = "token_bucket"
+)
+
+// sweepEvery controls how many reservations pass between sweeps of idle state
+const sweepEvery = 1024
+
+// Rule limits claims for one key type, e.g. "3 per address per day". A rule
+// with a Quota limits the amount claimed in native units instead, e.g.
+// "2 ETH per address per day".
+type Rule struct {
+	Key       KeyType
+	Limit     int
+	Quota     decimal.Decimal
+	Window    time.Duration
+	Algorithm Algorithm
+	Burst     int
+}
+
+// Validate reports whether the rule is usable
+func (r Rule) Validate() error {
+	switch r.Key {
+	case KeyAddress, KeyIP, KeySubnet, KeyAPIKey, KeyUser:
+	default:
+		return fmt.Errorf("unknown rate limit key %q", r.Key)
+	}
+	switch r.Algorithm {
+	case "", SlidingWindow, TokenBucket:
+	default:
+		return fmt.Errorf("unknown rate limit algorithm %q", r.Algorithm)
+	}
+	if r.Quota.IsNegative() {
+		return fmt.Errorf("rate limit quota for %s must not be negative", r.Key)
+	}
+	if r.Quota.IsPositive() && r.Limit != 0 {
+		return fmt.Errorf("rate limit for %s cannot set both limit and quota", r.Key)
+	}
+	if r.Quota.IsZero() && r.Limit <= 0 {
+		return fmt.Errorf("rate limit for %s must be positive", r.Key)
+	}
+	if r.Window <= 0 {
+		return fmt.Errorf("rate limit window for %s must be positive", r.Key)
+	}
+	if r.Burst < 0 {
+		return fmt.Errorf("rate limit burst for %s must not be negative", r.Key)
+	}
+	return nil
+}
+
+func (r Rule) String() string {
+	if r.Quota.IsPositive() {
+		return fmt.Sprintf("%s in total per %s every %s", r.Quota, r.Key, FormatWindow(r.Window))
+	}
+	return fmt.Sprintf("%d per %s every %s", r.Limit, r.Key, FormatWindow(r.Window))
+}
+
+// size returns what the rule admits per window, claims or an amount
+func (r Rule) size() decimal.Decimal {
+	if r.Quota.IsPositive() {
+		return r.Quota
+	}
+	return decimal.NewFromInt(int64(r.Limit))
+}
+
+// cost returns what a claim of amount consumes from the rule
+func (r Rule) cost(amount decimal.Decimal) decimal.Decimal {
+	if r.Quota.IsPositive() {
+		return amount
+	}
+	return decimal.NewFromInt(1)
+}
+
+// capacity returns the size of a token bucket. Token buckets refill
+// continuously, so unlike sliding windows they count in floats.
+func (r Rule) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return r.size().InexactFloat64()
+}
+
+// refillRate returns the number of tokens added per second
+func (r Rule) refillRate() float64 {
+	return r.size().InexactFloat64() / r.Window.Seconds()
+}
+
+// Keys maps each key type to the value identifying the caller, e.g. its address.
+// Rules whose key type is missing from Keys are skipped.
+type Keys map[KeyType]string
+
+type stateKey struct {
+	rule  int
+	value string
+}
+
+// event is a claim counted by a sliding window
+type event struct {
+	at   time.Time
+	cost decimal.Decimal
+}
+
+// state tracks one key value for one rule. Sliding windows use events,
+// token buckets use tokens and updated.
+type state struct {
+	events  []event
+	tokens  float64
+	updated time.Time
+}
+
+// Policy enforces a set of rules for one network
+type Policy struct {
+	mutex    sync.Mutex
+	rules    []Rule
+	states   map[stateKey]*state
+	reserved int
+	now      func() time.Time
+}
+
+// NewPolicy creates a policy from the given rules
+func NewPolicy(rules ...Rule) (*Policy, error) {
+	for i := range rules {
+		if err := rules[i].Validate(); err != nil {
+			return nil, err
+		}
+		if rules[i].Algorithm == "" {
+			rules[i].Algorithm = SlidingWindow
+		}
+	}
+	return &Policy{
+		rules:  rules,
+		states: make(map[stateKey]*state),
+		now:    time.Now,
+	}, nil
+}
+
+// Rules returns the rules enforced by the policy
+func (p *Policy) Rules() []Rule {
+	return p.rules
+}
+
+// Reserve consumes one claim from every applicable rule. Quota rules are
+// not charged. When any rule is exhausted nothing is consumed and the
+// reservation reports how long the caller has to wait.
+func (p *Policy) Reserve(keys Keys) *Reservation {
+	return p.ReserveAmount(keys, decimal.Zero)
+}
+
+// ReserveAmount is like Reserve for a claim of amount, which is charged to
+// the quota rules
+func (p *Policy) ReserveAmount(keys Keys, amount decimal.Decimal) *Reservation {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	p.reserved++
+	if p.reserved%sweepEvery == 0 {
+		p.sweep(now)
+	}
+
+	res := &Reservation{policy: p, at: now, amount: amount, ok: true}
+	for i, rule := range p.rules {
+		value, ok := keys[rule.Key]
+		if !ok || value == "" {
+			continue
+		}
+		sk := stateKey{rule: i, value: value}
+		st := p.stateFor(sk, now)
+		if wait := p.waitTime(rule, st, rule.cost(amount), now); wait > 0 {
+			res.ok = false
+			if wait > res.retryAfter {
+				res.retryAfter = wait
+				res.rule = rule
+			}
+			continue
+		}
+		res.consumed = append(res.consumed, sk)
+	}
+
+	if !res.ok {
+		res.consumed = nil
+		return res
+	}
+	for _, sk := range res.consumed {
+		p.take(p.rules[sk.rule], p.states[sk], amount, now)
+	}
+	return res
+}
+
+func (p *Policy) stateFor(sk stateKey, now time.Time) *state {
+	st, ok := p.states[sk]
+	if !ok {
+		rule := p.rules[sk.rule]
+		st = &state{tokens: rule.capacity(), updated: now}
+		p.states[sk] = st
+	}
+	return st
+}
+
+// waitTime returns how long until the rule admits a claim of cost. A cost
+// larger than the rule admits at once is reported as a wait of one window.
+func (p *Policy) waitTime(rule Rule, st *state, cost decimal.Decimal, now time.Time) time.Duration {
+	switch rule.Algorithm {
+	case TokenBucket:
+		tokens := cost.InexactFloat64()
+		if tokens > rule.capacity() {
+			return rule.Window
+		}
+		p.refill(rule, st, now)
+		if st.tokens >= tokens {
+			return 0
+		}
+		return time.Duration(math.Ceil((tokens - st.tokens) / rule.refillRate() * float64(time.Second)))
+	default:
+		size := rule.size()
+		if cost.GreaterThan(size) {
+			return rule.Window
+		}
+		st.events = prune(st.events, now.Add(-rule.Window))
+		used := decimal.Zero
+		for _, e := range st.events {
+			used = used.Add(e.cost)
+		}
+		if used.Add(cost).LessThanOrEqual(size) {
+			return 0
+		}
+		// The claim becomes possible once enough of the oldest events expire
+		for _, e := range st.events {
+			used = used.Sub(e.cost)
+			if used.Add(cost).LessThanOrEqual(size) {
+				return e.at.Add(rule.Window).Sub(now)
+			}
+		}
+		return rule.Window
+	}
+}
+
+func (p *Policy) take(rule Rule, st *state, amount decimal.Decimal, now time.Time) {
+	switch rule.Algorithm {
+	case TokenBucket:
+		st.tokens -= rule.cost(amount).InexactFloat64()
+	default:
+		st.events = append(st.events, event{at: now, cost: rule.cost(amount)})
+	}
+}
+
+func (p *Policy) give(rule Rule, st *state, amount decimal.Decimal, at time.Time) {
+	switch rule.Algorithm {
+	case TokenBucket:
+		st.tokens = math.Min(st.tokens+rule.cost(amount).InexactFloat64(), rule.capacity())
+	default:
+		for i := len(st.events) - 1; i >= 0; i-- {
+			if st.events[i].at.Equal(at) {
+				st.events = append(st.events[:i], st.events[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (p *Policy) refill(rule Rule, st *state, now time.Time) {
+	elapsed := now.Sub(st.updated).Seconds()
+	if elapsed > 0 {
+		st.tokens = math.Min(st.tokens+elapsed*rule.refillRate(), rule.capacity())
+		st.updated = now
+	}
+}
+
+// sweep drops state that no longer restricts anybody
+func (p *Policy) sweep(now time.Time) {
+	for sk, st := range p.states {
+		rule := p.rules[sk.rule]
+		if p.waitTime(rule, st, decimal.Zero, now) == 0 && len(st.events) == 0 && st.tokens >= rule.capacity() {
+			delete(p.states, sk)
+		}
+	}
+}
+
+func prune(events []event, cutoff time.Time) []event {
+	i := 0
+	for i < len(events) && !events[i].at.After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
+
+// Reservation is the result of Policy.Reserve. An allowed reservation holds
+// its claims until it is either committed or rolled back.
+type Reservation struct {
+	policy     *Policy
+	at         time.Time
+	amount     decimal.Decimal
+	ok         bool
+	retryAfter time.Duration
+	rule       Rule
+	consumed   []stateKey
+}
+
+// OK reports whether the claim is allowed
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// RetryAfter returns how long the caller must wait before every rule admits a claim
+func (r *Reservation) RetryAfter() time.Duration {
+	return r.retryAfter
+}
+
+// Rule returns the rule that rejected the claim
+func (r *Reservation) Rule() Rule {
+	return r.rule
+}
+
+// Commit keeps the claims for the rest of their window. A committed
+// reservation can no longer be rolled back.
+func (r *Reservation) Commit() {
+	p := r.policy
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	r.consumed = nil
+}
+
+// Rollback gives back what the reservation consumed. It is a no-op once the
+// reservation has been committed or rolled back.
+func (r *Reservation) Rollback() {
+	p := r.policy
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, sk := range r.consumed {
+		if st, ok := p.states[sk]; ok {
+			p.give(p.rules[sk.rule], st, r.amount, r.at)
+		}
+	}
+	r.consumed = nil
+}
+
+// ParseWindow parses a window duration. In addition to time.ParseDuration
+// units it accepts whole days ("1d") and weeks ("1w").
+func ParseWindow(s string) (time.Duration, error) {
+	var unit time.Duration
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	default:
+		return time.ParseDuration(s)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s[:len(s)-1]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// FormatWindow formats a window the way ParseWindow reads it
+func FormatWindow(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d >= 7*day && d%(7*day) == 0:
+		return fmt.Sprintf("%dw", d/(7*day))
+	case d >= day && d%day == 0:
+		return fmt.Sprintf("%dd", d/day)
+	}
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,250 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestPolicy(t *testing.T, clock *fakeClock, rules ...Rule) *Policy {
+	policy, err := NewPolicy(rules...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy.now = clock.Now
+	return policy
+}
+
+func TestPolicyReserve(t *testing.T) {
+	day := 24 * time.Hour
+	week := 7 * day
+	keys := Keys{KeyAddress: "0xab5801a7d398351b8be11c439e05c5b3259aec9b", KeyIP: "127.0.0.1"}
+
+	type step struct {
+		advance    time.Duration
+		keys       Keys
+		amount     string
+		wantOK     bool
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		rules []Rule
+		steps []step
+	}{
+		{
+			name:  "sliding window",
+			rules: []Rule{{Key: KeyAddress, Limit: 2, Window: day}},
+			steps: []step{
+				{keys: keys, wantOK: true},
+				{advance: time.Hour, keys: keys, wantOK: true},
+				{advance: time.Hour, keys: keys, wantOK: false, retryAfter: 22 * time.Hour},
+				{advance: 22 * time.Hour, keys: keys, wantOK: true},
+			},
+		},
+		{
+			name: "daily and weekly windows",
+			rules: []Rule{
+				{Key: KeyAddress, Limit: 3, Window: day},
+				{Key: KeyAddress, Limit: 4, Window: week},
+			},
+			steps: []step{
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: false, retryAfter: day},
+				{advance: day, keys: keys, wantOK: true},
+				{keys: keys, wantOK: false, retryAfter: week - day},
+			},
+		},
+		{
+			name:  "token bucket with burst",
+			rules: []Rule{{Key: KeyIP, Limit: 1, Window: time.Hour, Algorithm: TokenBucket, Burst: 2}},
+			steps: []step{
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: false, retryAfter: time.Hour},
+				{advance: 30 * time.Minute, keys: keys, wantOK: false, retryAfter: 30 * time.Minute},
+				{advance: 30 * time.Minute, keys: keys, wantOK: true},
+			},
+		},
+		{
+			name:  "missing key skips rule",
+			rules: []Rule{{Key: KeyAPIKey, Limit: 1, Window: day}},
+			steps: []step{
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: true},
+			},
+		},
+		{
+			name: "rejection consumes nothing",
+			rules: []Rule{
+				{Key: KeyAddress, Limit: 1, Window: day},
+				{Key: KeyIP, Limit: 2, Window: day},
+			},
+			steps: []step{
+				{keys: keys, wantOK: true},
+				{keys: keys, wantOK: false, retryAfter: day},
+				{keys: Keys{KeyAddress: "0xd8da6bf26964af9d7eed9e03e53415d37aa96045", KeyIP: "127.0.0.1"}, wantOK: true},
+			},
+		},
+		{
+			name:  "sliding window quota",
+			rules: []Rule{{Key: KeyAddress, Quota: decimal.RequireFromString("2"), Window: day}},
+			steps: []step{
+				{keys: keys, amount: "1.5", wantOK: true},
+				{advance: time.Hour, keys: keys, amount: "0.5", wantOK: true},
+				{advance: time.Hour, keys: keys, amount: "0.1", wantOK: false, retryAfter: 22 * time.Hour},
+				{advance: 22 * time.Hour, keys: keys, amount: "1.5", wantOK: true},
+				{keys: keys, amount: "3", wantOK: false, retryAfter: day},
+			},
+		},
+		{
+			name:  "sliding window quota is exact",
+			rules: []Rule{{Key: KeyAddress, Quota: decimal.RequireFromString("0.3"), Window: day}},
+			steps: []step{
+				{keys: keys, amount: "0.1", wantOK: true},
+				{keys: keys, amount: "0.2", wantOK: true},
+				{keys: keys, amount: "0.000000000000000001", wantOK: false, retryAfter: day},
+			},
+		},
+		{
+			name:  "token bucket quota",
+			rules: []Rule{{Key: KeyAddress, Quota: decimal.RequireFromString("2"), Window: time.Hour, Algorithm: TokenBucket}},
+			steps: []step{
+				{keys: keys, amount: "2", wantOK: true},
+				{advance: 15 * time.Minute, keys: keys, amount: "1", wantOK: false, retryAfter: 15 * time.Minute},
+				{advance: 15 * time.Minute, keys: keys, amount: "1", wantOK: true},
+			},
+		},
+		{
+			name: "claim counts ignore the amount",
+			rules: []Rule{
+				{Key: KeyAddress, Limit: 1, Window: day},
+				{Key: KeyIP, Quota: decimal.RequireFromString("10"), Window: day},
+			},
+			steps: []step{
+				{keys: keys, amount: "5", wantOK: true},
+				{keys: Keys{KeyIP: "127.0.0.1"}, amount: "5", wantOK: true},
+				{keys: Keys{KeyIP: "127.0.0.1"}, amount: "1", wantOK: false, retryAfter: day},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			policy := newTestPolicy(t, clock, tt.rules...)
+			for i, s := range tt.steps {
+				clock.Advance(s.advance)
+				amount := decimal.Zero
+				if s.amount != "" {
+					amount = decimal.RequireFromString(s.amount)
+				}
+				res := policy.ReserveAmount(s.keys, amount)
+				if res.OK() != s.wantOK {
+					t.Fatalf("step %d: OK() = %v, want %v", i, res.OK(), s.wantOK)
+				}
+				if res.RetryAfter() != s.retryAfter {
+					t.Errorf("step %d: RetryAfter() = %v, want %v", i, res.RetryAfter(), s.retryAfter)
+				}
+			}
+		})
+	}
+}
+
+func TestReservationRollback(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      Rule
+		commit    bool
+		wantAfter bool
+	}{
+		{name: "sliding window rollback", rule: Rule{Key: KeyAddress, Limit: 1, Window: time.Hour}, wantAfter: true},
+		{name: "token bucket rollback", rule: Rule{Key: KeyAddress, Limit: 1, Window: time.Hour, Algorithm: TokenBucket}, wantAfter: true},
+		{name: "rollback after commit", rule: Rule{Key: KeyAddress, Limit: 1, Window: time.Hour}, commit: true, wantAfter: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Unix(1700000000, 0)}
+			policy := newTestPolicy(t, clock, tt.rule)
+			keys := Keys{KeyAddress: "0xab5801a7d398351b8be11c439e05c5b3259aec9b"}
+
+			res := policy.Reserve(keys)
+			if !res.OK() {
+				t.Fatal("first reservation rejected")
+			}
+			if policy.Reserve(keys).OK() {
+				t.Fatal("second reservation allowed while the first is pending")
+			}
+			if tt.commit {
+				res.Commit()
+			}
+			res.Rollback()
+			res.Rollback()
+			if got := policy.Reserve(keys).OK(); got != tt.wantAfter {
+				t.Errorf("reservation after rollback OK() = %v, want %v", got, tt.wantAfter)
+			}
+		})
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "valid", rule: Rule{Key: KeySubnet, Limit: 1, Window: time.Hour}},
+		{name: "unknown key", rule: Rule{Key: "country", Limit: 1, Window: time.Hour}, wantErr: true},
+		{name: "unknown algorithm", rule: Rule{Key: KeyIP, Limit: 1, Window: time.Hour, Algorithm: "leaky"}, wantErr: true},
+		{name: "zero limit", rule: Rule{Key: KeyIP, Window: time.Hour}, wantErr: true},
+		{name: "zero window", rule: Rule{Key: KeyIP, Limit: 1}, wantErr: true},
+		{name: "quota", rule: Rule{Key: KeyUser, Quota: decimal.RequireFromString("0.5"), Window: time.Hour}},
+		{name: "limit and quota", rule: Rule{Key: KeyIP, Limit: 1, Quota: decimal.RequireFromString("0.5"), Window: time.Hour}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		window  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{window: "90m", want: 90 * time.Minute},
+		{window: "1d", want: 24 * time.Hour},
+		{window: "2w", want: 14 * 24 * time.Hour},
+		{window: "xd", wantErr: true},
+		{window: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.window, func(t *testing.T) {
+			got, err := ParseWindow(tt.window)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/negroni/v3"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
+)
+
+// Auditor writes one audit event per claim attempt. It has to run first in
+// the claim chain, so that the Limiter, the Captcha and the handler can
+// record their decisions on the request.
+type Auditor struct {
+	log        *audit.Logger
+	proxyCount int
+}
+
+// NewAuditor creates an auditor writing to logger, which passes requests
+// through when logger is nil
+func NewAuditor(logger *audit.Logger, proxyCount int) *Auditor {
+	return &Auditor{log: logger, proxyCount: proxyCount}
+}
+
+func (a *Auditor) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	if a.log == nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	requestID := r.Header.Get("X-Request-ID")
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+	w.Header().Set("X-Request-ID", requestID)
+	record := &auditRecord{event: audit.Event{
+		Time:      time.Now().UTC(),
+		RequestID: requestID,
+		Route:     r.URL.Path,
+		ClientIP:  getClientIPFromRequest(a.proxyCount, r),
+		UserAgent: r.UserAgent(),
+		APIKey:    apiKeyFingerprint(r.Header.Get("X-API-Key")),
+		Decisions: []audit.Decision{},
+	}}
+
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auditKey{}, record)))
+
+	event := record.finish(w.(negroni.ResponseWriter).Status())
+	if err := a.log.Log(event); err != nil {
+		log.WithError(err).WithField("requestID", requestID).Error("Failed to write audit event")
+	}
+}
+
+type auditKey struct{}
+
+// auditRecord collects the audit event of a claim while it passes the chain.
+// Its methods do nothing on a nil record, i.e. when auditing is off.
+type auditRecord struct {
+	mu    sync.Mutex
+	event audit.Event
+}
+
+// auditFrom returns the audit record of the request, nil when it is not audited
+func auditFrom(r *http.Request) *auditRecord {
+	record, _ := r.Context().Value(auditKey{}).(*auditRecord)
+	return record
+}
+
+// decide records the decision of a stage of the chain
+func (a *auditRecord) decide(stage, decision, reason string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.event.Decisions = append(a.event.Decisions, audit.Decision{Stage: stage, Decision: decision, Reason: reason})
+}
+
+// plan records who the claim pays and on which networks
+func (a *auditRecord) plan(plan *claimPlan) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.event.Address = plan.claimant.address
+	a.event.Name = plan.claimant.name
+	a.event.Tier = string(plan.tier)
+	a.event.Networks = plan.networks
+}
+
+// result records the outcome of the claim on a network
+func (a *auditRecord) result(network string, outcome claimOutcome, apiErr *apiError) {
+	if a == nil {
+		return
+	}
+	result := audit.Result{Network: network}
+	if apiErr != nil {
+		result.Code = string(apiErr.code)
+		result.Error = apiErr.message
+	} else {
+		result.ClaimID = outcome.claim.ID
+		result.Status = string(outcome.claim.Status)
+		result.TxHash = outcome.claim.TxHash
+		if outcome.claim.Amount != nil {
+			result.Amount = outcome.claim.Amount.String()
+		}
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.event.Results = append(a.event.Results, result)
+}
+
+// reject records the error the claim was refused with
+func (a *auditRecord) reject(apiErr *apiError) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.event.Code = string(apiErr.code)
+	a.event.Error = apiErr.message
+}
+
+// finish completes the event with the response status and the outcome
+func (a *auditRecord) finish(status int) audit.Event {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	event := a.event
+	event.Status = status
+	event.DurationMS = time.Since(event.Time).Milliseconds()
+
+	paid, queued, failed := false, false, false
+	for _, result := range event.Results {
+		switch {
+		case isPayoutFailure(errorCode(result.Code)):
+			failed = true
+		case result.Code != "":
+		case result.Status == string(queue.StatusQueued) || result.Status == string(queue.StatusProcessing) || result.Status == string(queue.StatusSigned):
+			queued = true
+		default:
+			paid = true
+		}
+	}
+	switch {
+	case paid:
+		event.Outcome = audit.OutcomePaid
+	case queued:
+		event.Outcome = audit.OutcomeQueued
+	case failed || status >= http.StatusInternalServerError && event.Code != string(codeQueueFull):
+		event.Outcome = audit.OutcomeFailed
+	default:
+		event.Outcome = audit.OutcomeRejected
+	}
+	return event
+}
+
+// apiKeyFingerprint identifies an API key in the audit log without revealing it
+func apiKeyFingerprint(apiKey string) string {
+	if apiKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(apiKey))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
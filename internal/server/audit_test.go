@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
+)
+
+func TestAudit(t *testing.T) {
+	tests := []struct {
+		name          string
+		apiKey        string
+		wantStatus    int
+		wantOutcome   string
+		wantDecisions []audit.Decision
+		wantTxHash    string
+	}{
+		{
+			name:        "paid",
+			apiKey:      "integration-tests",
+			wantStatus:  http.StatusOK,
+			wantOutcome: audit.OutcomePaid,
+			wantDecisions: []audit.Decision{
+				{Stage: "limiter", Decision: audit.DecisionAllow, Reason: "sepolia: reserved 1"},
+				{Stage: "captcha", Decision: audit.DecisionSkip, Reason: "valid API key"},
+			},
+			wantTxHash: common.Hash{1}.Hex(),
+		},
+		{
+			name:        "invalid API key",
+			apiKey:      "guessed",
+			wantStatus:  http.StatusUnauthorized,
+			wantOutcome: audit.OutcomeRejected,
+			wantDecisions: []audit.Decision{
+				{Stage: "limiter", Decision: audit.DecisionAllow, Reason: "sepolia: reserved 1"},
+				{Stage: "captcha", Decision: audit.DecisionReject, Reason: "unknown API key"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{1}, nil)
+			server := setupMultiChainTestServer(t, mockBuilder, false)
+			server.multiConfig.APIKeys = []string{"integration-tests"}
+			planner, err := newClaimPlanner(server.multiConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.planner = planner
+			var buf bytes.Buffer
+			server.audit = audit.NewLogger(&buf)
+
+			req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(`{"address": "`+testAddress+`"}`))
+			req.Header.Set("X-API-Key", tt.apiKey)
+			req.Header.Set("X-Request-ID", "req-1")
+			req.Header.Set("User-Agent", "faucet-tests")
+			rr := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if got := rr.Header().Get("X-Request-ID"); got != "req-1" {
+				t.Errorf("X-Request-ID = %q, want req-1", got)
+			}
+
+			var event audit.Event
+			if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+				t.Fatalf("audit log %q is not one JSON event: %v", buf.String(), err)
+			}
+			if event.RequestID != "req-1" || event.UserAgent != "faucet-tests" || event.Address != testAddress || event.Status != tt.wantStatus {
+				t.Errorf("unexpected event %+v", event)
+			}
+			if event.Outcome != tt.wantOutcome {
+				t.Errorf("outcome = %q, want %q", event.Outcome, tt.wantOutcome)
+			}
+			if event.APIKey != apiKeyFingerprint(tt.apiKey) || strings.Contains(buf.String(), tt.apiKey) {
+				t.Errorf("API key %q is not fingerprinted: %s", tt.apiKey, buf.String())
+			}
+			if len(event.Decisions) != len(tt.wantDecisions) {
+				t.Fatalf("decisions = %+v, want %+v", event.Decisions, tt.wantDecisions)
+			}
+			for i, want := range tt.wantDecisions {
+				if event.Decisions[i] != want {
+					t.Errorf("decision %d = %+v, want %+v", i, event.Decisions[i], want)
+				}
+			}
+			if tt.wantTxHash != "" && (len(event.Results) != 1 || event.Results[0].TxHash != tt.wantTxHash) {
+				t.Errorf("results = %+v, want tx %s", event.Results, tt.wantTxHash)
+			}
+		})
+	}
+}
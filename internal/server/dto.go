@@ -7,54 +7,176 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sort"
 	"strings"
 
-	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/shopspring/decimal"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
 )
 
-type claimRequest struct {
-	Address string `json:"address"`
+type multiChainClaimRequest struct {
+	// Address is an address or, with a name service, a name such as vitalik.eth
+	Address  string         `json:"address"`
+	Network  string         `json:"network"`
+	Networks *claimNetworks `json:"networks,omitempty"`
+	// Amount is requested in native units instead of the tier payout
+	Amount json.Number `json:"amount,omitempty"`
 }
 
-type multiChainClaimRequest struct {
-	Address string `json:"address"`
-	Network string `json:"network"`
+// claimNetworks are the networks of a multi-network claim, given as a list
+// of network names or as "all"
+type claimNetworks struct {
+	names []string
+	all   bool
+}
+
+func (n *claimNetworks) UnmarshalJSON(data []byte) error {
+	var all string
+	if err := json.Unmarshal(data, &all); err == nil {
+		if all != "all" {
+			return &malformedRequest{status: http.StatusBadRequest, message: `networks must be a list of networks or "all"`}
+		}
+		n.all = true
+		return nil
+	}
+	return json.Unmarshal(data, &n.names)
+}
+
+// isMulti reports whether the claim is made on a list of networks
+func (req *multiChainClaimRequest) isMulti() bool {
+	return req.Networks != nil
+}
+
+// networks resolves the networks a claim is made on. active must be sorted.
+func (req *multiChainClaimRequest) networks(defaultNetwork string, active []string) ([]string, *apiError) {
+	if req.Networks == nil {
+		network := req.Network
+		if network == "" {
+			network = defaultNetwork
+		}
+		return []string{network}, nil
+	}
+	if req.Network != "" {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeInvalidRequest, message: "network and networks cannot both be set"}
+	}
+	if req.Networks.all {
+		return active, nil
+	}
+	if len(req.Networks.names) == 0 {
+		return nil, &apiError{status: http.StatusBadRequest, code: codeInvalidRequest, message: "networks must not be empty"}
+	}
+
+	var networks []string
+	seen := make(map[string]bool)
+	for _, network := range req.Networks.names {
+		if i := sort.SearchStrings(active, network); i == len(active) || active[i] != network {
+			return nil, &apiError{status: http.StatusBadRequest, code: codeUnsupportedNetwork, message: fmt.Sprintf("unsupported network %s", network)}
+		}
+		if !seen[network] {
+			seen[network] = true
+			networks = append(networks, network)
+		}
+	}
+	return networks, nil
 }
 
+// amount returns the requested amount, zero if the claim requests the payout
+func (req *multiChainClaimRequest) amount() (decimal.Decimal, *apiError) {
+	if req.Amount == "" {
+		return decimal.Zero, nil
+	}
+	amount, err := decimal.NewFromString(string(req.Amount))
+	if err != nil || !amount.IsPositive() {
+		return decimal.Zero, &apiError{status: http.StatusBadRequest, code: codeInvalidAmount, message: "amount must be a positive number"}
+	}
+	return amount, nil
+}
+
+// claimResponse is a claim or an error. Address and Name are set when the
+// claim was made to a name.
 type claimResponse struct {
 	Message string `json:"msg"`
+	ClaimID string `json:"claim_id,omitempty"`
+	Address string `json:"address,omitempty"`
+	Name    string `json:"name,omitempty"`
 }
 
-type NetworkInfo struct {
-	Name      string `json:"name"`
-	Symbol    string `json:"symbol"`
-	ChainID   int64  `json:"chain_id"`
-	IsTestnet bool   `json:"is_testnet"`
+type claimQueuedResponse struct {
+	Message  string       `json:"msg"`
+	ClaimID  string       `json:"claim_id"`
+	Status   queue.Status `json:"status"`
+	Position int          `json:"position"`
+	Address  string       `json:"address,omitempty"`
+	Name     string       `json:"name,omitempty"`
 }
 
-type infoResponse struct {
-	Account           string                 `json:"account"`
-	Network           string                 `json:"network"`
-	Payout            string                 `json:"payout"`
-	Symbol            string                 `json:"symbol"`
-	HcaptchaSiteKey   string                 `json:"hcaptcha_sitekey,omitempty"`
-	SupportedNetworks map[string]NetworkInfo `json:"supported_networks,omitempty"`
+// multiClaimResponse lists the result of each network of a multi-network claim
+type multiClaimResponse struct {
+	Message string                 `json:"msg"`
+	Address string                 `json:"address,omitempty"`
+	Name    string                 `json:"name,omitempty"`
+	Results []networkClaimResponse `json:"results"`
 }
 
-type ActiveNetworkInfo struct {
+type networkClaimResponse struct {
+	Network    string `json:"network"`
+	Result     string `json:"result"`
+	Message    string `json:"msg"`
+	TxHash     string `json:"tx_hash,omitempty"`
+	ClaimID    string `json:"claim_id,omitempty"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+}
+
+type claimStatusResponse struct {
+	queue.Claim
+	Position int `json:"position,omitempty"`
+}
+
+type NetworkInfo struct {
 	Name      string `json:"name"`
 	Symbol    string `json:"symbol"`
 	ChainID   int64  `json:"chain_id"`
 	IsTestnet bool   `json:"is_testnet"`
-	Account   string `json:"account"`
-	Payout    string `json:"payout"`
+	State     string `json:"state"`
+	Sunset    string `json:"sunset,omitempty"`
+}
+
+// ActiveNetworkInfo describes an active network with everything the
+// frontend needs to display it and to add it to a wallet
+type ActiveNetworkInfo struct {
+	Name               string `json:"name"`
+	Symbol             string `json:"symbol"`
+	ChainID            int64  `json:"chain_id"`
+	IsTestnet          bool   `json:"is_testnet"`
+	Account            string `json:"account"`
+	Payout             string `json:"payout"`
+	CurrencyName       string `json:"currency_name,omitempty"`
+	Decimals           int    `json:"decimals"`
+	RPCURL             string `json:"rpc_url,omitempty"`
+	ExplorerTxURL      string `json:"explorer_tx_url,omitempty"`
+	ExplorerAddressURL string `json:"explorer_address_url,omitempty"`
+	Icon               string `json:"icon,omitempty"`
+	// State is active or deprecated, Sunset when payouts end in RFC 3339
+	State  string `json:"state"`
+	Sunset string `json:"sunset,omitempty"`
+	// Paused networks refuse claims until they are resumed
+	Paused bool `json:"paused,omitempty"`
 }
 
-type multiChainInfoResponse struct {
+// infoResponse describes the active networks. Account, Network, Payout and
+// Symbol repeat the default network for single-chain clients.
+type infoResponse struct {
+	Account           string                       `json:"account"`
+	Network           string                       `json:"network"`
+	Payout            string                       `json:"payout"`
+	Symbol            string                       `json:"symbol"`
 	DefaultNetwork    string                       `json:"default_network"`
 	ActiveNetworks    map[string]ActiveNetworkInfo `json:"active_networks"`
 	SupportedNetworks map[string]NetworkInfo       `json:"supported_networks,omitempty"`
 	HcaptchaSiteKey   string                       `json:"hcaptcha_sitekey,omitempty"`
+	// NameService is the network names in claims are resolved on
+	NameService string `json:"name_service,omitempty"`
 }
 
 type malformedRequest struct {
@@ -98,6 +220,9 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
 			msg := fmt.Sprintf("Request body contains unknown field %s", fieldName)
 			return &malformedRequest{status: http.StatusBadRequest, message: msg}
+		case strings.HasPrefix(err.Error(), "json: invalid number literal"):
+			msg := "Request body contains an invalid number"
+			return &malformedRequest{status: http.StatusBadRequest, message: msg}
 		case errors.Is(err, io.EOF):
 			msg := "Request body must not be empty"
 			return &malformedRequest{status: http.StatusBadRequest, message: msg}
@@ -113,16 +238,13 @@ func decodeJSONBody(r *http.Request, dst interface{}) error {
 	return nil
 }
 
-func readAddress(r *http.Request) (string, error) {
-	var claimReq claimRequest
-	if err := decodeJSONBody(r, &claimReq); err != nil {
-		return "", err
+// requestError converts an error from decodeJSONBody to an API error
+func requestError(err error) *apiError {
+	var mr *malformedRequest
+	if errors.As(err, &mr) {
+		return &apiError{status: mr.status, code: codeInvalidRequest, message: mr.message}
 	}
-	if !chain.IsValidAddress(claimReq.Address, true) {
-		return "", &malformedRequest{status: http.StatusBadRequest, message: "invalid address"}
-	}
-
-	return claimReq.Address, nil
+	return &apiError{status: http.StatusInternalServerError, code: codeInternal, message: http.StatusText(http.StatusInternalServerError)}
 }
 
 func renderJSON(w http.ResponseWriter, v interface{}, code int) error {
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errorCode identifies an API error independent of its message, so clients
+// do not have to parse English text
+type errorCode string
+
+const (
+	codeInvalidRequest     errorCode = "invalid_request"
+	codeInvalidAddress     errorCode = "invalid_address"
+	codeInvalidAmount      errorCode = "invalid_amount"
+	codeUnsupportedNetwork errorCode = "unsupported_network"
+	codeRateLimited        errorCode = "rate_limited"
+	codeCaptchaFailed      errorCode = "captcha_failed"
+	codeInvalidAPIKey      errorCode = "invalid_api_key"
+	codeTierNotAllowed     errorCode = "tier_not_allowed"
+	codeQueueFull          errorCode = "queue_full"
+	codeNetworkUnavailable errorCode = "network_unavailable"
+	codeNetworkSunset      errorCode = "network_sunset"
+	codeTransferFailed     errorCode = "transfer_failed"
+	codeFaucetEmpty        errorCode = "faucet_empty"
+	codeRecipientRejected  errorCode = "recipient_rejected"
+	codeNetworkCongested   errorCode = "network_congested"
+	codeClaimNotFound      errorCode = "claim_not_found"
+	codeNotFound           errorCode = "not_found"
+	codeMethodNotAllowed   errorCode = "method_not_allowed"
+	codeInternal           errorCode = "internal_error"
+)
+
+// apiError is an error response. Routes under /api/v1 render it as a
+// structured error, the legacy routes as {"msg": "..."}.
+type apiError struct {
+	status     int
+	code       errorCode
+	message    string
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	return e.message
+}
+
+// isPayoutFailure reports whether code is an error of a claim that was
+// accepted and then could not be paid
+func isPayoutFailure(code errorCode) bool {
+	switch code {
+	case codeTransferFailed, codeFaucetEmpty, codeRecipientRejected, codeNetworkCongested:
+		return true
+	}
+	return false
+}
+
+var errClaimNotFound = &apiError{status: http.StatusNotFound, code: codeClaimNotFound, message: "claim not found"}
+
+type errorBody struct {
+	Code       errorCode `json:"code"`
+	Message    string    `json:"message"`
+	RetryAfter int       `json:"retry_after,omitempty"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}
+
+// renderError writes err in the format of the API version the request was made to
+func renderError(w http.ResponseWriter, r *http.Request, err *apiError) {
+	auditFrom(r).reject(err)
+	retryAfter := 0
+	if err.retryAfter > 0 {
+		retryAfter = int(math.Ceil(err.retryAfter.Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+
+	if !isV1(r) {
+		renderJSON(w, claimResponse{Message: err.message}, err.status)
+		return
+	}
+	renderJSON(w, errorResponse{Error: errorBody{
+		Code:       err.code,
+		Message:    err.message,
+		RetryAfter: retryAfter,
+	}}, err.status)
+}
+
+// isV1 reports whether the request was made to the versioned API
+func isV1(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, apiV1Prefix)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
+)
+
+// eventKeepAlive is how often an idle event stream sends a comment so proxies
+// do not close it
+var eventKeepAlive = 15 * time.Second
+
+// claimView converts a claim and its queue position to the JSON of an API version
+type claimView func(claim queue.Claim, position int) interface{}
+
+// legacyClaimView is the claim as returned by /api/claim/{claim_id}
+func legacyClaimView(claim queue.Claim, position int) interface{} {
+	return claimStatusResponse{Claim: claim, Position: position}
+}
+
+// streamClaimEvents streams the updates of a claim as Server-Sent Events. Each
+// event is named after the claim status and carries the claim as JSON; the
+// stream ends once the claim is final.
+func (s *MultiChainServer) streamClaimEvents(w http.ResponseWriter, r *http.Request, id string, view claimView) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		renderError(w, r, &apiError{status: http.StatusInternalServerError, code: codeInternal, message: "streaming is not supported"})
+		return
+	}
+
+	claim, updates, cancel, err := s.claims.Subscribe(id)
+	if err != nil {
+		renderError(w, r, errClaimNotFound)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	_, position, _ := s.claims.Get(id)
+	writeClaimEvent(w, claim, view(claim, position))
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case update, ok := <-updates:
+			if !ok {
+				// Updates may have been dropped, so always end with the last state
+				if final, _, found := s.claims.Get(id); found && !final.UpdatedAt.Equal(claim.UpdatedAt) {
+					writeClaimEvent(w, final, view(final, 0))
+					flusher.Flush()
+				}
+				return
+			}
+			claim = update
+			_, position, _ := s.claims.Get(id)
+			writeClaimEvent(w, update, view(update, position))
+		}
+		flusher.Flush()
+	}
+}
+
+func writeClaimEvent(w http.ResponseWriter, claim queue.Claim, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", claim.UpdatedAt.UnixNano(), claim.Status, data)
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+// readinessTimeout bounds the checks of each network
+const readinessTimeout = 5 * time.Second
+
+// readiness is ready when every network can pay out, degraded when some
+// can, and unavailable when none can, even if only because all are paused
+type readiness string
+
+const (
+	readinessReady       readiness = "ready"
+	readinessDegraded    readiness = "degraded"
+	readinessUnavailable readiness = "unavailable"
+)
+
+// networkReadiness is what the readiness check found out about a network
+type networkReadiness struct {
+	Ready     bool `json:"ready"`
+	Reachable bool `json:"rpc_reachable"`
+	// BlockNumber and BlockAge describe the latest block the provider knows.
+	// The provider is behind once BlockAge exceeds MaxBlockAge, and
+	// BlocksBehind estimates the blocks it misses from the block time.
+	BlockNumber  uint64 `json:"block_number"`
+	BlockAge     int64  `json:"block_age_seconds"`
+	MaxBlockAge  int64  `json:"max_block_age_seconds"`
+	BlocksBehind uint64 `json:"blocks_behind,omitempty"`
+	Behind       bool   `json:"behind"`
+	// Balance is the balance of the faucet account in units of the payout
+	Balance           string `json:"balance,omitempty"`
+	Payout            string `json:"payout"`
+	SufficientBalance bool   `json:"sufficient_balance"`
+	Paused            bool   `json:"paused"`
+	Error             string `json:"error,omitempty"`
+}
+
+type readinessResponse struct {
+	Status   readiness                   `json:"status"`
+	Networks map[string]networkReadiness `json:"networks"`
+}
+
+// handleHealth answers liveness probes, it only checks that the server handles requests
+func (s *MultiChainServer) handleHealth() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, map[string]string{"status": "ok"}, http.StatusOK)
+	}
+}
+
+// handleReadiness answers readiness probes with the status of every network.
+// Degraded servers still answer 200, so they keep serving the networks that work.
+func (s *MultiChainServer) handleReadiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := s.readiness(r.Context())
+		status := http.StatusOK
+		if resp.Status == readinessUnavailable {
+			status = http.StatusServiceUnavailable
+		}
+		renderJSON(w, resp, status)
+	}
+}
+
+// readiness checks the active networks concurrently
+func (s *MultiChainServer) readiness(ctx context.Context) readinessResponse {
+	chains := s.multiConfig.GetActiveChains()
+	resp := readinessResponse{Networks: make(map[string]networkReadiness, len(chains))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for network, chainInstance := range chains {
+		wg.Add(1)
+		go func(network string, chainInstance *config.ChainInstance) {
+			defer wg.Done()
+			result := s.networkReadiness(ctx, network, chainInstance)
+			mu.Lock()
+			resp.Networks[network] = result
+			mu.Unlock()
+		}(network, chainInstance)
+	}
+	wg.Wait()
+
+	ready := 0
+	for _, result := range resp.Networks {
+		if result.Ready {
+			ready++
+		}
+	}
+	switch {
+	case ready == len(resp.Networks):
+		resp.Status = readinessReady
+	case ready == 0:
+		resp.Status = readinessUnavailable
+	default:
+		resp.Status = readinessDegraded
+	}
+	return resp
+}
+
+func (s *MultiChainServer) networkReadiness(ctx context.Context, network string, chainInstance *config.ChainInstance) networkReadiness {
+	result := networkReadiness{
+		Payout:      chainInstance.Payout.String(),
+		Paused:      chainInstance.Paused,
+		MaxBlockAge: int64(chainInstance.MaxBlockAge / time.Second),
+	}
+	reader, exists := s.readers[network]
+	if !exists {
+		result.Error = "no provider to check"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+	status, err := chain.ReadStatus(ctx, reader, s.builders[network].Sender())
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	age := time.Since(status.BlockTime)
+	balance := chain.FromBaseUnits(status.Balance, chainInstance.Config.Decimals)
+	result.Reachable = true
+	result.BlockNumber = status.BlockNumber
+	result.BlockAge = int64(age / time.Second)
+	result.Behind = age > chainInstance.MaxBlockAge
+	if blockTime := chainInstance.Config.BlockTime; blockTime > 0 && age > blockTime {
+		result.BlocksBehind = uint64(age / blockTime)
+	}
+	result.Balance = balance.String()
+	result.SufficientBalance = balance.GreaterThanOrEqual(chainInstance.Payout)
+	result.Ready = !result.Behind && result.SufficientBalance && !result.Paused
+	return result
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+)
+
+// fakeStatusReader reports a block of the given age and a balance, or err
+type fakeStatusReader struct {
+	age     time.Duration
+	balance *big.Int
+	err     error
+}
+
+func (f fakeStatusReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &types.Header{Number: big.NewInt(100), Time: uint64(time.Now().Add(-f.age).Unix())}, nil
+}
+
+func (f fakeStatusReader) BalanceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*big.Int, error) {
+	return f.balance, nil
+}
+
+func TestReadiness(t *testing.T) {
+	healthy := fakeStatusReader{age: 10 * time.Second, balance: new(big.Int).Mul(oneEther, big.NewInt(2))}
+	tests := []struct {
+		name    string
+		sepolia fakeStatusReader
+		holesky fakeStatusReader
+		paused  bool
+		// pauseAll pauses sepolia as well
+		pauseAll    bool
+		maxBlockAge time.Duration
+		wantStatus  int
+		want        readiness
+		// wantMaxBlockAge and wantBehind describe holesky, unchecked when zero
+		wantMaxBlockAge int64
+		wantBehind      uint64
+	}{
+		{name: "ready", sepolia: healthy, holesky: healthy, wantStatus: http.StatusOK, want: readinessReady, wantMaxBlockAge: 240},
+		// Two minutes are 10 missed blocks of holesky, within its default of 20
+		{name: "slow", sepolia: healthy, holesky: fakeStatusReader{age: 2 * time.Minute, balance: oneEther}, wantStatus: http.StatusOK, want: readinessReady, wantMaxBlockAge: 240, wantBehind: 10},
+		{name: "behind its max block age", sepolia: healthy, holesky: fakeStatusReader{age: 2 * time.Minute, balance: oneEther}, maxBlockAge: time.Minute,
+			wantStatus: http.StatusOK, want: readinessDegraded, wantMaxBlockAge: 60, wantBehind: 10},
+		{name: "low balance", sepolia: fakeStatusReader{balance: big.NewInt(1)}, holesky: healthy, wantStatus: http.StatusOK, want: readinessDegraded},
+		{name: "paused", sepolia: healthy, holesky: healthy, paused: true, wantStatus: http.StatusOK, want: readinessDegraded},
+		// No claim can be paid, so load balancers should stop sending them
+		{name: "all paused", sepolia: healthy, holesky: healthy, paused: true, pauseAll: true, wantStatus: http.StatusServiceUnavailable, want: readinessUnavailable},
+		{name: "down and behind", sepolia: fakeStatusReader{err: errors.New("connection refused")}, holesky: fakeStatusReader{age: time.Hour, balance: oneEther},
+			wantStatus: http.StatusServiceUnavailable, want: readinessUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			mockBuilder.On("Sender").Return(common.HexToAddress(testAddress))
+			server := setupMultiChainTestServer(t, mockBuilder, false)
+			if err := server.multiConfig.AddChainWithKey(config.ChainConfigInput{Network: "holesky", Provider: "http://127.0.0.1:8545", Paused: tt.paused, MaxBlockAge: tt.maxBlockAge}, nil); err != nil {
+				t.Fatal(err)
+			}
+			server.multiConfig.Chains["sepolia"].Paused = tt.pauseAll
+			server.builders["holesky"] = mockBuilder
+			server.readers = map[string]chain.StatusReader{"sepolia": tt.sepolia, "holesky": tt.holesky}
+
+			rr := httptest.NewRecorder()
+			server.setupRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/readyz", nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			var resp readinessResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != tt.want || len(resp.Networks) != 2 {
+				t.Errorf("readiness = %+v, want %s", resp, tt.want)
+			}
+			if holesky := resp.Networks["holesky"]; holesky.Paused != tt.paused || holesky.Reachable != (tt.holesky.err == nil) {
+				t.Errorf("unexpected holesky readiness %+v", holesky)
+			}
+			if holesky := resp.Networks["holesky"]; tt.wantMaxBlockAge != 0 && (holesky.MaxBlockAge != tt.wantMaxBlockAge || holesky.BlocksBehind != tt.wantBehind) {
+				t.Errorf("holesky max block age = %d, blocks behind = %d, want %d and %d", holesky.MaxBlockAge, holesky.BlocksBehind, tt.wantMaxBlockAge, tt.wantBehind)
+			}
+		})
+	}
+}
+
+func TestHealth(t *testing.T) {
+	server := setupMultiChainTestServer(t, new(MockTxBuilder), false)
+	rr := httptest.NewRecorder()
+	server.setupRouter().ServeHTTP(rr, httptest.NewRequest("GET", "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rr.Code, http.StatusOK)
+	}
+}
+
+// closingStatusReader records whether it was closed
+type closingStatusReader struct {
+	fakeStatusReader
+	closed bool
+}
+
+func (c *closingStatusReader) Close() {
+	c.closed = true
+}
+
+func TestCloseClosesStatusReaders(t *testing.T) {
+	server := setupMultiChainTestServer(t, new(MockTxBuilder), false)
+	reader := &closingStatusReader{}
+	server.readers = map[string]chain.StatusReader{"sepolia": reader}
+
+	server.Close()
+	if !reader.closed {
+		t.Error("Close() left the status reader open")
+	}
+}
@@ -0,0 +1,278 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+)
+
+// reverter is a contract deployed on the simulated chains that reverts every call
+var reverter = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+
+// simNetwork is a network of the integration tests and what its faucet account holds
+type simNetwork struct {
+	name    string
+	balance *big.Int
+}
+
+// newSimulatedChain starts a simulated chain with chainID that mines a block every few milliseconds
+func newSimulatedChain(t *testing.T, chainID int64, alloc core.GenesisAlloc) *backends.SimulatedBackend {
+	// The simulated backend always runs with the chain config in
+	// params.AllEthashProtocolChanges, which it reads on creation
+	defaultConfig := params.AllEthashProtocolChanges
+	chainConfig := *defaultConfig
+	chainConfig.ChainID = big.NewInt(chainID)
+	params.AllEthashProtocolChanges = &chainConfig
+	sim := backends.NewSimulatedBackend(alloc, 30_000_000)
+	params.AllEthashProtocolChanges = defaultConfig
+	t.Cleanup(func() { sim.Close() })
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				sim.Commit()
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(stop)
+		<-done
+	})
+	return sim
+}
+
+// captchaStub answers hCaptcha verifications, only the token "valid" passes
+type captchaStub struct{}
+
+func (captchaStub) RoundTrip(r *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	result := `{"success": false, "error-codes": ["invalid-input-response"]}`
+	if form.Get("response") == "valid" {
+		result = `{"success": true}`
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(result)),
+		Request:    r,
+	}, nil
+}
+
+// startIntegrationServer serves the faucet over HTTP for networks, each on
+// its own simulated chain. It returns the URL of the server and the chains.
+func startIntegrationServer(t *testing.T, networks []simNetwork) (string, map[string]*backends.SimulatedBackend) {
+	// The captcha verifies tokens with the default client of the time it is created
+	defaultClient := http.DefaultClient
+	http.DefaultClient = &http.Client{Transport: captchaStub{}}
+	t.Cleanup(func() { http.DefaultClient = defaultClient })
+
+	multiConfig := config.NewMultiChainConfig()
+	multiConfig.HcaptchaSecret = "integration-secret"
+	multiConfig.ClaimQueue.Confirmations = 2
+	builders := make(map[string]chain.TxBuilder)
+	sims := make(map[string]*backends.SimulatedBackend)
+	for _, network := range networks {
+		key, err := crypto.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := multiConfig.AddChainWithKey(config.ChainConfigInput{
+			Network:    network.name,
+			Provider:   "http://127.0.0.1:8545",
+			RateLimits: []ratelimit.Rule{{Key: ratelimit.KeyAddress, Limit: 1, Window: time.Hour}},
+		}, key); err != nil {
+			t.Fatal(err)
+		}
+		chainID := multiConfig.Chains[network.name].Config.ChainID
+		sim := newSimulatedChain(t, chainID, core.GenesisAlloc{
+			crypto.PubkeyToAddress(key.PublicKey): {Balance: network.balance},
+			reverter:                              {Balance: new(big.Int), Code: common.FromHex("600080fd")},
+		})
+		builders[network.name] = chain.NewTxBuilderWithClient(sim, key, big.NewInt(chainID), nil, nil)
+		sims[network.name] = sim
+	}
+
+	server, err := NewMultiChainServerWithBuilders(multiConfig, builders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	for network, sim := range sims {
+		server.readers[network] = sim
+	}
+	httpServer := httptest.NewServer(server.Handler())
+	t.Cleanup(httpServer.Close)
+	return httpServer.URL, sims
+}
+
+// postClaim claims on network over HTTP, with the captcha token unless it is empty
+func postClaim(t *testing.T, baseURL, network, address, captcha string) (int, []byte) {
+	body := fmt.Sprintf(`{"address": %q, "network": %q}`, address, network)
+	req, err := http.NewRequest("POST", baseURL+"/api/v1/claims", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if captcha != "" {
+		req.Header.Set("h-captcha-response", captcha)
+	}
+	return do(t, req)
+}
+
+// do sends req past http.DefaultClient, which only answers captcha verifications
+func do(t *testing.T, req *http.Request) (int, []byte) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+// awaitFinal polls a claim until it is final
+func awaitFinal(t *testing.T, baseURL, claimID string) claimV1 {
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		req, err := http.NewRequest("GET", baseURL+"/api/v1/claims/"+claimID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, body := do(t, req)
+		if status != http.StatusOK {
+			t.Fatalf("GET claim %s = %d: %s", claimID, status, body)
+		}
+		var claim claimV1
+		if err := json.Unmarshal(body, &claim); err != nil {
+			t.Fatal(err)
+		}
+		if claim.Final {
+			return claim
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("claim %s is not final: %+v", claimID, claim)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func TestIntegration(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for simulated payouts to be confirmed")
+	}
+	ether := big.NewInt(params.Ether)
+	baseURL, sims := startIntegrationServer(t, []simNetwork{
+		{name: "sepolia", balance: new(big.Int).Mul(ether, big.NewInt(100))},
+		{name: "holesky", balance: new(big.Int).Mul(ether, big.NewInt(100))},
+		// Cannot pay a single payout
+		{name: "polygon-amoy", balance: big.NewInt(1000)},
+	})
+	claimant := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	other := "0xAb5801a7D398351b8bE11C439e05C5B3259aeC9B"
+
+	tests := []struct {
+		name       string
+		network    string
+		address    string
+		captcha    string
+		wantStatus int
+		wantCode   errorCode
+	}{
+		{name: "paid on sepolia", network: "sepolia", address: claimant, captcha: "valid", wantStatus: http.StatusOK},
+		{name: "paid on holesky", network: "holesky", address: claimant, captcha: "valid", wantStatus: http.StatusOK},
+		{name: "rate limited", network: "sepolia", address: claimant, captcha: "valid", wantStatus: http.StatusTooManyRequests, wantCode: codeRateLimited},
+		{name: "invalid captcha", network: "sepolia", address: other, captcha: "guessed", wantStatus: http.StatusTooManyRequests, wantCode: codeCaptchaFailed},
+		{name: "missing captcha", network: "sepolia", address: other, wantStatus: http.StatusTooManyRequests, wantCode: codeCaptchaFailed},
+		{name: "reverting recipient", network: "holesky", address: reverter.Hex(), captcha: "valid", wantStatus: http.StatusUnprocessableEntity, wantCode: codeRecipientRejected},
+		{name: "faucet empty", network: "polygon-amoy", address: other, captcha: "valid", wantStatus: http.StatusServiceUnavailable, wantCode: codeFaucetEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := postClaim(t, baseURL, tt.network, tt.address, tt.captcha)
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", status, tt.wantStatus, body)
+			}
+			if tt.wantCode != "" {
+				var resp errorResponse
+				if err := json.Unmarshal(body, &resp); err != nil || resp.Error.Code != tt.wantCode {
+					t.Fatalf("error = %s, want code %s", body, tt.wantCode)
+				}
+				return
+			}
+
+			var claim claimV1
+			if err := json.Unmarshal(body, &claim); err != nil {
+				t.Fatal(err)
+			}
+			if claim.TxHash == "" {
+				t.Fatalf("claim %+v has no transaction", claim)
+			}
+			final := awaitFinal(t, baseURL, claim.ClaimID)
+			if final.Status != queue.StatusMined || final.Confirmations < 2 || final.TxHash != claim.TxHash {
+				t.Errorf("final claim = %+v, want mined with 2 confirmations", final)
+			}
+			balance, err := sims[tt.network].BalanceAt(context.Background(), common.HexToAddress(tt.address), nil)
+			if err != nil || balance.Cmp(ether) != 0 {
+				t.Errorf("balance on %s = %v, %v, want 1 ether", tt.network, balance, err)
+			}
+		})
+	}
+
+	t.Run("readiness", func(t *testing.T) {
+		req, err := http.NewRequest("GET", baseURL+"/readyz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, body := do(t, req)
+		var resp readinessResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		if status != http.StatusOK && status != http.StatusServiceUnavailable {
+			t.Fatalf("readiness = %d: %s", status, body)
+		}
+		// Simulated blocks are dated from the Unix epoch on, so every network is behind
+		for network, want := range map[string]bool{"sepolia": true, "holesky": true, "polygon-amoy": false} {
+			if got := resp.Networks[network]; !got.Reachable || got.SufficientBalance != want {
+				t.Errorf("%s = %+v, want sufficient balance %v", network, got, want)
+			}
+		}
+	})
+}
@@ -1,83 +1,217 @@
 package server
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net"
 	"net/http"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/jellydator/ttlcache/v2"
 	"github.com/kataras/hcaptcha"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
 )
 
+var tracer = otel.Tracer("github.com/guyuxiang/multi-chain-faucet/internal/server")
+
+// Tracing starts a server span for every request, which continues the trace
+// of the caller when it sends W3C trace context. The spans of the other
+// middleware, the handlers and the RPC calls they make are its children.
+type Tracing struct{}
+
+func NewTracing() *Tracing {
+	return &Tracing{}
+}
+
+func (t *Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := tracer.Start(ctx, "HTTP "+r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+		attribute.String("http.method", r.Method),
+		attribute.String("http.target", r.URL.Path),
+	))
+	defer span.End()
+
+	next.ServeHTTP(w, r.WithContext(ctx))
+	status := w.(negroni.ResponseWriter).Status()
+	span.SetAttributes(attribute.Int("http.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// Limiter enforces the rate limit policy of the networks a claim is made on.
+// Claims made to a name are limited by the address it resolves to.
+// Claims are reserved before the rest of the chain runs and the reservation
+// is only committed when the claim succeeds, so a failed captcha or
+// transaction never counts against the user. A multi-network claim is only
+// rejected when it is rejected on every network; the handler reports the
+// networks that are.
 type Limiter struct {
-	mutex      sync.Mutex
-	cache      *ttlcache.Cache
+	planner    *claimPlanner
 	proxyCount int
-	ttl        time.Duration
 }
 
-func NewLimiter(proxyCount int, ttl time.Duration) *Limiter {
-	cache := ttlcache.NewCache()
-	cache.SkipTTLExtensionOnHit(true)
+// NewLimiter creates a limiter that charges claims to the rate limit
+// policies of the tiers they are planned for
+func NewLimiter(planner *claimPlanner, proxyCount int) *Limiter {
 	return &Limiter{
-		cache:      cache,
+		planner:    planner,
 		proxyCount: proxyCount,
-		ttl:        ttl,
 	}
 }
 
 func (l *Limiter) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
-	address, err := readAddress(r)
-	if err != nil {
-		var mr *malformedRequest
-		if errors.As(err, &mr) {
-			renderJSON(w, claimResponse{Message: mr.message}, mr.status)
+	// The span covers planning and reserving, not the rest of the chain
+	ctx, span := tracer.Start(r.Context(), "Limiter")
+	var req multiChainClaimRequest
+	record := auditFrom(r)
+	if err := decodeJSONBody(r, &req); err != nil {
+		span.End()
+		apiErr := requestError(err)
+		record.decide("limiter", audit.DecisionReject, apiErr.message)
+		renderError(w, r, apiErr)
+		return
+	}
+	plan, apiErr := l.planner.plan(r.WithContext(ctx), req)
+	if apiErr != nil {
+		span.SetAttributes(attribute.String("error.code", string(apiErr.code)))
+		span.End()
+		record.decide("limiter", audit.DecisionReject, apiErr.message)
+		renderError(w, r, apiErr)
+		return
+	}
+	span.SetAttributes(attribute.String("claim.tier", string(plan.tier)))
+	record.plan(plan)
+
+	clientIP := getClientIPFromRequest(l.proxyCount, r)
+	keys := limitKeys(r, plan.claimant.address, clientIP, l.planner.authHeader)
+	held := &heldReservation{plan: plan, reserved: make(map[string]*ratelimit.Reservation)}
+	for _, network := range plan.networks {
+		policy, planned := plan.limits[network]
+		if !planned {
+			continue
+		}
+		reservation := policy.ReserveAmount(keys, plan.amounts[network])
+		if !reservation.OK() {
+			plan.rejected[network] = rateLimitError(reservation)
+			continue
+		}
+		held.reserved[network] = reservation
+	}
+
+	// Roll back unless the claim is paid out, including when a handler panics.
+	// A handler that pays out asynchronously takes over the reservations.
+	defer func() {
+		if !held.taken {
+			for _, reservation := range held.reserved {
+				reservation.Rollback()
+			}
+		}
+	}()
+	span.SetAttributes(attribute.Int("limiter.reserved", len(held.reserved)))
+	span.End()
+	for _, network := range plan.networks {
+		if rejected := plan.rejected[network]; rejected != nil {
+			record.decide("limiter", audit.DecisionReject, network+": "+rejected.message)
 		} else {
-			renderJSON(w, claimResponse{Message: http.StatusText(http.StatusInternalServerError)}, http.StatusInternalServerError)
+			record.decide("limiter", audit.DecisionAllow, network+": reserved "+plan.amounts[network].String())
 		}
+	}
+	if len(held.reserved) == 0 {
+		renderError(w, r, plan.rejection())
 		return
 	}
 
-	if l.ttl <= 0 {
-		next.ServeHTTP(w, r)
+	next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), reservationKey{}, held)))
+	if held.taken || w.(negroni.ResponseWriter).Status() != http.StatusOK {
 		return
 	}
+	held.taken = true
+	for network, reservation := range held.reserved {
+		reservation.Commit()
+		log.WithFields(log.Fields{
+			"address":  plan.claimant.address,
+			"clientIP": clientIP,
+			"network":  network,
+		}).Info("Maximum request limit has been reached")
+	}
+}
 
-	clintIP := getClientIPFromRequest(l.proxyCount, r)
-	l.mutex.Lock()
-	if l.limitByKey(w, address) || l.limitByKey(w, clintIP) {
-		l.mutex.Unlock()
-		return
+type reservationKey struct{}
+
+type heldReservation struct {
+	plan     *claimPlan
+	reserved map[string]*ratelimit.Reservation
+	taken    bool
+}
+
+// heldPlan returns the plan the Limiter made for the claim, nil without a Limiter
+func heldPlan(r *http.Request) *claimPlan {
+	held, ok := r.Context().Value(reservationKey{}).(*heldReservation)
+	if !ok {
+		return nil
 	}
-	l.cache.SetWithTTL(address, true, l.ttl)
-	l.cache.SetWithTTL(clintIP, true, l.ttl)
-	l.mutex.Unlock()
+	return held.plan
+}
 
-	next.ServeHTTP(w, r)
-	if w.(negroni.ResponseWriter).Status() != http.StatusOK {
-		l.cache.Remove(address)
-		l.cache.Remove(clintIP)
-		return
+// takeReservations hands the claim's plan and rate limit reservations over
+// to the caller, which then has to commit or roll back each of them. The
+// plan holds the networks that are rate limited as rejected. Both are nil
+// when the request did not pass the Limiter.
+func takeReservations(r *http.Request) (*claimPlan, map[string]*ratelimit.Reservation) {
+	held, ok := r.Context().Value(reservationKey{}).(*heldReservation)
+	if !ok {
+		return nil, nil
+	}
+	held.taken = true
+	return held.plan, held.reserved
+}
+
+// limitKeys collects the values rate limit rules are keyed on
+func limitKeys(r *http.Request, address, clientIP, authHeader string) ratelimit.Keys {
+	keys := ratelimit.Keys{
+		ratelimit.KeyAddress: strings.ToLower(address),
+		ratelimit.KeyIP:      clientIP,
+		ratelimit.KeySubnet:  subnetOf(clientIP),
+	}
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		keys[ratelimit.KeyAPIKey] = apiKey
+	}
+	if authHeader != "" {
+		if user := r.Header.Get(authHeader); user != "" {
+			keys[ratelimit.KeyUser] = user
+		}
 	}
-	log.WithFields(log.Fields{
-		"address":  address,
-		"clientIP": clintIP,
-	}).Info("Maximum request limit has been reached")
+	return keys
 }
 
-func (l *Limiter) limitByKey(w http.ResponseWriter, key string) bool {
-	if _, ttl, err := l.cache.GetWithTTL(key); err == nil {
-		errMsg := fmt.Sprintf("You have exceeded the rate limit. Please wait %s before you try again", ttl.Round(time.Second))
-		renderJSON(w, claimResponse{Message: errMsg}, http.StatusTooManyRequests)
-		return true
+// subnetOf returns the /24 network of an IPv4 address or the /64 network of an IPv6 address
+func subnetOf(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
 	}
-	return false
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// rateLimitError describes a rejected reservation
+func rateLimitError(reservation *ratelimit.Reservation) *apiError {
+	retryAfter := reservation.RetryAfter()
+	errMsg := fmt.Sprintf("You have exceeded the rate limit of %s. Please wait %s before you try again", reservation.Rule(), retryAfter.Round(time.Second))
+	return &apiError{status: http.StatusTooManyRequests, code: codeRateLimited, message: errMsg, retryAfter: retryAfter}
 }
 
 func getClientIPFromRequest(proxyCount int, r *http.Request) string {
@@ -101,31 +235,74 @@ func getClientIPFromRequest(proxyCount int, r *http.Request) string {
 	return remoteIP
 }
 
+// Captcha verifies the hCaptcha response of a claim. Claims made with one of
+// the API keys skip the captcha; once keys are configured, an unknown key is
+// rejected instead of being treated as a plain rate limit key. Behind a
+// Limiter, anonymous claims the planner admitted and users of the auth proxy
+// skip the captcha too.
 type Captcha struct {
-	client *hcaptcha.Client
-	secret string
+	client  *hcaptcha.Client
+	secret  string
+	apiKeys map[string]bool
 }
 
-func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string) *Captcha {
+func NewCaptcha(hcaptchaSiteKey, hcaptchaSecret string, apiKeys ...string) *Captcha {
 	client := hcaptcha.New(hcaptchaSecret)
 	client.SiteKey = hcaptchaSiteKey
+	keys := make(map[string]bool, len(apiKeys))
+	for _, key := range apiKeys {
+		keys[key] = true
+	}
 	return &Captcha{
-		client: client,
-		secret: hcaptchaSecret,
+		client:  client,
+		secret:  hcaptchaSecret,
+		apiKeys: keys,
 	}
 }
 
 func (c *Captcha) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	record := auditFrom(r)
+	if plan := heldPlan(r); plan != nil && (plan.tier == config.TierAnonymous || plan.tier == config.TierSocial) {
+		record.decide("captcha", audit.DecisionSkip, "not required for "+string(plan.tier)+" callers")
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" && len(c.apiKeys) > 0 {
+		if !c.apiKeys[apiKey] {
+			record.decide("captcha", audit.DecisionReject, "unknown API key")
+			renderError(w, r, &apiError{status: http.StatusUnauthorized, code: codeInvalidAPIKey, message: "invalid API key"})
+			return
+		}
+		record.decide("captcha", audit.DecisionSkip, "valid API key")
+		next.ServeHTTP(w, r)
+		return
+	}
+
 	if c.secret == "" {
+		record.decide("captcha", audit.DecisionSkip, "no captcha configured")
 		next.ServeHTTP(w, r)
 		return
 	}
 
+	_, span := tracer.Start(r.Context(), "hCaptcha verify", trace.WithSpanKind(trace.SpanKindClient))
 	response := c.client.VerifyToken(r.Header.Get("h-captcha-response"))
+	span.SetAttributes(attribute.Bool("captcha.success", response.Success))
+	span.End()
 	if !response.Success {
-		renderJSON(w, claimResponse{Message: "Captcha verification failed, please try again"}, http.StatusTooManyRequests)
+		record.decide("captcha", audit.DecisionReject, captchaFailure(response))
+		renderError(w, r, &apiError{status: http.StatusTooManyRequests, code: codeCaptchaFailed, message: "Captcha verification failed, please try again"})
 		return
 	}
 
+	record.decide("captcha", audit.DecisionAllow, "verified")
 	next.ServeHTTP(w, r)
 }
+
+// captchaFailure describes why hCaptcha rejected a response
+func captchaFailure(response hcaptcha.Response) string {
+	if len(response.ErrorCodes) == 0 {
+		return "verification failed"
+	}
+	return "verification failed: " + strings.Join(response.ErrorCodes, ", ")
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"io"
+	stdlog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/mock"
+	"github.com/urfave/negroni/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+)
+
+const testAddress = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+
+func newTestLimiter(t *testing.T) *Limiter {
+	multiConfig := config.NewMultiChainConfig()
+	if err := multiConfig.AddChainWithKey(config.ChainConfigInput{
+		Network:  "sepolia",
+		Provider: "http://127.0.0.1:8545",
+		RateLimits: []ratelimit.Rule{
+			{Key: ratelimit.KeyAddress, Limit: 1, Window: time.Hour},
+			{Key: ratelimit.KeyIP, Limit: 1, Window: time.Hour},
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	planner, err := newClaimPlanner(multiConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewLimiter(planner, 0)
+}
+
+func statusHandler(code int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, claimResponse{Message: http.StatusText(code)}, code)
+	}
+}
+
+func serveClaim(handler http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/claim", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.1:1234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLimiter(t *testing.T) {
+	validBody := `{"address": "` + testAddress + `"}`
+	tests := []struct {
+		name       string
+		body       string
+		handler    http.HandlerFunc
+		wantStatus int
+		// wantRetry is the status of an identical successful claim made right after
+		wantRetry int
+	}{
+		{
+			name:       "success commits",
+			body:       validBody,
+			handler:    statusHandler(http.StatusOK),
+			wantStatus: http.StatusOK,
+			wantRetry:  http.StatusTooManyRequests,
+		},
+		{
+			name:       "captcha failure rolls back",
+			body:       validBody,
+			handler:    statusHandler(http.StatusTooManyRequests),
+			wantStatus: http.StatusTooManyRequests,
+			wantRetry:  http.StatusOK,
+		},
+		{
+			name:       "transfer error rolls back",
+			body:       validBody,
+			handler:    statusHandler(http.StatusInternalServerError),
+			wantStatus: http.StatusInternalServerError,
+			wantRetry:  http.StatusOK,
+		},
+		{
+			name:       "handler panic rolls back",
+			body:       validBody,
+			handler:    func(w http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantRetry:  http.StatusOK,
+		},
+		{
+			name:       "malformed body",
+			body:       `{"address": `,
+			handler:    statusHandler(http.StatusOK),
+			wantStatus: http.StatusBadRequest,
+			wantRetry:  http.StatusOK,
+		},
+		{
+			name:       "invalid address",
+			body:       `{"address": "0x1234"}`,
+			handler:    statusHandler(http.StatusOK),
+			wantStatus: http.StatusBadRequest,
+			wantRetry:  http.StatusOK,
+		},
+		{
+			name:       "unsupported network",
+			body:       `{"address": "` + testAddress + `", "network": "goerli"}`,
+			handler:    statusHandler(http.StatusOK),
+			wantStatus: http.StatusBadRequest,
+			wantRetry:  http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := newTestLimiter(t)
+			recovery := negroni.NewRecovery()
+			recovery.PrintStack = false
+			recovery.Logger = stdlog.New(io.Discard, "", 0)
+
+			first := negroni.New(recovery, limiter, negroni.Wrap(tt.handler))
+			if rr := serveClaim(first, tt.body); rr.Code != tt.wantStatus {
+				t.Fatalf("first claim status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+
+			retry := negroni.New(limiter, negroni.Wrap(statusHandler(http.StatusOK)))
+			rr := serveClaim(retry, validBody)
+			if rr.Code != tt.wantRetry {
+				t.Fatalf("retried claim status = %d, want %d", rr.Code, tt.wantRetry)
+			}
+			if rr.Code == http.StatusTooManyRequests && rr.Header().Get("Retry-After") != "3600" {
+				t.Errorf("Retry-After = %q, want %q", rr.Header().Get("Retry-After"), "3600")
+			}
+		})
+	}
+}
+
+func TestCaptchaAPIKeys(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKeys    []string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid key skips captcha", apiKeys: []string{"k1", "k2"}, header: "k2", wantStatus: http.StatusOK},
+		{name: "unknown key", apiKeys: []string{"k1"}, header: "nope", wantStatus: http.StatusUnauthorized},
+		{name: "any key without configured keys", header: "nope", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := "secret"
+			if len(tt.apiKeys) == 0 {
+				secret = ""
+			}
+			captcha := NewCaptcha("sitekey", secret, tt.apiKeys...)
+			req := httptest.NewRequest("POST", "/api/v1/claims", nil)
+			req.Header.Set("X-API-Key", tt.header)
+			rr := httptest.NewRecorder()
+			negroni.New(captcha, negroni.Wrap(statusHandler(http.StatusOK))).ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rr.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// TestTracing checks that a claim is traced from the request through the
+// middleware to its payout by the queue, continuing the trace of the caller
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{1}, nil)
+	server := setupMultiChainTestServer(t, mockBuilder, false)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(`{"address": "`+testAddress+`"}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rr := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	spans := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %q is not part of the trace of the request", span.Name())
+		}
+		spans[span.Name()] = true
+	}
+	for _, name := range []string{"HTTP POST", "Limiter", "submit claim", "await payout", "transfer"} {
+		if !spans[name] {
+			t.Errorf("missing span %q, got %v", name, spans)
+		}
+	}
+}
@@ -2,56 +2,155 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/big"
 	"net/http"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jellydator/ttlcache/v2"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/negroni/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
+	"github.com/guyuxiang/multi-chain-faucet/internal/audit"
 	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
 	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/telemetry"
 	"github.com/guyuxiang/multi-chain-faucet/web"
 )
 
-// MultiChainServer manages multiple blockchain networks
+// MultiChainServer serves the faucet for one or more blockchain networks.
+// Single-chain mode is a configuration with one network.
 type MultiChainServer struct {
 	multiConfig *config.MultiChainConfig
 	builders    map[string]chain.TxBuilder
-	limiters    map[string]*ttlcache.Cache // Per-network rate limiters
+	planner     *claimPlanner
+	claims      *queue.Manager
+	// readers check the status of each network for readiness probes
+	readers map[string]chain.StatusReader
+	// shutdownTracing flushes the spans that are not exported yet
+	shutdownTracing func(context.Context) error
+	// audit records every claim attempt, nil when the audit log is off
+	audit *audit.Logger
 }
 
 // NewMultiChainServer creates a new multi-chain faucet server
 func NewMultiChainServer(multiConfig *config.MultiChainConfig) (*MultiChainServer, error) {
+	builders := make(map[string]chain.TxBuilder)
+	for network, chainInstance := range multiConfig.GetActiveChains() {
+		// Networks without a known chain ID get it from the provider
+		var chainID *big.Int
+		if chainInstance.Config.ChainID != 0 {
+			chainID = big.NewInt(chainInstance.Config.ChainID)
+		}
+		var nonces chain.NonceStore
+		if dir := multiConfig.ClaimQueue.NonceDir; dir != "" {
+			nonces = chain.NewFileNonceStore(filepath.Join(dir, network+".json"))
+		}
+		builder, err := chain.NewTxBuilder(chainInstance.Provider, chainInstance.PrivateKey, chainID, chain.NewGasStrategy(chainInstance.Gas), nonces)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TxBuilder for %s: %w", network, err)
+		}
+		builders[network] = builder
+	}
+
+	server, err := NewMultiChainServerWithBuilders(multiConfig, builders)
+	if err != nil {
+		return nil, err
+	}
+	if server.shutdownTracing, err = telemetry.Setup(context.Background(), multiConfig.Tracing); err != nil {
+		server.Close()
+		return nil, err
+	}
+	for network, chainInstance := range multiConfig.GetActiveChains() {
+		reader, err := chain.NewStatusReader(chainInstance.Provider)
+		if err != nil {
+			server.Close()
+			return nil, fmt.Errorf("failed to connect to %s: %w", network, err)
+		}
+		server.readers[network] = reader
+	}
+	if multiConfig.NameService.Network != "" {
+		provider, registry, err := multiConfig.NameServiceEndpoint()
+		if err != nil {
+			server.Close()
+			return nil, err
+		}
+		resolver, err := chain.NewENSResolver(provider, registry)
+		if err != nil {
+			server.Close()
+			return nil, fmt.Errorf("failed to connect to the name service: %w", err)
+		}
+		server.planner.resolver = resolver
+	}
+	return server, nil
+}
+
+// NewMultiChainServerWithBuilders creates a server that pays out through the
+// given builders instead of connecting to the providers, one per active network
+func NewMultiChainServerWithBuilders(multiConfig *config.MultiChainConfig, builders map[string]chain.TxBuilder) (*MultiChainServer, error) {
+	var store queue.Store
+	if multiConfig.ClaimQueue.StorePath != "" {
+		store = queue.NewFileStore(multiConfig.ClaimQueue.StorePath)
+	}
 	server := &MultiChainServer{
 		multiConfig: multiConfig,
 		builders:    make(map[string]chain.TxBuilder),
-		limiters:    make(map[string]*ttlcache.Cache),
+		claims:      queue.NewManager(store, 30*time.Second),
+		readers:     make(map[string]chain.StatusReader),
 	}
 
-	// Initialize TxBuilders for each chain
 	for network, chainInstance := range multiConfig.GetActiveChains() {
-		// Create TxBuilder
-		builder, err := chain.NewTxBuilder(
-			chainInstance.Provider,
-			chainInstance.PrivateKey,
-			nil, // Chain ID will be auto-detected or set from config
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create TxBuilder for %s: %w", network, err)
+		builder, exists := builders[network]
+		if !exists {
+			return nil, fmt.Errorf("no TxBuilder for %s", network)
 		}
 
 		server.builders[network] = builder
-
-		// Create rate limiter for this network
-		limiter := ttlcache.NewCache()
-		limiter.SetTTL(time.Duration(chainInstance.Interval) * time.Minute)
-		server.limiters[network] = limiter
+		server.claims.AddNetwork(network, builder, multiConfig.ClaimQueue.Workers, multiConfig.ClaimQueue.Capacity)
+		if batch := chainInstance.Batch; batch != nil {
+			if err := server.claims.SetBatching(network, queue.Batching{
+				Contract: common.HexToAddress(batch.Contract),
+				Window:   batch.Window,
+				MaxSize:  batch.MaxSize,
+			}); err != nil {
+				return nil, err
+			}
+		}
 
 		log.Infof("Initialized %s network (Chain ID: %d, Symbol: %s)",
 			chainInstance.Config.Name, chainInstance.Config.ChainID, chainInstance.Config.Symbol)
+		if chainInstance.Config.StateAt(time.Now()) == config.NetworkDeprecated {
+			if sunset := chainInstance.Config.Sunset; !sunset.IsZero() {
+				log.Warnf("Network %s is deprecated, payouts end on %s", network, sunset.Format(sunsetLayout))
+			} else {
+				log.Warnf("Network %s is deprecated, consider moving its faucet to another network", network)
+			}
+		}
+	}
+
+	planner, err := newClaimPlanner(multiConfig)
+	if err != nil {
+		return nil, err
+	}
+	server.planner = planner
+	if server.audit, err = audit.Open(multiConfig.Audit); err != nil {
+		return nil, err
+	}
+
+	server.claims.SetConfirmations(multiConfig.ClaimQueue.Confirmations)
+	if err := server.claims.Start(); err != nil {
+		server.audit.Close()
+		return nil, fmt.Errorf("failed to start claim queue: %w", err)
 	}
 
 	return server, nil
@@ -64,19 +163,27 @@ func (s *MultiChainServer) setupRouter() *http.ServeMux {
 	// Serve static files
 	router.Handle("/", http.FileServer(web.Dist()))
 
-	// API routes
-	router.Handle("/api/claim", negroni.New(
-		NewMultiChainLimiter(s.limiters, s.multiConfig.ProxyCount),
-		NewCaptcha(s.multiConfig.HcaptchaSiteKey, s.multiConfig.HcaptchaSecret),
-		negroni.Wrap(s.handleMultiChainClaim()),
-	))
+	// Probes of orchestrators like Kubernetes
+	router.Handle("/healthz", s.handleHealth())
+	router.Handle("/readyz", s.handleReadiness())
+
+	// Both API versions share the audit log, rate limits and captcha
+	auditor := NewAuditor(s.audit, s.multiConfig.ProxyCount)
+	limiter := NewLimiter(s.planner, s.multiConfig.ProxyCount)
+	captcha := NewCaptcha(s.multiConfig.HcaptchaSiteKey, s.multiConfig.HcaptchaSecret, s.multiConfig.APIKeys...)
+	s.setupV1Routes(router, auditor, limiter, captcha)
+
+	// Unversioned routes kept for existing clients
+	router.Handle("/api/claim", negroni.New(auditor, limiter, captcha, negroni.Wrap(s.handleMultiChainClaim())))
+	router.Handle("/api/claim/", s.handleClaimStatus())
 	router.Handle("/api/info", s.handleMultiChainInfo())
 	router.Handle("/api/networks", s.handleNetworkList())
 
 	return router
 }
 
-// handleMultiChainClaim processes faucet claims for multiple networks
+// handleMultiChainClaim processes faucet claims. Claims without a network,
+// like those of single-chain clients, are paid on the default network.
 func (s *MultiChainServer) handleMultiChainClaim() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -84,55 +191,321 @@ func (s *MultiChainServer) handleMultiChainClaim() http.HandlerFunc {
 			return
 		}
 
-		// Parse request
 		var req multiChainClaimRequest
 		if err := decodeJSONBody(r, &req); err != nil {
 			log.WithError(err).Error("Failed to decode request")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusBadRequest)
+			renderError(w, r, requestError(err))
+			return
+		}
+		if req.isMulti() {
+			s.renderMultiClaim(w, r, req)
 			return
 		}
 
-		// Validate network
-		chainInstance, exists := s.multiConfig.GetChain(req.Network)
-		if !exists {
-			renderJSON(w, claimResponse{Message: "unsupported network"}, http.StatusBadRequest)
+		outcome, apiErr := s.submitClaim(r, req)
+		if apiErr != nil {
+			renderError(w, r, apiErr)
 			return
 		}
 
-		// Get TxBuilder for the network
-		builder, exists := s.builders[req.Network]
-		if !exists {
-			renderJSON(w, claimResponse{Message: "network not available"}, http.StatusInternalServerError)
+		// The address is only news to clients that claimed for a name
+		var address string
+		if outcome.name != "" {
+			address = outcome.claim.Address
+		}
+		if outcome.sent {
+			renderJSON(w, claimResponse{
+				Message: fmt.Sprintf("Txhash: %s", outcome.claim.TxHash),
+				ClaimID: outcome.claim.ID,
+				Address: address,
+				Name:    outcome.name,
+			}, http.StatusOK)
 			return
 		}
+		renderJSON(w, claimQueuedResponse{
+			Message:  fmt.Sprintf("Your claim is queued at position %d", outcome.position),
+			ClaimID:  outcome.claim.ID,
+			Status:   outcome.claim.Status,
+			Position: outcome.position,
+			Address:  address,
+			Name:     outcome.name,
+		}, http.StatusAccepted)
+	}
+}
 
-		// Process transaction
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-		defer cancel()
+// renderMultiClaim submits a multi-network claim and lists the result of every network
+func (s *MultiChainServer) renderMultiClaim(w http.ResponseWriter, r *http.Request, req multiChainClaimRequest) {
+	claimant, results, status, apiErr := s.submitClaims(r, req)
+	if apiErr != nil {
+		renderError(w, r, apiErr)
+		return
+	}
 
-		txHash, err := builder.Transfer(ctx, req.Address, chain.EtherToWei(chainInstance.Payout))
-		if err != nil {
-			log.WithError(err).WithField("network", req.Network).Error("Failed to send transaction")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusInternalServerError)
+	resp := multiClaimResponse{Name: claimant.name, Results: make([]networkClaimResponse, 0, len(results))}
+	if claimant.name != "" {
+		resp.Address = claimant.address
+	}
+	succeeded := 0
+	for _, result := range results {
+		item := networkClaimResponse{Network: result.network, Result: result.kind()}
+		switch {
+		case result.err != nil:
+			item.Message = result.err.message
+			item.RetryAfter = int(math.Ceil(result.err.retryAfter.Seconds()))
+		case result.outcome.sent:
+			succeeded++
+			item.Message = fmt.Sprintf("Txhash: %s", result.outcome.claim.TxHash)
+			item.TxHash = result.outcome.claim.TxHash
+			item.ClaimID = result.outcome.claim.ID
+		default:
+			succeeded++
+			item.Message = fmt.Sprintf("Your claim is queued at position %d", result.outcome.position)
+			item.ClaimID = result.outcome.claim.ID
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	resp.Message = fmt.Sprintf("%d of %d claims succeeded", succeeded, len(results))
+	renderJSON(w, resp, status)
+}
+
+// claimOutcome is a submitted claim. It is sent when the payout transaction
+// was broadcast before the response, otherwise it is still in the queue.
+// Name is set when the claim was made to a name.
+type claimOutcome struct {
+	claim    queue.Claim
+	name     string
+	position int
+	sent     bool
+}
+
+// Results of the networks of a multi-network claim
+const (
+	resultSuccess     = "success"
+	resultRateLimited = "rate_limited"
+	resultError       = "error"
+)
+
+// networkResult is the outcome of a multi-network claim on one network
+type networkResult struct {
+	network string
+	outcome claimOutcome
+	err     *apiError
+}
+
+func (r networkResult) kind() string {
+	switch {
+	case r.err == nil:
+		return resultSuccess
+	case r.err.code == codeRateLimited:
+		return resultRateLimited
+	default:
+		return resultError
+	}
+}
+
+// submitClaim queues the claim of the request and, unless claims are async,
+// waits for its payout like before the queue existed
+func (s *MultiChainServer) submitClaim(r *http.Request, req multiChainClaimRequest) (claimOutcome, *apiError) {
+	ctx, span := tracer.Start(r.Context(), "submit claim")
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	plan, reserved, apiErr := s.claimPlan(r, req)
+	if apiErr != nil {
+		return claimOutcome{}, apiErr
+	}
+
+	network := plan.networks[0]
+	if apiErr := plan.rejected[network]; apiErr != nil {
+		return claimOutcome{}, apiErr
+	}
+	outcome, apiErr := s.queueClaim(r.Context(), network, plan.claimant.address, plan.amounts[network], reserved[network])
+	if apiErr != nil {
+		return claimOutcome{}, apiErr
+	}
+	outcome.name = plan.claimant.name
+	span.SetAttributes(attribute.String("network", network), attribute.String("claim.id", outcome.claim.ID))
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	outcome, apiErr = s.awaitClaim(ctx, outcome)
+	auditFrom(r).result(network, outcome, apiErr)
+	return outcome, apiErr
+}
+
+// submitClaims queues a claim on each network of a multi-network claim,
+// except for the rate-limited ones, and waits for their payouts together.
+// The status is 200 as soon as one network succeeds.
+func (s *MultiChainServer) submitClaims(r *http.Request, req multiChainClaimRequest) (claimant, []networkResult, int, *apiError) {
+	ctx, span := tracer.Start(r.Context(), "submit claims")
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	plan, reserved, apiErr := s.claimPlan(r, req)
+	if apiErr != nil {
+		return claimant{}, nil, 0, apiErr
+	}
+
+	results := make([]networkResult, len(plan.networks))
+	for i, network := range plan.networks {
+		results[i].network = network
+		if apiErr := plan.rejected[network]; apiErr != nil {
+			results[i].err = apiErr
+			continue
+		}
+		results[i].outcome, results[i].err = s.queueClaim(r.Context(), network, plan.claimant.address, plan.amounts[network], reserved[network])
+		results[i].outcome.name = plan.claimant.name
+	}
+
+	span.SetAttributes(attribute.StringSlice("networks", plan.networks))
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	status := 0
+	for i := range results {
+		if results[i].err == nil {
+			results[i].outcome, results[i].err = s.awaitClaim(ctx, results[i].outcome)
+		}
+		auditFrom(r).result(results[i].network, results[i].outcome, results[i].err)
+		switch {
+		case results[i].err == nil:
+			status = http.StatusOK
+		case status == 0:
+			status = results[i].err.status
+		}
+	}
+	return plan.claimant, results, status, nil
+}
+
+// payoutError explains why the payout of a failed claim failed. Causes found
+// before sending get a message users can act on instead of the node's error.
+func (s *MultiChainServer) payoutError(claim queue.Claim) *apiError {
+	name, symbol := claim.Network, "native"
+	if chainInstance, exists := s.multiConfig.GetChain(claim.Network); exists {
+		name, symbol = chainInstance.Config.Name, chainInstance.Config.Symbol
+	}
+	switch claim.Cause {
+	case queue.CauseInsufficientFunds:
+		return &apiError{status: http.StatusServiceUnavailable, code: codeFaucetEmpty, message: fmt.Sprintf("The faucet on %s is out of funds, please try again later", name)}
+	case queue.CauseRecipientReverts:
+		return &apiError{status: http.StatusUnprocessableEntity, code: codeRecipientRejected, message: fmt.Sprintf("The recipient rejected the transfer, a contract has to accept plain %s transfers", symbol)}
+	case queue.CauseFeeTooHigh:
+		return &apiError{status: http.StatusServiceUnavailable, code: codeNetworkCongested, message: fmt.Sprintf("Fees on %s are too high right now, please try again later", name)}
+	}
+	return &apiError{status: http.StatusInternalServerError, code: codeTransferFailed, message: claim.Error}
+}
+
+// claimPlan returns the plan and reservations of a claim that passed the
+// Limiter, or plans the claim without rate limits when it did not
+func (s *MultiChainServer) claimPlan(r *http.Request, req multiChainClaimRequest) (*claimPlan, map[string]*ratelimit.Reservation, *apiError) {
+	plan, reserved := takeReservations(r)
+	if plan != nil {
+		return plan, reserved, nil
+	}
+	plan, apiErr := s.planner.plan(r, req)
+	if apiErr == nil {
+		auditFrom(r).plan(plan)
+	}
+	return plan, nil, apiErr
+}
+
+// queueClaim submits a claim of amount on network. The queue takes over the rate limit
+// reservation, so it is only committed once the claim is final and rolled back when it
+// failed, even after its transaction was broadcast.
+func (s *MultiChainServer) queueClaim(ctx context.Context, network, address string, amount decimal.Decimal, reservation *ratelimit.Reservation) (claimOutcome, *apiError) {
+	chainInstance, exists := s.multiConfig.GetChain(network)
+	if !exists {
+		if reservation != nil {
+			reservation.Rollback()
+		}
+		return claimOutcome{}, &apiError{status: http.StatusBadRequest, code: codeUnsupportedNetwork, message: "unsupported network"}
+	}
+	value, err := chain.ToBaseUnits(amount, chainInstance.Config.Decimals)
+	if err != nil {
+		if reservation != nil {
+			reservation.Rollback()
+		}
+		return claimOutcome{}, &apiError{status: http.StatusBadRequest, code: codeInvalidAmount, message: err.Error()}
+	}
+
+	claim, position, err := s.claims.Submit(ctx, network, address, value, func(c queue.Claim) {
+		if reservation == nil {
 			return
 		}
+		if c.Status == queue.StatusFailed {
+			reservation.Rollback()
+		} else {
+			reservation.Commit()
+		}
+	})
+	if err != nil {
+		if reservation != nil {
+			reservation.Rollback()
+		}
+		if errors.Is(err, queue.ErrQueueFull) {
+			return claimOutcome{}, &apiError{status: http.StatusServiceUnavailable, code: codeQueueFull, message: "The faucet is busy, please try again later"}
+		}
+		return claimOutcome{}, &apiError{status: http.StatusInternalServerError, code: codeNetworkUnavailable, message: "network not available"}
+	}
+	return claimOutcome{claim: claim, position: position}, nil
+}
 
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": req.Address,
-			"network": req.Network,
-			"amount":  chainInstance.Payout,
-			"symbol":  chainInstance.Config.Symbol,
-		}).Info("Transaction sent successfully")
+// awaitClaim waits for the payout of a queued claim unless claims are async.
+// A claim that is not paid before ctx is done is returned as still queued.
+func (s *MultiChainServer) awaitClaim(ctx context.Context, outcome claimOutcome) (claimOutcome, *apiError) {
+	if s.multiConfig.ClaimQueue.Async {
+		return outcome, nil
+	}
+
+	ctx, span := tracer.Start(ctx, "await payout", trace.WithAttributes(attribute.String("claim.id", outcome.claim.ID)))
+	claim, err := s.claims.Wait(ctx, outcome.claim.ID)
+	span.End()
+	if err != nil {
+		// Still queued, the client can follow the claim by its ID
+		return outcome, nil
+	}
+	if claim.Status == queue.StatusFailed {
+		return claimOutcome{}, s.payoutError(claim)
+	}
 
-		resp := claimResponse{
-			Message: fmt.Sprintf("Txhash: %s", txHash),
+	chainInstance, _ := s.multiConfig.GetChain(claim.Network)
+	log.WithFields(log.Fields{
+		"txHash":  claim.TxHash,
+		"address": claim.Address,
+		"name":    outcome.name,
+		"network": claim.Network,
+		"amount":  chain.FromBaseUnits(claim.Amount, chainInstance.Config.Decimals).String(),
+		"symbol":  chainInstance.Config.Symbol,
+	}).Info("Transaction sent successfully")
+	return claimOutcome{claim: claim, name: outcome.name, sent: true}, nil
+}
+
+// handleClaimStatus returns the state of a queued claim, or streams its
+// updates when /events is appended to the path
+func (s *MultiChainServer) handleClaimStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.NotFound(w, r)
+			return
 		}
-		renderJSON(w, resp, http.StatusOK)
+
+		id := strings.TrimPrefix(r.URL.Path, "/api/claim/")
+		if strings.HasSuffix(id, "/events") {
+			s.streamClaimEvents(w, r, strings.TrimSuffix(id, "/events"), legacyClaimView)
+			return
+		}
+		claim, position, exists := s.claims.Get(id)
+		if !exists {
+			renderError(w, r, errClaimNotFound)
+			return
+		}
+
+		renderJSON(w, legacyClaimView(claim, position), http.StatusOK)
 	}
 }
 
-// handleMultiChainInfo returns information about all active networks
+// handleMultiChainInfo returns information about all active networks. The
+// account, network, payout and symbol of the default network are included at
+// the top level for single-chain clients.
 func (s *MultiChainServer) handleMultiChainInfo() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "GET" {
@@ -141,41 +514,74 @@ func (s *MultiChainServer) handleMultiChainInfo() http.HandlerFunc {
 		}
 
 		// Build network info for active chains
+		now := time.Now()
 		activeNetworks := make(map[string]ActiveNetworkInfo)
 		for network, chainInstance := range s.multiConfig.GetActiveChains() {
 			builder := s.builders[network]
+			metadata := chainInstance.Config.NetworkMetadata
 			activeNetworks[network] = ActiveNetworkInfo{
-				Name:      chainInstance.Config.Name,
-				Symbol:    chainInstance.Config.Symbol,
-				ChainID:   chainInstance.Config.ChainID,
-				IsTestnet: chainInstance.Config.IsTestnet,
-				Account:   builder.Sender().String(),
-				Payout:    strconv.FormatFloat(chainInstance.Payout, 'f', -1, 64),
+				Name:               chainInstance.Config.Name,
+				Symbol:             chainInstance.Config.Symbol,
+				ChainID:            chainInstance.Config.ChainID,
+				IsTestnet:          chainInstance.Config.IsTestnet,
+				Account:            builder.Sender().String(),
+				Payout:             chainInstance.Payout.String(),
+				CurrencyName:       metadata.CurrencyName,
+				Decimals:           chainInstance.Config.Decimals,
+				RPCURL:             metadata.PublicRPC,
+				ExplorerTxURL:      metadata.ExplorerTxURL,
+				ExplorerAddressURL: metadata.ExplorerAddressURL,
+				Icon:               metadata.Icon,
+				Paused:             chainInstance.Paused,
+				State:              string(chainInstance.Config.StateAt(now)),
+				Sunset:             formatSunset(chainInstance.Config.Sunset),
 			}
 		}
 
 		// Convert all supported networks to DTO format
 		supportedNetworks := make(map[string]NetworkInfo)
 		for name, netConfig := range config.GetSupportedNetworks() {
+			state := netConfig.StateAt(now)
+			if state == config.NetworkRemoved {
+				continue
+			}
 			supportedNetworks[name] = NetworkInfo{
 				Name:      netConfig.Name,
 				Symbol:    netConfig.Symbol,
 				ChainID:   netConfig.ChainID,
 				IsTestnet: netConfig.IsTestnet,
+				State:     string(state),
+				Sunset:    formatSunset(netConfig.Sunset),
 			}
 		}
 
-		resp := multiChainInfoResponse{
+		resp := infoResponse{
 			DefaultNetwork:    s.multiConfig.DefaultChain,
 			ActiveNetworks:    activeNetworks,
 			SupportedNetworks: supportedNetworks,
 			HcaptchaSiteKey:   s.multiConfig.HcaptchaSiteKey,
+			NameService:       s.nameService(),
+		}
+
+		if defaultNetwork, exists := activeNetworks[s.multiConfig.DefaultChain]; exists {
+			resp.Account = defaultNetwork.Account
+			resp.Network = defaultNetwork.Name
+			resp.Payout = defaultNetwork.Payout
+			resp.Symbol = defaultNetwork.Symbol
 		}
 
 		renderJSON(w, resp, http.StatusOK)
 	}
 }
 
+// nameService returns the network names are resolved on, empty without a resolver
+func (s *MultiChainServer) nameService() string {
+	if s.planner.resolver == nil {
+		return ""
+	}
+	return s.multiConfig.NameService.Network
+}
+
 // handleNetworkList returns list of active networks
 func (s *MultiChainServer) handleNetworkList() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -192,14 +598,40 @@ func (s *MultiChainServer) handleNetworkList() http.HandlerFunc {
 	}
 }
 
-// Run starts the multi-chain server
-func (s *MultiChainServer) Run() {
-	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
+// Handler returns the HTTP handler of the server with panic recovery and request logging
+func (s *MultiChainServer) Handler() http.Handler {
+	n := negroni.New(NewTracing(), negroni.NewRecovery(), negroni.NewLogger())
 	n.UseHandler(s.setupRouter())
+	return n
+}
+
+// Close stops paying out claims, closes the connections of the readiness
+// checks, flushes the spans of finished requests and closes the audit log
+func (s *MultiChainServer) Close() {
+	s.claims.Close()
+	for _, reader := range s.readers {
+		// Readers dialed with chain.NewStatusReader hold an RPC connection
+		if closer, ok := reader.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+	if err := s.audit.Close(); err != nil {
+		log.WithError(err).Warn("Failed to close the audit log")
+	}
+	if s.shutdownTracing != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.shutdownTracing(ctx); err != nil {
+			log.WithError(err).Warn("Failed to flush traces")
+		}
+	}
+}
 
-	log.Infof("Starting multi-chain faucet server on port %d", s.multiConfig.HTTPPort)
+// Run starts the multi-chain server
+func (s *MultiChainServer) Run() {
+	log.Infof("Starting faucet server on port %d", s.multiConfig.HTTPPort)
 	log.Infof("Active networks: %v", s.multiConfig.GetChainNetworks())
 	log.Infof("Default network: %s", s.multiConfig.DefaultChain)
 
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.multiConfig.HTTPPort), n))
+	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.multiConfig.HTTPPort), s.Handler()))
 }
@@ -1,101 +0,0 @@
-package server
-
-import (
-	"context"
-	"fmt"
-	"net/http"
-	"strconv"
-	"time"
-
-	log "github.com/sirupsen/logrus"
-	"github.com/urfave/negroni/v3"
-
-	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
-	"github.com/guyuxiang/multi-chain-faucet/internal/config"
-	"github.com/guyuxiang/multi-chain-faucet/web"
-)
-
-type Server struct {
-	chain.TxBuilder
-	cfg *Config
-}
-
-func NewServer(builder chain.TxBuilder, cfg *Config) *Server {
-	return &Server{
-		TxBuilder: builder,
-		cfg:       cfg,
-	}
-}
-
-func (s *Server) setupRouter() *http.ServeMux {
-	router := http.NewServeMux()
-	router.Handle("/", http.FileServer(web.Dist()))
-	limiter := NewLimiter(s.cfg.proxyCount, time.Duration(s.cfg.interval)*time.Minute)
-	hcaptcha := NewCaptcha(s.cfg.hcaptchaSiteKey, s.cfg.hcaptchaSecret)
-	router.Handle("/api/claim", negroni.New(limiter, hcaptcha, negroni.Wrap(s.handleClaim())))
-	router.Handle("/api/info", s.handleInfo())
-
-	return router
-}
-
-func (s *Server) Run() {
-	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
-	n.UseHandler(s.setupRouter())
-	log.Infof("Starting http server %d", s.cfg.httpPort)
-	log.Fatal(http.ListenAndServe(":"+strconv.Itoa(s.cfg.httpPort), n))
-}
-
-func (s *Server) handleClaim() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
-			http.NotFound(w, r)
-			return
-		}
-
-		// The error always be nil since it has already been handled in limiter
-		address, _ := readAddress(r)
-		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
-		defer cancel()
-		txHash, err := s.Transfer(ctx, address, chain.EtherToWei(s.cfg.payout))
-		if err != nil {
-			log.WithError(err).Error("Failed to send transaction")
-			renderJSON(w, claimResponse{Message: err.Error()}, http.StatusInternalServerError)
-			return
-		}
-
-		log.WithFields(log.Fields{
-			"txHash":  txHash,
-			"address": address,
-		}).Info("Transaction sent successfully")
-		resp := claimResponse{Message: fmt.Sprintf("Txhash: %s", txHash)}
-		renderJSON(w, resp, http.StatusOK)
-	}
-}
-
-func (s *Server) handleInfo() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "GET" {
-			http.NotFound(w, r)
-			return
-		}
-		// Convert network configs to DTO format
-		supportedNetworks := make(map[string]NetworkInfo)
-		for name, netConfig := range config.GetSupportedNetworks() {
-			supportedNetworks[name] = NetworkInfo{
-				Name:      netConfig.Name,
-				Symbol:    netConfig.Symbol,
-				ChainID:   netConfig.ChainID,
-				IsTestnet: netConfig.IsTestnet,
-			}
-		}
-
-		renderJSON(w, infoResponse{
-			Account:           s.Sender().String(),
-			Network:           s.cfg.network,
-			Symbol:            s.cfg.symbol,
-			Payout:            strconv.FormatFloat(s.cfg.payout, 'f', -1, 64),
-			HcaptchaSiteKey:   s.cfg.hcaptchaSiteKey,
-			SupportedNetworks: supportedNetworks,
-		}, http.StatusOK)
-	}
-}
@@ -3,19 +3,26 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/stretchr/testify/mock"
 
 	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
 )
 
+// oneEther is the default payout in wei
+var oneEther = big.NewInt(1e18)
+
 type MockTxBuilder struct {
 	mock.Mock
 }
@@ -30,25 +37,15 @@ func (m *MockTxBuilder) Transfer(ctx context.Context, to string, value *big.Int)
 	return args.Get(0).(common.Hash), args.Error(1)
 }
 
-func setupTestServer(mockBuilder chain.TxBuilder) *Server {
-	cfg := &Config{
-		httpPort:   8080,
-		proxyCount: 0,
-		interval:   0,
-		network:    "testnet",
-		symbol:     "ETH",
-		payout:     1.0,
-	}
-	return NewServer(mockBuilder, cfg)
-}
-
+// TestHandleClaim checks that single-chain clients, which do not name a
+// network, are paid on the default network
 func TestHandleClaim(t *testing.T) {
 	mockBuilder := new(MockTxBuilder)
 	expectedAddress := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
-	expectedAmount := chain.EtherToWei(1.0)
+	expectedAmount := oneEther
 	mockBuilder.On("Transfer", mock.Anything, expectedAddress, expectedAmount).Return(common.Hash{1}, nil)
 
-	server := setupTestServer(mockBuilder)
+	server := setupMultiChainTestServer(t, mockBuilder, false)
 	reqBody := strings.NewReader(fmt.Sprintf(`{"address": "%s"}`, expectedAddress))
 	req, err := http.NewRequest("POST", "/api/claim", reqBody)
 	if err != nil {
@@ -56,7 +53,7 @@ func TestHandleClaim(t *testing.T) {
 	}
 
 	rr := httptest.NewRecorder()
-	handler := server.handleClaim()
+	handler := server.handleMultiChainClaim()
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -68,6 +65,9 @@ func TestHandleClaim(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if resp.Message != "Txhash: "+(common.Hash{1}).Hex() {
+		t.Errorf("Unexpected message %q", resp.Message)
+	}
 
 	mockBuilder.AssertExpectations(t)
 
@@ -77,14 +77,14 @@ func TestHandleInfo(t *testing.T) {
 	mockBuilder := new(MockTxBuilder)
 	mockBuilder.On("Sender").Return(common.HexToAddress("0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"))
 
-	server := setupTestServer(mockBuilder)
+	server := setupMultiChainTestServer(t, mockBuilder, false)
 	req, err := http.NewRequest("GET", "/api/info", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr := httptest.NewRecorder()
-	handler := server.handleInfo()
+	handler := server.handleMultiChainInfo()
 	handler.ServeHTTP(rr, req)
 
 	if rr.Code != http.StatusOK {
@@ -97,5 +97,346 @@ func TestHandleInfo(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	// The single-chain fields describe the default network
+	if resp.Account != "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045" || resp.Network != "Ethereum Sepolia" ||
+		resp.Payout != "1" || resp.Symbol != "ETH" {
+		t.Errorf("Unexpected single-chain fields %+v", resp)
+	}
+	if resp.DefaultNetwork != "sepolia" || len(resp.ActiveNetworks) != 1 {
+		t.Errorf("Unexpected networks %+v", resp)
+	}
+	sepolia := resp.ActiveNetworks["sepolia"]
+	if sepolia.ExplorerTxURL != "https://sepolia.etherscan.io/tx/{hash}" || sepolia.CurrencyName != "Ether" ||
+		sepolia.Decimals != 18 || sepolia.RPCURL == "" {
+		t.Errorf("Unexpected network metadata %+v", sepolia)
+	}
+	if sepolia.State != "active" || sepolia.Sunset != "" {
+		t.Errorf("Unexpected state %q, sunset %q", sepolia.State, sepolia.Sunset)
+	}
+	if goerli, listed := resp.SupportedNetworks["goerli"]; listed {
+		t.Errorf("Removed network listed as %+v", goerli)
+	}
+
 	mockBuilder.AssertExpectations(t)
 }
+
+func setupMultiChainTestServer(t *testing.T, mockBuilder chain.TxBuilder, async bool) *MultiChainServer {
+	multiConfig := config.NewMultiChainConfig()
+	multiConfig.ClaimQueue.Async = async
+	if err := multiConfig.AddChainWithKey(config.ChainConfigInput{Network: "sepolia", Provider: "http://127.0.0.1:8545"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	claims := queue.NewManager(nil, time.Second)
+	claims.AddNetwork("sepolia", mockBuilder, 1, 10)
+	if err := claims.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(claims.Close)
+
+	planner, err := newClaimPlanner(multiConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &MultiChainServer{
+		multiConfig: multiConfig,
+		builders:    map[string]chain.TxBuilder{"sepolia": mockBuilder},
+		planner:     planner,
+		claims:      claims,
+	}
+}
+
+func TestHandleMultiChainClaim(t *testing.T) {
+	expectedAddress := "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	body := fmt.Sprintf(`{"address": "%s", "network": "sepolia"}`, expectedAddress)
+
+	t.Run("sync", func(t *testing.T) {
+		mockBuilder := new(MockTxBuilder)
+		mockBuilder.On("Transfer", mock.Anything, expectedAddress, oneEther).Return(common.Hash{1}, nil)
+		server := setupMultiChainTestServer(t, mockBuilder, false)
+
+		rr := httptest.NewRecorder()
+		server.handleMultiChainClaim().ServeHTTP(rr, httptest.NewRequest("POST", "/api/claim", strings.NewReader(body)))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, but got %d", http.StatusOK, rr.Code)
+		}
+		var resp claimResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Message != "Txhash: "+(common.Hash{1}).Hex() {
+			t.Errorf("Unexpected message %q", resp.Message)
+		}
+		mockBuilder.AssertExpectations(t)
+	})
+
+	t.Run("async", func(t *testing.T) {
+		mockBuilder := new(MockTxBuilder)
+		mockBuilder.On("Transfer", mock.Anything, expectedAddress, oneEther).Return(common.Hash{1}, nil)
+		server := setupMultiChainTestServer(t, mockBuilder, true)
+
+		rr := httptest.NewRecorder()
+		server.handleMultiChainClaim().ServeHTTP(rr, httptest.NewRequest("POST", "/api/claim", strings.NewReader(body)))
+		if rr.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, but got %d", http.StatusAccepted, rr.Code)
+		}
+		var queued claimQueuedResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &queued); err != nil {
+			t.Fatal(err)
+		}
+		if queued.ClaimID == "" || queued.Position != 1 {
+			t.Fatalf("Unexpected queued response %+v", queued)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := server.claims.Wait(ctx, queued.ClaimID); err != nil {
+			t.Fatal(err)
+		}
+
+		rr = httptest.NewRecorder()
+		server.handleClaimStatus().ServeHTTP(rr, httptest.NewRequest("GET", "/api/claim/"+queued.ClaimID, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, but got %d", http.StatusOK, rr.Code)
+		}
+		var status claimStatusResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+			t.Fatal(err)
+		}
+		if status.Status != queue.StatusBroadcast || status.TxHash != (common.Hash{1}).Hex() {
+			t.Errorf("Unexpected claim status %+v", status)
+		}
+
+		// The mock cannot watch transactions, so the stream ends at broadcast
+		rr = httptest.NewRecorder()
+		server.handleClaimStatus().ServeHTTP(rr, httptest.NewRequest("GET", "/api/claim/"+queued.ClaimID+"/events", nil))
+		if ct := rr.Header().Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("Expected an event stream, got %q", ct)
+		}
+		if !strings.Contains(rr.Body.String(), "event: broadcast\n") {
+			t.Errorf("Unexpected event stream %q", rr.Body.String())
+		}
+		mockBuilder.AssertExpectations(t)
+	})
+}
+
+func TestHandleMultiNetworkClaim(t *testing.T) {
+	multiConfig := config.NewMultiChainConfig()
+	builders := make(map[string]chain.TxBuilder)
+	for i, network := range []string{"sepolia", "holesky"} {
+		if err := multiConfig.AddChainWithKey(config.ChainConfigInput{Network: network, Provider: "http://127.0.0.1:8545"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		mockBuilder := new(MockTxBuilder)
+		mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{byte(i + 1)}, nil)
+		builders[network] = mockBuilder
+	}
+	server, err := NewMultiChainServerWithBuilders(multiConfig, builders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	router := server.setupRouter()
+
+	// Requests run in order, so sepolia is rate limited after the first one
+	tests := []struct {
+		name        string
+		path        string
+		body        string
+		wantStatus  int
+		wantResults map[string]string
+	}{
+		{name: "single network", path: "/api/claim", body: `{"address": "` + testAddress + `", "network": "sepolia"}`, wantStatus: http.StatusOK},
+		{
+			name:        "all networks",
+			path:        "/api/v1/claims",
+			body:        `{"address": "` + testAddress + `", "networks": "all"}`,
+			wantStatus:  http.StatusOK,
+			wantResults: map[string]string{"holesky": resultSuccess, "sepolia": resultRateLimited},
+		},
+		{name: "every network rate limited", path: "/api/claim", body: `{"address": "` + testAddress + `", "networks": ["holesky", "sepolia"]}`, wantStatus: http.StatusTooManyRequests},
+		{name: "unsupported network", path: "/api/claim", body: `{"address": "` + testAddress + `", "networks": ["holesky", "nope"]}`, wantStatus: http.StatusBadRequest},
+		{name: "network and networks", path: "/api/claim", body: `{"address": "` + testAddress + `", "network": "sepolia", "networks": "all"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid networks", path: "/api/claim", body: `{"address": "` + testAddress + `", "networks": "some"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.RemoteAddr = "192.0.2.1:1234"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantResults == nil {
+				return
+			}
+
+			var resp multiClaimV1
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			results := make(map[string]string)
+			for _, result := range resp.Results {
+				results[result.Network] = result.Result
+				if result.Result == resultSuccess && (result.Claim == nil || result.Claim.TxHash == "") {
+					t.Errorf("successful claim on %s without a transaction: %+v", result.Network, result)
+				}
+				if result.Result == resultRateLimited && (result.Error == nil || result.Error.RetryAfter != 86400) {
+					t.Errorf("rate-limited claim on %s without retry_after: %+v", result.Network, result)
+				}
+			}
+			if fmt.Sprint(results) != fmt.Sprint(tt.wantResults) {
+				t.Errorf("results = %v, want %v", results, tt.wantResults)
+			}
+		})
+	}
+}
+
+// fakeResolver resolves the names it knows and fails for broken.eth
+type fakeResolver map[string]common.Address
+
+func (f fakeResolver) Resolve(ctx context.Context, name string) (common.Address, error) {
+	if name == "broken.eth" {
+		return common.Address{}, errors.New("connection refused")
+	}
+	address, exists := f[name]
+	if !exists {
+		return common.Address{}, chain.ErrNameNotFound
+	}
+	return address, nil
+}
+
+func TestNameClaims(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{1}, nil).Once()
+	server := setupMultiChainTestServer(t, mockBuilder, false)
+	server.planner.resolver = fakeResolver{"vitalik.eth": common.HexToAddress(testAddress)}
+	router := server.setupRouter()
+
+	// Requests run in order, so the address is rate limited after its name claimed
+	tests := []struct {
+		name       string
+		address    string
+		wantStatus int
+		wantCode   errorCode
+		wantName   string
+	}{
+		{name: "name", address: "Vitalik.eth", wantStatus: http.StatusOK, wantName: "vitalik.eth"},
+		{name: "address of the name", address: testAddress, wantStatus: http.StatusTooManyRequests, wantCode: codeRateLimited},
+		{name: "unknown name", address: "nobody.eth", wantStatus: http.StatusBadRequest, wantCode: codeInvalidAddress},
+		{name: "resolver fails", address: "broken.eth", wantStatus: http.StatusServiceUnavailable, wantCode: codeNetworkUnavailable},
+		{name: "not a name", address: "vitalik", wantStatus: http.StatusBadRequest, wantCode: codeInvalidAddress},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(`{"address": "`+tt.address+`"}`))
+			// Every request comes from another IP, so only the address limits them
+			req.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantCode != "" {
+				var resp errorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Error.Code != tt.wantCode {
+					t.Errorf("code = %s, want %s", resp.Error.Code, tt.wantCode)
+				}
+				return
+			}
+			var claim claimV1
+			if err := json.Unmarshal(rr.Body.Bytes(), &claim); err != nil {
+				t.Fatal(err)
+			}
+			if claim.Name != tt.wantName || claim.Address != testAddress {
+				t.Errorf("name = %q, address = %s, want %q, %s", claim.Name, claim.Address, tt.wantName, testAddress)
+			}
+		})
+	}
+	mockBuilder.AssertExpectations(t)
+}
+
+// TestClosedNetworks checks that claims on a network past its sunset or
+// paused are refused without a transfer
+func TestClosedNetworks(t *testing.T) {
+	tests := []struct {
+		name        string
+		sunset      time.Time
+		paused      bool
+		wantStatus  int
+		wantCode    errorCode
+		wantMessage string
+	}{
+		{name: "sunset", sunset: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), wantStatus: http.StatusGone, wantCode: codeNetworkSunset, wantMessage: "2024-06-01"},
+		{name: "paused", paused: true, wantStatus: http.StatusServiceUnavailable, wantCode: codeNetworkUnavailable, wantMessage: "paused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			server := setupMultiChainTestServer(t, mockBuilder, false)
+			if !tt.sunset.IsZero() {
+				server.planner.sunsets["sepolia"] = tt.sunset
+			}
+			server.planner.paused["sepolia"] = tt.paused
+
+			req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(`{"address": "`+testAddress+`"}`))
+			rr := httptest.NewRecorder()
+			server.setupRouter().ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			var resp errorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.Code != tt.wantCode || !strings.Contains(resp.Error.Message, tt.wantMessage) {
+				t.Errorf("unexpected error %+v", resp.Error)
+			}
+			mockBuilder.AssertNotCalled(t, "Transfer", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestPayoutErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    errorCode
+		wantMessage string
+	}{
+		{name: "faucet empty", err: fmt.Errorf("%w: balance 0", chain.ErrInsufficientFaucetFunds), wantStatus: http.StatusServiceUnavailable, wantCode: codeFaucetEmpty, wantMessage: "out of funds"},
+		{name: "recipient reverts", err: fmt.Errorf("%w: execution reverted", chain.ErrRecipientReverts), wantStatus: http.StatusUnprocessableEntity, wantCode: codeRecipientRejected, wantMessage: "plain ETH transfers"},
+		{name: "fees too high", err: fmt.Errorf("%w: base fee 9, cap 5", chain.ErrFeeCapExceeded), wantStatus: http.StatusServiceUnavailable, wantCode: codeNetworkCongested, wantMessage: "too high"},
+		{name: "other", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError, wantCode: codeTransferFailed, wantMessage: "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBuilder := new(MockTxBuilder)
+			mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{}, tt.err)
+			server := setupMultiChainTestServer(t, mockBuilder, false)
+
+			req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(`{"address": "`+testAddress+`"}`))
+			rr := httptest.NewRecorder()
+			server.setupRouter().ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			var resp errorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Error.Code != tt.wantCode || !strings.Contains(resp.Error.Message, tt.wantMessage) {
+				t.Errorf("unexpected error %+v", resp.Error)
+			}
+		})
+	}
+}
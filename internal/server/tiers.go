@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+)
+
+// tierPolicy is what callers of a tier get on a network: the payout and the
+// rate limit policy their claims are charged to
+type tierPolicy struct {
+	config.TierConfig
+	limits *ratelimit.Policy
+}
+
+// claimPlanner decides what a claim gets on each of its networks from the
+// tier of the caller and the amount it requests
+type claimPlanner struct {
+	tiers          map[string]map[config.Tier]tierPolicy
+	decimals       map[string]int
+	sunsets        map[string]time.Time
+	paused         map[string]bool
+	networks       []string
+	defaultNetwork string
+	captcha        bool
+	apiKeys        bool
+	authHeader     string
+	// resolver resolves names in claims, nil accepts addresses only
+	resolver chain.NameResolver
+}
+
+func newClaimPlanner(multiConfig *config.MultiChainConfig) (*claimPlanner, error) {
+	p := &claimPlanner{
+		tiers:          make(map[string]map[config.Tier]tierPolicy),
+		decimals:       make(map[string]int),
+		sunsets:        make(map[string]time.Time),
+		paused:         make(map[string]bool),
+		defaultNetwork: multiConfig.DefaultChain,
+		captcha:        multiConfig.HcaptchaSecret != "",
+		apiKeys:        len(multiConfig.APIKeys) > 0,
+		authHeader:     multiConfig.AuthHeader,
+	}
+
+	for network, chainInstance := range multiConfig.GetActiveChains() {
+		policy, err := ratelimit.NewPolicy(chainInstance.RateLimits...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create rate limiter for %s: %w", network, err)
+		}
+
+		tiers := make(map[config.Tier]tierPolicy)
+		for _, tier := range config.Tiers {
+			tierConfig, exists := chainInstance.Tier(tier)
+			// Without configured tiers anonymous callers have to solve the captcha
+			if !exists || tier == config.TierAnonymous && len(chainInstance.Tiers) == 0 && p.captcha {
+				continue
+			}
+			limits := policy
+			if tierConfig.RateLimits != nil {
+				if limits, err = ratelimit.NewPolicy(tierConfig.RateLimits...); err != nil {
+					return nil, fmt.Errorf("failed to create rate limiter for tier %s of %s: %w", tier, network, err)
+				}
+			}
+			tiers[tier] = tierPolicy{TierConfig: tierConfig, limits: limits}
+		}
+		p.tiers[network] = tiers
+		p.decimals[network] = chainInstance.Config.Decimals
+		p.paused[network] = chainInstance.Paused
+		if sunset := chainInstance.Config.Sunset; !sunset.IsZero() {
+			p.sunsets[network] = sunset
+		}
+		p.networks = append(p.networks, network)
+	}
+	sort.Strings(p.networks)
+
+	return p, nil
+}
+
+// tier classifies the caller by its strongest credential. The Captcha
+// middleware verifies the credential, so a tier is only granted for a
+// credential the faucet is configured to check.
+func (p *claimPlanner) tier(r *http.Request) config.Tier {
+	switch {
+	case p.apiKeys && r.Header.Get("X-API-Key") != "":
+		return config.TierAPIKey
+	case p.authHeader != "" && r.Header.Get(p.authHeader) != "":
+		return config.TierSocial
+	case p.captcha && r.Header.Get("h-captcha-response") != "":
+		return config.TierCaptcha
+	default:
+		return config.TierAnonymous
+	}
+}
+
+// claimPlan is what a claim gets on each of its networks. Networks the claim
+// is rejected on have an error in rejected instead of an amount.
+type claimPlan struct {
+	claimant claimant
+	tier     config.Tier
+	networks []string
+	amounts  map[string]decimal.Decimal
+	limits   map[string]*ratelimit.Policy
+	rejected map[string]*apiError
+}
+
+// plan resolves the networks, tier and amounts of a claim. Only errors of
+// the request as a whole are returned, the others are rejections of a network.
+func (p *claimPlanner) plan(r *http.Request, req multiChainClaimRequest) (*claimPlan, *apiError) {
+	networks, apiErr := req.networks(p.defaultNetwork, p.networks)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	requested, apiErr := req.amount()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	claimant, apiErr := p.claimant(r.Context(), req.Address)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	plan := &claimPlan{
+		claimant: claimant,
+		tier:     p.tier(r),
+		networks: networks,
+		amounts:  make(map[string]decimal.Decimal),
+		limits:   make(map[string]*ratelimit.Policy),
+		rejected: make(map[string]*apiError),
+	}
+	for _, network := range networks {
+		if _, exists := p.tiers[network]; !exists {
+			return nil, &apiError{status: http.StatusBadRequest, code: codeUnsupportedNetwork, message: "unsupported network"}
+		}
+
+		policy, allowed := p.tierPolicy(network, plan.tier)
+		switch {
+		case p.sunset(network):
+			plan.rejected[network] = &apiError{
+				status:  http.StatusGone,
+				code:    codeNetworkSunset,
+				message: fmt.Sprintf("Payouts on %s ended on %s, the network is deprecated", network, p.sunsets[network].Format(sunsetLayout)),
+			}
+		case p.paused[network]:
+			plan.rejected[network] = &apiError{
+				status:  http.StatusServiceUnavailable,
+				code:    codeNetworkUnavailable,
+				message: fmt.Sprintf("Claims on %s are paused, please try again later", network),
+			}
+		case !allowed:
+			plan.rejected[network] = p.tierError(network, plan.tier)
+		case requested.GreaterThan(policy.MaxAmount):
+			plan.rejected[network] = &apiError{
+				status:  http.StatusBadRequest,
+				code:    codeInvalidAmount,
+				message: fmt.Sprintf("You can claim at most %s on %s", policy.MaxAmount, network),
+			}
+		case !p.exact(network, requested):
+			plan.rejected[network] = &apiError{
+				status:  http.StatusBadRequest,
+				code:    codeInvalidAmount,
+				message: fmt.Sprintf("Amounts on %s have at most %d decimals", network, p.decimals[network]),
+			}
+		default:
+			plan.amounts[network] = policy.Payout
+			if requested.IsPositive() {
+				plan.amounts[network] = requested
+			}
+			plan.limits[network] = policy.limits
+		}
+	}
+	return plan, nil
+}
+
+// claimant is who a claim pays: an address, and the name it was resolved
+// from when the claim was made to a name
+type claimant struct {
+	address string
+	name    string
+}
+
+// claimant resolves the address a claim is made to, which is either an
+// address or a name
+func (p *claimPlanner) claimant(ctx context.Context, address string) (claimant, *apiError) {
+	if chain.IsValidAddress(address, false) {
+		return claimant{address: address}, nil
+	}
+	name, ok := chain.NormalizeName(address)
+	if !ok || p.resolver == nil {
+		return claimant{}, &apiError{status: http.StatusBadRequest, code: codeInvalidAddress, message: "invalid address"}
+	}
+
+	ctx, span := tracer.Start(ctx, "resolve name", trace.WithAttributes(attribute.String("name", name)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	resolved, err := p.resolver.Resolve(ctx, name)
+	if errors.Is(err, chain.ErrNameNotFound) {
+		return claimant{}, &apiError{status: http.StatusBadRequest, code: codeInvalidAddress, message: fmt.Sprintf("%s does not resolve to an address", name)}
+	}
+	if err != nil {
+		log.WithError(err).WithField("name", name).Error("Failed to resolve name")
+		return claimant{}, &apiError{status: http.StatusServiceUnavailable, code: codeNetworkUnavailable, message: "Names cannot be resolved right now, please use an address"}
+	}
+	return claimant{address: resolved.Hex(), name: name}, nil
+}
+
+// exact reports whether amount can be paid on network without rounding
+func (p *claimPlanner) exact(network string, amount decimal.Decimal) bool {
+	_, err := chain.ToBaseUnits(amount, p.decimals[network])
+	return err == nil
+}
+
+// tierPolicy returns what tier gets on network. A tier the network does not
+// configure gets what the next weaker one does, so that a caller never gets
+// less for a stronger credential.
+func (p *claimPlanner) tierPolicy(network string, tier config.Tier) (tierPolicy, bool) {
+	weaker := false
+	for i := len(config.Tiers) - 1; i >= 0; i-- {
+		weaker = weaker || config.Tiers[i] == tier
+		if policy, exists := p.tiers[network][config.Tiers[i]]; weaker && exists {
+			return policy, true
+		}
+	}
+	return tierPolicy{}, false
+}
+
+// sunset reports whether payouts on the network have ended
+func (p *claimPlanner) sunset(network string) bool {
+	sunset, exists := p.sunsets[network]
+	return exists && !time.Now().Before(sunset)
+}
+
+// sunsetLayout is how sunsets are shown in messages
+const sunsetLayout = "2006-01-02"
+
+// formatSunset formats a sunset for API responses, empty when there is none
+func formatSunset(sunset time.Time) string {
+	if sunset.IsZero() {
+		return ""
+	}
+	return sunset.UTC().Format(time.RFC3339)
+}
+
+// tierError rejects a tier that gets nothing on network
+func (p *claimPlanner) tierError(network string, tier config.Tier) *apiError {
+	if tier == config.TierAnonymous && p.captcha {
+		return &apiError{status: http.StatusTooManyRequests, code: codeCaptchaFailed, message: "Captcha verification failed, please try again"}
+	}
+	return &apiError{status: http.StatusForbidden, code: codeTierNotAllowed, message: fmt.Sprintf("Claims on %s are not available to %s callers", network, tier)}
+}
+
+// rejection returns the error of a claim that is rejected on every network:
+// the rate limit that ends first, or else the error of the first network
+func (plan *claimPlan) rejection() *apiError {
+	var rejection *apiError
+	for _, network := range plan.networks {
+		err := plan.rejected[network]
+		switch {
+		case rejection == nil:
+			rejection = err
+		case err.code == codeRateLimited && (rejection.code != codeRateLimited || err.retryAfter < rejection.retryAfter):
+			rejection = err
+		}
+	}
+	return rejection
+}
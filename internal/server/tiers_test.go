@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+)
+
+func TestClaimTiers(t *testing.T) {
+	multiConfig := config.NewMultiChainConfig()
+	multiConfig.HcaptchaSecret = "secret"
+	multiConfig.APIKeys = []string{"test-key"}
+	multiConfig.AuthHeader = "X-Forwarded-User"
+	if err := multiConfig.AddChainWithKey(config.ChainConfigInput{
+		Network:    "sepolia",
+		Provider:   "http://127.0.0.1:8545",
+		RateLimits: []ratelimit.Rule{},
+		Tiers: map[config.Tier]config.TierConfig{
+			config.TierAnonymous: {Payout: decimal.RequireFromString("0.1")},
+			config.TierAPIKey: {
+				Payout:     decimal.NewFromInt(1),
+				MaxAmount:  decimal.NewFromInt(5),
+				RateLimits: []ratelimit.Rule{{Key: ratelimit.KeyAPIKey, Quota: decimal.NewFromInt(6), Window: 24 * time.Hour}},
+			},
+			config.TierSocial: {Payout: decimal.RequireFromString("0.5")},
+		},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Transfer", mock.Anything, mock.Anything, mock.Anything).Return(common.Hash{1}, nil)
+	server, err := NewMultiChainServerWithBuilders(multiConfig, map[string]chain.TxBuilder{"sepolia": mockBuilder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(server.Close)
+	router := server.setupRouter()
+
+	// Requests run in order, so the API key quota is used up by the earlier ones
+	tests := []struct {
+		name       string
+		header     http.Header
+		amount     string
+		wantStatus int
+		wantCode   errorCode
+		wantAmount string
+		wantWei    string
+	}{
+		{name: "anonymous payout", wantStatus: http.StatusOK, wantAmount: "0.1", wantWei: "100000000000000000"},
+		{name: "anonymous above max", amount: `"0.2"`, wantStatus: http.StatusBadRequest, wantCode: codeInvalidAmount},
+		{name: "api key payout", header: http.Header{"X-Api-Key": {"test-key"}}, wantStatus: http.StatusOK, wantAmount: "1"},
+		{name: "api key amount", header: http.Header{"X-Api-Key": {"test-key"}}, amount: "4.5", wantStatus: http.StatusOK, wantAmount: "4.5"},
+		{name: "api key too precise", header: http.Header{"X-Api-Key": {"test-key"}}, amount: `"0.0000000000000000001"`, wantStatus: http.StatusBadRequest, wantCode: codeInvalidAmount},
+		{name: "api key quota", header: http.Header{"X-Api-Key": {"test-key"}}, amount: "1", wantStatus: http.StatusTooManyRequests, wantCode: codeRateLimited},
+		{name: "social login", header: http.Header{"X-Forwarded-User": {"alice@example.com"}}, wantStatus: http.StatusOK, wantAmount: "0.5"},
+		{name: "unknown api key", header: http.Header{"X-Forwarded-User": {"bob@example.com"}, "X-Api-Key": {"other-key"}}, wantStatus: http.StatusUnauthorized, wantCode: codeInvalidAPIKey},
+		{name: "invalid amount", amount: `"lots"`, wantStatus: http.StatusBadRequest, wantCode: codeInvalidRequest},
+		{name: "negative amount", amount: "-1", wantStatus: http.StatusBadRequest, wantCode: codeInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"address": "` + testAddress + `"`
+			if tt.amount != "" {
+				body += `, "amount": ` + tt.amount
+			}
+			req := httptest.NewRequest("POST", "/api/v1/claims", strings.NewReader(body+"}"))
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+
+			if tt.wantCode != "" {
+				var resp errorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Error.Code != tt.wantCode {
+					t.Errorf("code = %s, want %s", resp.Error.Code, tt.wantCode)
+				}
+				return
+			}
+			var claim claimV1
+			if err := json.Unmarshal(rr.Body.Bytes(), &claim); err != nil {
+				t.Fatal(err)
+			}
+			if claim.Amount != tt.wantAmount {
+				t.Errorf("amount = %s, want %s", claim.Amount, tt.wantAmount)
+			}
+			if tt.wantWei != "" && claim.AmountWei != tt.wantWei {
+				t.Errorf("amount_wei = %s, want %s", claim.AmountWei, tt.wantWei)
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/negroni/v3"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/queue"
+)
+
+// apiV1Prefix is the path every route of the versioned API starts with
+const apiV1Prefix = "/api/v1/"
+
+type networkV1 struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Symbol    string `json:"symbol"`
+	ChainID   int64  `json:"chain_id"`
+	IsTestnet bool   `json:"is_testnet"`
+	Decimals  int    `json:"decimals"`
+	Account   string `json:"account"`
+	Payout    string `json:"payout"`
+	// State is the lifecycle state, claims are refused from the sunset on
+	State  string `json:"state"`
+	Sunset string `json:"sunset,omitempty"`
+	Paused bool   `json:"paused,omitempty"`
+	// Metadata for wallets and explorer links, see config.NetworkMetadata
+	CurrencyName       string `json:"currency_name,omitempty"`
+	RPCURL             string `json:"rpc_url,omitempty"`
+	ExplorerTxURL      string `json:"explorer_tx_url,omitempty"`
+	ExplorerAddressURL string `json:"explorer_address_url,omitempty"`
+	Icon               string `json:"icon,omitempty"`
+	// Tiers lists what each kind of caller can claim, tiers that get nothing are left out
+	Tiers map[config.Tier]tierV1 `json:"tiers"`
+}
+
+// tierV1 is the payout of a tier and the largest amount it may request
+type tierV1 struct {
+	Payout    string `json:"payout"`
+	MaxAmount string `json:"max_amount"`
+}
+
+type infoV1 struct {
+	DefaultNetwork  string      `json:"default_network"`
+	HcaptchaSiteKey string      `json:"hcaptcha_sitekey,omitempty"`
+	NameService     string      `json:"name_service,omitempty"`
+	Networks        []networkV1 `json:"networks"`
+}
+
+type networksV1 struct {
+	DefaultNetwork string      `json:"default_network"`
+	Networks       []networkV1 `json:"networks"`
+}
+
+// claimV1 is a claim of the versioned API. Amount is in units of Symbol,
+// AmountWei in the smallest unit of the network.
+type claimV1 struct {
+	ClaimID       string       `json:"claim_id"`
+	Status        queue.Status `json:"status"`
+	Network       string       `json:"network"`
+	Address       string       `json:"address"`
+	Name          string       `json:"name,omitempty"`
+	Amount        string       `json:"amount"`
+	AmountWei     string       `json:"amount_wei"`
+	Symbol        string       `json:"symbol"`
+	Position      int          `json:"position,omitempty"`
+	TxHash        string       `json:"tx_hash,omitempty"`
+	ExplorerURL   string       `json:"explorer_url,omitempty"`
+	LogIndex      *uint        `json:"log_index,omitempty"`
+	BlockNumber   uint64       `json:"block_number,omitempty"`
+	Confirmations uint64       `json:"confirmations,omitempty"`
+	Final         bool         `json:"final"`
+	Error         string       `json:"error,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// multiClaimV1 lists the result of each network of a multi-network claim
+type multiClaimV1 struct {
+	Address string          `json:"address"`
+	Name    string          `json:"name,omitempty"`
+	Results []claimResultV1 `json:"results"`
+}
+
+// claimResultV1 is the claim on one network, or the error it failed with
+type claimResultV1 struct {
+	Network string     `json:"network"`
+	Result  string     `json:"result"`
+	Claim   *claimV1   `json:"claim,omitempty"`
+	Error   *errorBody `json:"error,omitempty"`
+}
+
+// setupV1Routes registers the versioned API, which is described by openapi.yaml
+func (s *MultiChainServer) setupV1Routes(router *http.ServeMux, auditor *Auditor, limiter *Limiter, captcha *Captcha) {
+	router.Handle(apiV1Prefix+"claims", allowMethod("POST", negroni.New(auditor, limiter, captcha, negroni.Wrap(s.handleV1Claim()))))
+	router.Handle(apiV1Prefix+"claims/", allowMethod("GET", s.handleV1ClaimStatus()))
+	router.Handle(apiV1Prefix+"info", allowMethod("GET", s.handleV1Info()))
+	router.Handle(apiV1Prefix+"networks", allowMethod("GET", s.handleV1Networks()))
+	router.Handle(apiV1Prefix+"openapi.yaml", allowMethod("GET", handleOpenAPI()))
+	router.HandleFunc(apiV1Prefix, func(w http.ResponseWriter, r *http.Request) {
+		renderError(w, r, &apiError{status: http.StatusNotFound, code: codeNotFound, message: "no such route"})
+	})
+}
+
+// allowMethod rejects requests with any other method than the given one
+func allowMethod(method string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			renderError(w, r, &apiError{status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed, message: "method not allowed"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *MultiChainServer) handleV1Claim() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req multiChainClaimRequest
+		if err := decodeJSONBody(r, &req); err != nil {
+			renderError(w, r, requestError(err))
+			return
+		}
+		if req.isMulti() {
+			s.renderV1MultiClaim(w, r, req)
+			return
+		}
+
+		outcome, apiErr := s.submitClaim(r, req)
+		if apiErr != nil {
+			renderError(w, r, apiErr)
+			return
+		}
+
+		w.Header().Set("Location", apiV1Prefix+"claims/"+outcome.claim.ID)
+		status := http.StatusAccepted
+		if outcome.sent {
+			status = http.StatusOK
+		}
+		claim := s.v1Claim(outcome.claim, outcome.position)
+		claim.Name = outcome.name
+		renderJSON(w, claim, status)
+	}
+}
+
+// renderV1MultiClaim submits a multi-network claim and lists the result of every network
+func (s *MultiChainServer) renderV1MultiClaim(w http.ResponseWriter, r *http.Request, req multiChainClaimRequest) {
+	claimant, results, status, apiErr := s.submitClaims(r, req)
+	if apiErr != nil {
+		renderError(w, r, apiErr)
+		return
+	}
+
+	resp := multiClaimV1{Address: claimant.address, Name: claimant.name, Results: make([]claimResultV1, 0, len(results))}
+	for _, result := range results {
+		item := claimResultV1{Network: result.network, Result: result.kind()}
+		if result.err != nil {
+			item.Error = &errorBody{
+				Code:       result.err.code,
+				Message:    result.err.message,
+				RetryAfter: int(math.Ceil(result.err.retryAfter.Seconds())),
+			}
+		} else {
+			claim := s.v1Claim(result.outcome.claim, result.outcome.position)
+			claim.Name = result.outcome.name
+			item.Claim = &claim
+		}
+		resp.Results = append(resp.Results, item)
+	}
+	renderJSON(w, resp, status)
+}
+
+// handleV1ClaimStatus returns a claim, or streams its updates when /events
+// is appended to the path
+func (s *MultiChainServer) handleV1ClaimStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, apiV1Prefix+"claims/")
+		if strings.HasSuffix(id, "/events") {
+			s.streamClaimEvents(w, r, strings.TrimSuffix(id, "/events"), s.v1ClaimView)
+			return
+		}
+		claim, position, exists := s.claims.Get(id)
+		if !exists {
+			renderError(w, r, errClaimNotFound)
+			return
+		}
+
+		renderJSON(w, s.v1ClaimView(claim, position), http.StatusOK)
+	}
+}
+
+func (s *MultiChainServer) handleV1Info() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, infoV1{
+			DefaultNetwork:  s.multiConfig.DefaultChain,
+			HcaptchaSiteKey: s.multiConfig.HcaptchaSiteKey,
+			NameService:     s.nameService(),
+			Networks:        s.v1Networks(),
+		}, http.StatusOK)
+	}
+}
+
+func (s *MultiChainServer) handleV1Networks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderJSON(w, networksV1{
+			DefaultNetwork: s.multiConfig.DefaultChain,
+			Networks:       s.v1Networks(),
+		}, http.StatusOK)
+	}
+}
+
+// v1Networks lists the active networks sorted by ID
+func (s *MultiChainServer) v1Networks() []networkV1 {
+	networks := make([]networkV1, 0, len(s.multiConfig.Chains))
+	now := time.Now()
+	for network, chainInstance := range s.multiConfig.GetActiveChains() {
+		tiers := make(map[config.Tier]tierV1)
+		for _, tier := range config.Tiers {
+			if policy, allowed := s.planner.tierPolicy(network, tier); allowed {
+				tiers[tier] = tierV1{Payout: policy.Payout.String(), MaxAmount: policy.MaxAmount.String()}
+			}
+		}
+		networks = append(networks, networkV1{
+			ID:        network,
+			Name:      chainInstance.Config.Name,
+			Symbol:    chainInstance.Config.Symbol,
+			ChainID:   chainInstance.Config.ChainID,
+			IsTestnet: chainInstance.Config.IsTestnet,
+			Decimals:  chainInstance.Config.Decimals,
+			Account:   s.builders[network].Sender().String(),
+			Payout:    chainInstance.Payout.String(),
+			State:     string(chainInstance.Config.StateAt(now)),
+			Sunset:    formatSunset(chainInstance.Config.Sunset),
+			Paused:    chainInstance.Paused,
+			Tiers:     tiers,
+
+			CurrencyName:       chainInstance.Config.CurrencyName,
+			RPCURL:             chainInstance.Config.PublicRPC,
+			ExplorerTxURL:      chainInstance.Config.ExplorerTxURL,
+			ExplorerAddressURL: chainInstance.Config.ExplorerAddressURL,
+			Icon:               chainInstance.Config.Icon,
+		})
+	}
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].ID < networks[j].ID
+	})
+	return networks
+}
+
+func (s *MultiChainServer) v1ClaimView(claim queue.Claim, position int) interface{} {
+	return s.v1Claim(claim, position)
+}
+
+func (s *MultiChainServer) v1Claim(claim queue.Claim, position int) claimV1 {
+	view := claimV1{
+		ClaimID:       claim.ID,
+		Status:        claim.Status,
+		Network:       claim.Network,
+		Address:       claim.Address,
+		Position:      position,
+		TxHash:        claim.TxHash,
+		LogIndex:      claim.LogIndex,
+		BlockNumber:   claim.BlockNumber,
+		Confirmations: claim.Confirmations,
+		Final:         claim.Final,
+		CreatedAt:     claim.CreatedAt,
+		UpdatedAt:     claim.UpdatedAt,
+	}
+	if claim.Status == queue.StatusFailed {
+		view.Error = s.payoutError(claim).message
+	}
+	decimals := chain.DefaultDecimals
+	if chainInstance, exists := s.multiConfig.GetChain(claim.Network); exists {
+		view.Symbol = chainInstance.Config.Symbol
+		decimals = chainInstance.Config.Decimals
+		if claim.TxHash != "" {
+			view.ExplorerURL = chainInstance.Config.TxURL(claim.TxHash)
+		}
+	}
+	if claim.Amount != nil {
+		view.Amount = chain.FromBaseUnits(claim.Amount, decimals).String()
+		view.AmountWei = claim.Amount.String()
+	}
+	return view
+}
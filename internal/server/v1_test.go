@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/mock"
+	"gopkg.in/yaml.v3"
+)
+
+func TestV1Routes(t *testing.T) {
+	mockBuilder := new(MockTxBuilder)
+	mockBuilder.On("Sender").Return(common.HexToAddress(testAddress))
+	mockBuilder.On("Transfer", mock.Anything, testAddress, oneEther).Return(common.Hash{1}, nil)
+	router := setupMultiChainTestServer(t, mockBuilder, false).setupRouter()
+	claimBody := `{"address": "` + testAddress + `", "network": "sepolia"}`
+
+	// Requests run in order, so the second claim is rate limited
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   errorCode
+		wantBody   string
+	}{
+		{name: "info", method: "GET", path: "/api/v1/info", wantStatus: http.StatusOK, wantBody: `"id":"sepolia"`},
+		{name: "networks", method: "GET", path: "/api/v1/networks", wantStatus: http.StatusOK, wantBody: `"default_network":"sepolia"`},
+		{name: "claim", method: "POST", path: "/api/v1/claims", body: claimBody, wantStatus: http.StatusOK, wantBody: `"tx_hash":"` + (common.Hash{1}).Hex() + `"`},
+		{name: "rate limited", method: "POST", path: "/api/v1/claims", body: claimBody, wantStatus: http.StatusTooManyRequests, wantCode: codeRateLimited, wantBody: `"retry_after":86400`},
+		{name: "invalid address", method: "POST", path: "/api/v1/claims", body: `{"address": "0x1234"}`, wantStatus: http.StatusBadRequest, wantCode: codeInvalidAddress},
+		{name: "unsupported network", method: "POST", path: "/api/v1/claims", body: `{"address": "` + testAddress + `", "network": "nope"}`, wantStatus: http.StatusBadRequest, wantCode: codeUnsupportedNetwork},
+		{name: "unknown field", method: "POST", path: "/api/v1/claims", body: `{"addr": "x"}`, wantStatus: http.StatusBadRequest, wantCode: codeInvalidRequest},
+		{name: "wrong method", method: "GET", path: "/api/v1/claims", wantStatus: http.StatusMethodNotAllowed, wantCode: codeMethodNotAllowed},
+		{name: "claim not found", method: "GET", path: "/api/v1/claims/missing", wantStatus: http.StatusNotFound, wantCode: codeClaimNotFound},
+		{name: "unknown route", method: "GET", path: "/api/v1/nope", wantStatus: http.StatusNotFound, wantCode: codeNotFound},
+		{name: "openapi", method: "GET", path: "/api/v1/openapi.yaml", wantStatus: http.StatusOK, wantBody: "openapi: 3.0.3"},
+		{name: "legacy error", method: "POST", path: "/api/claim", body: claimBody, wantStatus: http.StatusTooManyRequests, wantBody: `"msg":"You have exceeded the rate limit`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.RemoteAddr = "192.0.2.1:1234"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantCode != "" {
+				var resp errorResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if resp.Error.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", resp.Error.Code, tt.wantCode)
+				}
+			}
+			if !strings.Contains(rr.Body.String(), tt.wantBody) {
+				t.Errorf("body %s does not contain %s", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]interface{} `yaml:"paths"`
+	}
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/info", "/networks", "/claims", "/claims/{claim_id}", "/claims/{claim_id}/events", "/openapi.yaml"} {
+		if _, ok := spec.Paths[path]; !ok {
+			t.Errorf("path %s is not documented", path)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters spans can be sent to
+const (
+	// ExporterNone drops spans, which is the default
+	ExporterNone = "none"
+	// ExporterOTLP sends spans to an OTLP/HTTP collector
+	ExporterOTLP = "otlp"
+	// ExporterStdout prints spans as JSON, for local debugging
+	ExporterStdout = "stdout"
+)
+
+// DefaultServiceName is the service spans are reported for
+const DefaultServiceName = "multi-chain-faucet"
+
+// Config selects where spans are exported to
+type Config struct {
+	// Exporter is none, otlp or stdout; empty is none
+	Exporter string
+	// Endpoint is the host:port of the OTLP collector. Empty falls back to
+	// OTEL_EXPORTER_OTLP_ENDPOINT, or else localhost:4318.
+	Endpoint string
+	// Insecure sends spans to the collector over plain HTTP
+	Insecure bool
+	// SampleRatio is the share of traces that are sampled, 0 samples all
+	SampleRatio float64
+	// ServiceName defaults to DefaultServiceName
+	ServiceName string
+}
+
+// Validate checks the exporter and the sample ratio
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case "", ExporterNone, ExporterOTLP, ExporterStdout:
+	default:
+		return fmt.Errorf("unknown tracing exporter %q, want %s, %s or %s", c.Exporter, ExporterNone, ExporterOTLP, ExporterStdout)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio %v is not between 0 and 1", c.SampleRatio)
+	}
+	return nil
+}
+
+// Enabled reports whether spans are exported
+func (c Config) Enabled() bool {
+	return c.Exporter != "" && c.Exporter != ExporterNone
+}
+
+// Setup installs a global tracer provider that exports spans as configured
+// and propagates W3C trace context. Without an exporter the no-op provider
+// stays in place. The returned function flushes and stops the exporter.
+func Setup(ctx context.Context, c Config) (func(context.Context) error, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	if !c.Enabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if c.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if c.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, options...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout), stdouttrace.WithPrettyPrint())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", c.Exporter, err)
+	}
+
+	serviceName := c.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	sampler := sdktrace.AlwaysSample()
+	if c.SampleRatio > 0 {
+		sampler = sdktrace.TraceIDRatioBased(c.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
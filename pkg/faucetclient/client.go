@@ -0,0 +1,308 @@
+// Package faucetclient is a client for the /api/v1 API of multi-chain-faucet,
+// e.g. to fund accounts from a test suite:
+//
+//	client, err := faucetclient.New("https://faucet.example.com", faucetclient.WithAPIKey(key))
+//	claim, err := client.Claim(ctx, "sepolia", address)
+//	claim, err = client.WaitForClaim(ctx, claim.ID)
+package faucetclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultMaxRetryWait = 30 * time.Second
+	defaultPollInterval = 2 * time.Second
+	// retryBackoff is the first delay between retries without Retry-After, doubled on every retry
+	retryBackoff = 500 * time.Millisecond
+)
+
+// Client calls the faucet API. It is safe for concurrent use.
+type Client struct {
+	baseURL      *url.URL
+	httpClient   *http.Client
+	apiKey       string
+	maxRetries   int
+	maxRetryWait time.Duration
+	pollInterval time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithAPIKey sends the key in the X-API-Key header. Keys configured in the
+// faucet's api_keys skip the captcha.
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how often a rate-limited, queue-full or failed request is
+// retried, and the longest Retry-After that is waited for. Longer waits
+// return the error right away.
+func WithRetries(maxRetries int, maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.maxRetryWait = maxWait
+	}
+}
+
+// WithPollInterval sets how often WaitForClaim checks the claim status
+func WithPollInterval(interval time.Duration) Option {
+	return func(c *Client) {
+		c.pollInterval = interval
+	}
+}
+
+// New creates a client for the faucet at baseURL, e.g. https://faucet.example.com
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("faucet URL must be http or https, got %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/api/v1/"
+
+	c := &Client{
+		baseURL:      u,
+		httpClient:   http.DefaultClient,
+		maxRetries:   defaultMaxRetries,
+		maxRetryWait: defaultMaxRetryWait,
+		pollInterval: defaultPollInterval,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Info returns the faucet settings and its active networks
+func (c *Client) Info(ctx context.Context) (*Info, error) {
+	var info Info
+	if err := c.do(ctx, "GET", "info", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Networks returns the active networks sorted by ID
+func (c *Client) Networks(ctx context.Context) ([]Network, error) {
+	var list networkList
+	if err := c.do(ctx, "GET", "networks", nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Networks, nil
+}
+
+// Claim requests the payout of network for address, or of the default
+// network if network is empty. The claim is either broadcast or still queued
+// when it is returned.
+// address may be a name such as vitalik.eth when Info reports a name
+// service; the claim then holds the name and the address it resolved to.
+func (c *Client) Claim(ctx context.Context, network, address string) (*Claim, error) {
+	return c.ClaimAmount(ctx, network, address, "")
+}
+
+// ClaimAmount is like Claim but requests amount in units of the network
+// symbol, e.g. "0.25", instead of the payout. The amount is limited by the
+// max_amount of the caller's tier.
+func (c *Client) ClaimAmount(ctx context.Context, network, address, amount string) (*Claim, error) {
+	body, err := json.Marshal(claimRequest{Address: address, Network: network, Amount: amount})
+	if err != nil {
+		return nil, err
+	}
+	var claim Claim
+	if err := c.do(ctx, "POST", "claims", body, &claim); err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// ClaimNetworks requests the payouts of several networks for address with a
+// single request, or of every active network if no network is given. The
+// error is only set when the request as a whole failed, e.g. because every
+// network is rate limited.
+func (c *Client) ClaimNetworks(ctx context.Context, address string, networks ...string) ([]ClaimResult, error) {
+	req := claimRequest{Address: address, Networks: "all"}
+	if len(networks) > 0 {
+		req.Networks = networks
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp multiClaim
+	if err := c.do(ctx, "POST", "claims", body, &resp); err != nil {
+		return nil, err
+	}
+
+	results := make([]ClaimResult, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		result := ClaimResult{Network: r.Network, Result: r.Result, Claim: r.Claim}
+		if r.Error != nil {
+			result.Err = r.Error.toError(0)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ClaimStatus returns the current state of a claim
+func (c *Client) ClaimStatus(ctx context.Context, id string) (*Claim, error) {
+	var claim Claim
+	if err := c.do(ctx, "GET", "claims/"+url.PathEscape(id), nil, &claim); err != nil {
+		return nil, err
+	}
+	return &claim, nil
+}
+
+// WaitForClaim polls a claim until it is final, i.e. confirmed or failed. A
+// failed claim is returned together with an error wrapping ErrClaimFailed.
+func (c *Client) WaitForClaim(ctx context.Context, id string) (*Claim, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		claim, err := c.ClaimStatus(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if claim.Final {
+			if claim.Status == StatusFailed {
+				return claim, fmt.Errorf("%w: %s", ErrClaimFailed, claim.Error)
+			}
+			return claim, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return claim, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// do sends a request and decodes the response into out, retrying as long
+// as the error is temporary and the server asks for a short enough wait
+func (c *Client) do(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		err := c.send(ctx, method, path, body, out)
+		if err == nil || attempt >= c.maxRetries || !c.retryable(method, err) {
+			return err
+		}
+
+		delay := retryBackoff << attempt
+		if apiErr, ok := err.(*Error); ok && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+		if delay > c.maxRetryWait {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// retryable reports whether a request may be sent again. Claims are only
+// retried when the server rejected them before paying out.
+func (c *Client) retryable(method string, err error) bool {
+	apiErr, ok := err.(*Error)
+	if !ok {
+		return method == "GET"
+	}
+	if apiErr.temporary() {
+		return true
+	}
+	return method == "GET" && apiErr.StatusCode >= http.StatusInternalServerError
+}
+
+func (c *Client) send(ctx context.Context, method, path string, body []byte, out interface{}) error {
+	u := c.baseURL.ResolveReference(&url.URL{Path: path})
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return parseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// parseError reads the error of a response. Responses that are not from the
+// faucet, e.g. of a proxy, get a code derived from their status.
+func parseError(resp *http.Response) *Error {
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	var body errorResponse
+	if err := json.Unmarshal(data, &body); err == nil && body.Error.Code != "" {
+		apiErr = body.Error.toError(resp.StatusCode)
+	} else {
+		apiErr.Code = CodeInternal
+		if resp.StatusCode == http.StatusNotFound {
+			apiErr.Code = CodeNotFound
+		}
+		apiErr.Message = strings.TrimSpace(string(data))
+		if apiErr.Message == "" {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+func (b *errorBody) toError(statusCode int) *Error {
+	return &Error{
+		StatusCode: statusCode,
+		Code:       b.Code,
+		Message:    b.Message,
+		RetryAfter: time.Duration(b.RetryAfter) * time.Second,
+	}
+}
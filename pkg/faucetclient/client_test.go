@@ -0,0 +1,198 @@
+package faucetclient
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+
+	"github.com/guyuxiang/multi-chain-faucet/internal/chain"
+	"github.com/guyuxiang/multi-chain-faucet/internal/config"
+	"github.com/guyuxiang/multi-chain-faucet/internal/ratelimit"
+	"github.com/guyuxiang/multi-chain-faucet/internal/server"
+)
+
+const (
+	testAPIKey     = "test-key"
+	testAddress    = "0xd8dA6BF26964aF9D7eEd9e03E53415D37aA96045"
+	failingAddress = "0x000000000000000000000000000000000000dEaD"
+)
+
+// fakeBuilder pays every address except failingAddress
+type fakeBuilder struct {
+	transfers int64
+}
+
+func (b *fakeBuilder) Sender() common.Address {
+	return common.HexToAddress("0x1111111111111111111111111111111111111111")
+}
+
+func (b *fakeBuilder) Transfer(ctx context.Context, to string, value *big.Int) (common.Hash, error) {
+	if to == failingAddress {
+		return common.Hash{}, errors.New("insufficient funds")
+	}
+	return common.BigToHash(big.NewInt(atomic.AddInt64(&b.transfers, 1))), nil
+}
+
+// newTestFaucet serves a faucet for sepolia that requires a captcha unless
+// the test API key is sent. wrap, if not nil, wraps the faucet handler.
+func newTestFaucet(t *testing.T, wrap func(http.Handler) http.Handler) *httptest.Server {
+	multiConfig := config.NewMultiChainConfig()
+	multiConfig.HcaptchaSecret = "secret"
+	multiConfig.APIKeys = []string{testAPIKey}
+	if err := multiConfig.AddChainWithKey(config.ChainConfigInput{
+		Network:    "sepolia",
+		Provider:   "http://127.0.0.1:8545",
+		Payout:     decimal.RequireFromString("0.5"),
+		RateLimits: []ratelimit.Rule{{Key: ratelimit.KeyAddress, Limit: 1, Window: 24 * time.Hour}},
+	}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	faucet, err := server.NewMultiChainServerWithBuilders(multiConfig, map[string]chain.TxBuilder{"sepolia": &fakeBuilder{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(faucet.Close)
+
+	handler := faucet.Handler()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestClient(t *testing.T) {
+	ts := newTestFaucet(t, nil)
+	client, err := New(ts.URL, WithAPIKey(testAPIKey), WithRetries(2, time.Second), WithPollInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	info, err := client.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.DefaultNetwork != "sepolia" || len(info.Networks) != 1 || info.Networks[0].Payout != "0.5" {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	networks, err := client.Networks(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(networks) != 1 || networks[0].ID != "sepolia" || networks[0].ChainID != 11155111 || networks[0].Decimals != 18 ||
+		networks[0].ExplorerTxURL != "https://sepolia.etherscan.io/tx/{hash}" || networks[0].Tiers["api_key"].MaxAmount != "0.5" {
+		t.Errorf("unexpected networks %+v", networks)
+	}
+
+	claim, err := client.Claim(ctx, "sepolia", testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.Status != StatusBroadcast || claim.TxHash == "" || claim.Amount != "0.5" || claim.Symbol != "ETH" ||
+		claim.ExplorerURL != "https://sepolia.etherscan.io/tx/"+claim.TxHash {
+		t.Errorf("unexpected claim %+v", claim)
+	}
+
+	final, err := client.WaitForClaim(ctx, claim.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !final.Final || final.TxHash != claim.TxHash {
+		t.Errorf("unexpected final claim %+v", final)
+	}
+
+	// The next day is longer than the client waits for a retry
+	_, err = client.Claim(ctx, "sepolia", testAddress)
+	var apiErr *Error
+	if !errors.Is(err, ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != 24*time.Hour {
+		t.Errorf("expected a rate limit error with a one day wait, got %v", err)
+	}
+
+	_, err = client.Claim(ctx, "", failingAddress)
+	if !errors.Is(err, ErrTransferFailed) {
+		t.Errorf("expected a transfer error, got %v", err)
+	}
+
+	_, err = client.ClaimStatus(ctx, "missing")
+	if !errors.Is(err, ErrClaimNotFound) {
+		t.Errorf("expected claim not found, got %v", err)
+	}
+
+	_, err = client.ClaimAmount(ctx, "sepolia", "0x4444444444444444444444444444444444444444", "1")
+	if !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("expected an invalid amount error, got %v", err)
+	}
+
+	_, err = client.Claim(ctx, "goerli", testAddress)
+	if !errors.Is(err, ErrUnsupportedNetwork) {
+		t.Errorf("expected an unsupported network error, got %v", err)
+	}
+
+	other := "0x3333333333333333333333333333333333333333"
+	results, err := client.ClaimNetworks(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Network != "sepolia" || results[0].Result != ResultSuccess || results[0].Claim.TxHash == "" {
+		t.Errorf("unexpected results %+v", results)
+	}
+	if _, err := client.ClaimNetworks(ctx, other, "sepolia"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected a rate limit error when every network is limited, got %v", err)
+	}
+
+	unauthorized, err := New(ts.URL, WithAPIKey("wrong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = unauthorized.Claim(ctx, "sepolia", "0x2222222222222222222222222222222222222222")
+	if !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected an invalid API key error, got %v", err)
+	}
+}
+
+func TestClientRetriesAfterRetryAfter(t *testing.T) {
+	var requests int64
+	ts := newTestFaucet(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt64(&requests, 1) == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				w.Write([]byte(`{"error": {"code": "queue_full", "message": "The faucet is busy"}}`))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	client, err := New(ts.URL, WithAPIKey(testAPIKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	claim, err := client.Claim(context.Background(), "sepolia", testAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claim.TxHash == "" {
+		t.Errorf("unexpected claim %+v", claim)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %s, before Retry-After", elapsed)
+	}
+	if n := atomic.LoadInt64(&requests); n != 2 {
+		t.Errorf("expected 2 requests, got %d", n)
+	}
+}
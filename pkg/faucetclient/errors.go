@@ -0,0 +1,85 @@
+package faucetclient
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorCode identifies an error returned by the faucet API
+type ErrorCode string
+
+// Error codes returned by the faucet API
+const (
+	CodeInvalidRequest     ErrorCode = "invalid_request"
+	CodeInvalidAddress     ErrorCode = "invalid_address"
+	CodeInvalidAmount      ErrorCode = "invalid_amount"
+	CodeUnsupportedNetwork ErrorCode = "unsupported_network"
+	CodeRateLimited        ErrorCode = "rate_limited"
+	CodeCaptchaFailed      ErrorCode = "captcha_failed"
+	CodeInvalidAPIKey      ErrorCode = "invalid_api_key"
+	CodeTierNotAllowed     ErrorCode = "tier_not_allowed"
+	CodeQueueFull          ErrorCode = "queue_full"
+	CodeNetworkUnavailable ErrorCode = "network_unavailable"
+	CodeNetworkSunset      ErrorCode = "network_sunset"
+	CodeTransferFailed     ErrorCode = "transfer_failed"
+	CodeFaucetEmpty        ErrorCode = "faucet_empty"
+	CodeRecipientRejected  ErrorCode = "recipient_rejected"
+	CodeNetworkCongested   ErrorCode = "network_congested"
+	CodeClaimNotFound      ErrorCode = "claim_not_found"
+	CodeNotFound           ErrorCode = "not_found"
+	CodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	CodeInternal           ErrorCode = "internal_error"
+)
+
+// Sentinel errors to match with errors.Is, e.g. errors.Is(err, ErrRateLimited)
+var (
+	ErrInvalidAddress     = &Error{Code: CodeInvalidAddress}
+	ErrInvalidAmount      = &Error{Code: CodeInvalidAmount}
+	ErrUnsupportedNetwork = &Error{Code: CodeUnsupportedNetwork}
+	ErrRateLimited        = &Error{Code: CodeRateLimited}
+	ErrCaptchaFailed      = &Error{Code: CodeCaptchaFailed}
+	ErrInvalidAPIKey      = &Error{Code: CodeInvalidAPIKey}
+	ErrTierNotAllowed     = &Error{Code: CodeTierNotAllowed}
+	ErrQueueFull          = &Error{Code: CodeQueueFull}
+	ErrNetworkSunset      = &Error{Code: CodeNetworkSunset}
+	ErrTransferFailed     = &Error{Code: CodeTransferFailed}
+	ErrFaucetEmpty        = &Error{Code: CodeFaucetEmpty}
+	ErrRecipientRejected  = &Error{Code: CodeRecipientRejected}
+	ErrNetworkCongested   = &Error{Code: CodeNetworkCongested}
+	ErrClaimNotFound      = &Error{Code: CodeClaimNotFound}
+)
+
+// ErrClaimFailed is returned by WaitForClaim when the claim could not be paid
+var ErrClaimFailed = errors.New("claim failed")
+
+// Error is an error response of the faucet API
+type Error struct {
+	StatusCode int
+	Code       ErrorCode
+	Message    string
+	// RetryAfter is how long to wait before the request is allowed again, zero if unknown
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.StatusCode == 0 {
+		return string(e.Code)
+	}
+	return fmt.Sprintf("faucet: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// Is reports whether target is an *Error with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// temporary reports whether the request may succeed when it is made again
+func (e *Error) temporary() bool {
+	switch e.Code {
+	case CodeRateLimited, CodeQueueFull:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package faucetclient
+
+import "time"
+
+// Status is the state of a claim
+type Status string
+
+const (
+	StatusQueued     Status = "queued"
+	StatusProcessing Status = "processing"
+	StatusSigned     Status = "signed"
+	StatusBroadcast  Status = "broadcast"
+	StatusMined      Status = "mined"
+	StatusFailed     Status = "failed"
+)
+
+// Info describes the faucet and its active networks
+type Info struct {
+	DefaultNetwork  string `json:"default_network"`
+	HcaptchaSiteKey string `json:"hcaptcha_sitekey,omitempty"`
+	// NameService is the network names are resolved on, empty when claims need an address
+	NameService string    `json:"name_service,omitempty"`
+	Networks    []Network `json:"networks"`
+}
+
+// Network is a network the faucet pays out on
+type Network struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Symbol    string `json:"symbol"`
+	ChainID   int64  `json:"chain_id"`
+	IsTestnet bool   `json:"is_testnet"`
+	// Decimals is the number of fractional digits amounts of Symbol may have
+	Decimals int `json:"decimals"`
+	// Account is the address payouts are sent from
+	Account string `json:"account"`
+	// Payout is the amount of each payout in units of Symbol
+	Payout string `json:"payout"`
+	// State is active or deprecated. Claims on a deprecated network are
+	// refused with ErrNetworkSunset from its Sunset on.
+	State  string    `json:"state"`
+	Sunset time.Time `json:"sunset,omitempty"`
+	// Paused networks refuse claims with CodeNetworkUnavailable until they are resumed
+	Paused bool `json:"paused,omitempty"`
+	// CurrencyName is the name of the native asset, e.g. Ether
+	CurrencyName string `json:"currency_name,omitempty"`
+	// RPCURL is a public RPC endpoint to add the network to a wallet with
+	RPCURL string `json:"rpc_url,omitempty"`
+	// ExplorerTxURL and ExplorerAddressURL link to a block explorer, with
+	// {hash} or {address} in place of a transaction hash or an address
+	ExplorerTxURL      string `json:"explorer_tx_url,omitempty"`
+	ExplorerAddressURL string `json:"explorer_address_url,omitempty"`
+	// Icon is the URL of an image of the network
+	Icon string `json:"icon,omitempty"`
+	// Tiers lists what each kind of caller can claim, keyed by anonymous,
+	// captcha, social or api_key
+	Tiers map[string]Tier `json:"tiers"`
+}
+
+// Tier is what one kind of caller can claim on a network, in units of Symbol
+type Tier struct {
+	// Payout is paid when a claim does not request an amount
+	Payout string `json:"payout"`
+	// MaxAmount is the largest amount a claim may request
+	MaxAmount string `json:"max_amount"`
+}
+
+// Claim is a payout requested from the faucet. Amount is in units of Symbol,
+// AmountWei in the smallest unit of the network.
+type Claim struct {
+	ID            string    `json:"claim_id"`
+	Status        Status    `json:"status"`
+	Network       string    `json:"network"`
+	Address       string    `json:"address"`
+	Name          string    `json:"name,omitempty"`
+	Amount        string    `json:"amount"`
+	AmountWei     string    `json:"amount_wei"`
+	Symbol        string    `json:"symbol"`
+	Position      int       `json:"position,omitempty"`
+	TxHash        string    `json:"tx_hash,omitempty"`
+	ExplorerURL   string    `json:"explorer_url,omitempty"`
+	LogIndex      *uint     `json:"log_index,omitempty"`
+	BlockNumber   uint64    `json:"block_number,omitempty"`
+	Confirmations uint64    `json:"confirmations,omitempty"`
+	Final         bool      `json:"final"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Results of the networks of a multi-network claim
+const (
+	ResultSuccess     = "success"
+	ResultRateLimited = "rate_limited"
+	ResultError       = "error"
+)
+
+// ClaimResult is the outcome of a multi-network claim on one network. Claim
+// is set on success, Err otherwise.
+type ClaimResult struct {
+	Network string
+	Result  string
+	Claim   *Claim
+	Err     *Error
+}
+
+type claimRequest struct {
+	Address  string      `json:"address"`
+	Network  string      `json:"network,omitempty"`
+	Networks interface{} `json:"networks,omitempty"`
+	Amount   string      `json:"amount,omitempty"`
+}
+
+type multiClaim struct {
+	Results []struct {
+		Network string     `json:"network"`
+		Result  string     `json:"result"`
+		Claim   *Claim     `json:"claim"`
+		Error   *errorBody `json:"error"`
+	} `json:"results"`
+}
+
+type networkList struct {
+	DefaultNetwork string    `json:"default_network"`
+	Networks       []Network `json:"networks"`
+}
+
+type errorBody struct {
+	Code       ErrorCode `json:"code"`
+	Message    string    `json:"message"`
+	RetryAfter int       `json:"retry_after"`
+}
+
+type errorResponse struct {
+	Error errorBody `json:"error"`
+}